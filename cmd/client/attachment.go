@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"os"
+	"path/filepath"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// attachmentSource is the payload of an attachment message: a file, or generated
+// pseudo-random data that can be produced twice (once for the checksum, once to send)
+type attachmentSource struct {
+	desc model.Attachment
+	path string   // File to send ("" for generated data)
+	seed [32]byte // Seed of the generated data
+}
+
+// newAttachmentSource describes the file at path or, without a path, size bytes of
+// generated data, computing the checksum announced in the message
+func newAttachmentSource(path string, size int64, chunk int) (*attachmentSource, error) {
+	if chunk <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive (got %d)", chunk)
+	}
+	source := &attachmentSource{path: path, desc: model.Attachment{Chunk: chunk}}
+	if path != "" {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		source.desc.Name, source.desc.Size = filepath.Base(path), info.Size()
+	} else {
+		rand.Read(source.seed[:])
+		source.desc.Name, source.desc.Size = fmt.Sprintf("generated-%d", size), size
+	}
+	if source.desc.Size <= 0 {
+		return nil, fmt.Errorf("attachment is empty")
+	}
+
+	payload, err := source.open()
+	if err != nil {
+		return nil, err
+	}
+	defer payload.Close()
+	sum := sha256.New()
+	if _, err := io.Copy(sum, payload); err != nil {
+		return nil, fmt.Errorf("checksum attachment: %w", err)
+	}
+	source.desc.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	return source, nil
+}
+
+// open returns a reader of the payload from its start
+func (s *attachmentSource) open() (io.ReadCloser, error) {
+	if s.path != "" {
+		return os.Open(s.path)
+	}
+	return io.NopCloser(io.LimitReader(mathrand.NewChaCha8(s.seed), s.desc.Size)), nil
+}
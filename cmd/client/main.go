@@ -10,15 +10,47 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/codec"
+	"github.com/ryo-arima/magic-cylinder/internal/compress"
 	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
+// maxResponseBytes bounds the response read from a server
+const maxResponseBytes = 1 << 20
+
 func main() {
 	// Parse command-line arguments
 	serverURL := flag.String("server", "https://localhost:8443/webtransport", "Server URL to connect")
+	keyLogFile := flag.String("keylog", os.Getenv("SSLKEYLOGFILE"), "Append TLS session keys to this file for traffic decryption (default $SSLKEYLOGFILE)")
+	qlogDir := flag.String("qlog", os.Getenv("QLOGDIR"), "Write a qlog trace per QUIC connection into this directory (default $QLOGDIR)")
+	caFile := flag.String("ca", "", "CA bundle used to verify the server certificate (default: system roots)")
+	pins := flag.String("pin", "", "Comma-separated SHA-256 fingerprints (hex or base64) of accepted server certificates")
+	insecure := flag.Bool("insecure", false, "Skip server certificate verification (development only)")
+	certFile := flag.String("cert", "", "Client certificate presented when the server requires mutual TLS (CN or a DNS SAN must be \"client\")")
+	keyFile := flag.String("key", "", "Key of the client certificate")
+	token := flag.String("token", os.Getenv("MC_AUTH_TOKEN"), "Bearer token or HMAC secret for servers with authentication (default $MC_AUTH_TOKEN)")
+	authMode := flag.String("auth", auth.ModeBearer, "How -token is sent: bearer or hmac")
+	signKey := flag.String("sign-key", "", "Ed25519 key signing the ping (servers verify it as sender \"client\")")
+	codecName := flag.String("codec", "json", "Wire codec: "+strings.Join(codec.Names(), ", ")+" (offered to WebTransport servers with a JSON fallback)")
+	compression := flag.String("compress", "none", "Payload compression offered to the server: none, zstd or gzip")
+	threshold := flag.Int("compress-threshold", 1024, "Send payloads smaller than this many bytes uncompressed")
+	msgType := flag.String("type", string(model.PingMessage), "Message type: ping, pong, echo, stop, stats, attachment or custom:<name>")
+	chain := flag.String("chain", "", "Chain ID of the message, e.g. to stop a running chain (default: a new chain)")
+	content := flag.String("content", "", "Message content (default: \"Initial <type> from client\")")
+	attachFile := flag.String("attach", "", "Send this file as an attachment message (WebTransport only)")
+	attachSize := flag.Int64("attach-size", 0, "Send this many bytes of generated data as an attachment message (WebTransport only)")
+	chunkSize := flag.Int("chunk", 64<<10, "Chunk size of the attachment in bytes (at most attachments.chunk_bytes of the server)")
 	flag.Parse()
 
 	log.Printf("============================================")
@@ -26,20 +58,101 @@ func main() {
 	log.Printf("[Client] Target server: %s", *serverURL)
 	log.Printf("============================================")
 
+	peerTLS := transport.ClientTLSOptions{CAFile: *caFile, Pins: transport.ParsePins(*pins), Insecure: *insecure}
+	if peerTLS.Insecure && (peerTLS.CAFile != "" || len(peerTLS.Pins) > 0) {
+		log.Fatalf("[Client] ❌ -insecure cannot be combined with -ca or -pin")
+	}
+	if *certFile != "" || *keyFile != "" {
+		store, err := transport.NewCertificateStore(*certFile, *keyFile)
+		if err != nil {
+			log.Fatalf("[Client] ❌ Failed to load client certificate: %v", err)
+		}
+		peerTLS.Certificate = store
+		log.Printf("[Client] Presenting client certificate %s (%s)", *certFile, store.Leaf().Subject)
+	}
+	tlsConfig, err := transport.NewClientTLSConfig(peerTLS)
+	if err != nil {
+		log.Fatalf("[Client] ❌ Failed to set up certificate verification: %v", err)
+	}
+	if peerTLS.Insecure {
+		log.Printf("[Client] ⚠ Server certificate verification is DISABLED (-insecure)")
+	} else {
+		log.Printf("[Client] Server certificate verification: %s", peerTLS.Mode())
+	}
+
+	var authn *auth.Authenticator
+	if *token != "" {
+		if authn, err = auth.New(*authMode, []string{*token}, "", 0, false); err != nil {
+			log.Fatalf("[Client] ❌ Failed to set up authentication: %v", err)
+		}
+		log.Printf("[Client] Authentication: %s", authn.Mode())
+	}
+
+	signer, err := signing.NewSigner(*signKey)
+	if err != nil {
+		log.Fatalf("[Client] ❌ Failed to load signing key: %v", err)
+	}
+	if signer != nil {
+		log.Printf("[Client] Signing messages with %s", *signKey)
+	}
+
+	wire, ok := codec.ByName(*codecName)
+	if !ok {
+		log.Fatalf("[Client] ❌ Unknown codec %q (use one of %s)", *codecName, strings.Join(codec.Names(), ", "))
+	}
+	compressor, err := compress.New(*compression, *threshold)
+	if err != nil {
+		log.Fatalf("[Client] ❌ Invalid -compress: %v", err)
+	}
+	log.Printf("[Client] Codec: %s, compression: %s", wire.Name(), compressor.Name())
+
+	var attachment *attachmentSource
+	if *attachFile != "" || *attachSize > 0 {
+		if *attachFile != "" && *attachSize > 0 {
+			log.Fatalf("[Client] ❌ -attach and -attach-size cannot be combined")
+		}
+		if attachment, err = newAttachmentSource(*attachFile, *attachSize, *chunkSize); err != nil {
+			log.Fatalf("[Client] ❌ Invalid attachment: %v", err)
+		}
+		*msgType, *content = string(model.AttachmentMessage), attachment.desc.Content()
+		log.Printf("[Client] Attachment %q: %d bytes in %d chunks, sha256 %s", attachment.desc.Name, attachment.desc.Size, attachment.desc.Chunks(), attachment.desc.SHA256)
+	}
+	if *content == "" {
+		*content = "Initial " + *msgType + " from client"
+	}
+	message := model.NewMessage(model.MessageType(*msgType), *content, 1, "client", "server")
+	message.Chain = *chain
+	if message.Chain == "" {
+		message.Chain = model.NewChainID()
+	}
+	if err := message.Validate(); err != nil {
+		log.Fatalf("[Client] ❌ Invalid message: %v", err)
+	}
+	signer.Sign(message)
+	log.Printf("[Client] Sending %s message on chain %s", message.Type, message.Chain)
+
+	debug, err := transport.NewDebug(*keyLogFile, *qlogDir, "client")
+	if err != nil {
+		log.Fatalf("[Client] ❌ Failed to set up QUIC/TLS debugging: %v", err)
+	}
+
 	// Send initial ping to trigger the pingpong loop (supports WebTransport or /plain)
-	err := sendPing(*serverURL)
+	err = sendPing(*serverURL, debug, tlsConfig, authn, message, attachment, wire, compressor)
+	debug.Close()
 	if err != nil {
-		log.Fatalf("[Client] ❌ Failed to send ping: %v", err)
+		log.Fatalf("[Client] ❌ Failed to send %s: %v", message.Type, err)
 	}
 
 	log.Printf("============================================")
-	log.Printf("[Client] ✅ Initial ping completed successfully")
-	log.Printf("[Client] Server will continue pingpong loop")
+	log.Printf("[Client] ✅ Initial %s completed successfully", message.Type)
+	if message.Type == model.PingMessage || message.Type == model.PongMessage {
+		log.Printf("[Client] Server will continue pingpong loop")
+	}
 	log.Printf("============================================")
 }
 
-// sendPing sends an initial ping message to the server
-func sendPing(serverURL string) error {
+// sendPing sends the initial (ping) message to the server
+func sendPing(serverURL string, debug *transport.Debug, tlsConfig *tls.Config, authn *auth.Authenticator, message *model.Message, attachment *attachmentSource, wire codec.Codec, compressor *compress.Compressor) error {
 	log.Printf("[Client] Parsing server URL: %s", serverURL)
 	u, err := url.Parse(serverURL)
 	if err != nil {
@@ -53,33 +166,53 @@ func sendPing(serverURL string) error {
 	switch {
 	case cleanPath == "/plain":
 		log.Printf("[Client] Mode selected: PLAINTEXT (HTTP POST)")
-		return sendPlain(u)
+		if attachment != nil {
+			return fmt.Errorf("attachments need a WebTransport server URL")
+		}
+		return sendPlain(u, debug, tlsConfig, authn, message, wire, compressor)
 	case cleanPath == "/webtransport":
 		log.Printf("[Client] Mode selected: WEBTRANSPORT")
-		return sendWebTransportPing(u)
+		return sendWebTransportPing(u, debug, tlsConfig, authn, message, attachment, wire, compressor)
 	default:
 		log.Printf("[Client] ⚠ Unknown path '%s' -> defaulting to WEBTRANSPORT attempt", cleanPath)
-		return sendWebTransportPing(u)
+		return sendWebTransportPing(u, debug, tlsConfig, authn, message, attachment, wire, compressor)
 	}
 }
 
-func sendWebTransportPing(u *url.URL) error {
-	// Create WebTransport dialer with insecure skip verify for self-signed certs
-	log.Printf("[Client] Creating WebTransport dialer with TLS InsecureSkipVerify")
+func sendWebTransportPing(u *url.URL, debug *transport.Debug, tlsConfig *tls.Config, authn *auth.Authenticator, message *model.Message, attachment *attachmentSource, wire codec.Codec, compressor *compress.Compressor) error {
+	log.Printf("[Client] Creating WebTransport dialer")
 	dialer := &webtransport.Dialer{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		TLSClientConfig: debug.ApplyTLS(tlsConfig.Clone()),
+		QUICConfig:      debug.ApplyQUIC(&quic.Config{EnableDatagrams: true}),
+	}
+
+	headers := authn.Headers(http.MethodConnect, u.Path, nil)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(codec.HeaderAvailableProtocols, codec.FormatList(wire.Name(), codec.JSON.Name()))
+	if compressor != nil {
+		headers.Set(compress.HeaderAccept, codec.FormatList(compressor.Name()))
 	}
 
 	serverURL := u.String()
 	log.Printf("[Client] Dialing server at %s...", serverURL)
-	_, conn, err := dialer.Dial(context.Background(), serverURL, nil)
+	rsp, conn, err := dialer.Dial(context.Background(), serverURL, headers)
 	if err != nil {
 		log.Printf("[Client] ❌ Failed to dial server: %v", err)
 		log.Printf("[Client]   Error type: %T", err)
 		return fmt.Errorf("failed to dial server: %w", err)
 	}
 	defer conn.CloseWithError(0, "client disconnect")
-	log.Printf("[Client] ✅ Connected to server successfully")
+	if selected := codec.Selected(rsp.Header.Get(codec.HeaderProtocol)); selected != wire {
+		log.Printf("[Client] ⚠ Server does not accept %s, falling back to %s", wire.Name(), selected.Name())
+		wire = selected
+	}
+	if compressor != nil && compress.Negotiate(rsp.Header.Get(compress.HeaderSelected), []string{compressor.Name()}) == "" {
+		log.Printf("[Client] ⚠ Server does not accept %s compression, sending uncompressed", compressor.Name())
+		compressor = nil
+	}
+	log.Printf("[Client] ✅ Connected to server successfully (codec: %s, compression: %s)", wire.Name(), compressor.Name())
 
 	// Open a stream
 	log.Printf("[Client] Opening stream...")
@@ -91,56 +224,103 @@ func sendWebTransportPing(u *url.URL) error {
 	defer stream.Close()
 	log.Printf("[Client] ✅ Stream opened: %d", stream.StreamID())
 
-	// Create and send ping message
-	log.Printf("[Client] Creating ping message...")
-	message := model.NewPingMessage("Initial ping from client", 1, "client", "server")
-	log.Printf("[Client] Message created: %s (seq: %d)", message.Content, message.Sequence)
+	// Send the message
+	log.Printf("[Client] Message: %s (seq: %d)", message.Content, message.Sequence)
 
-	data, err := message.ToJSON()
+	data, err := wire.MarshalRequest(request.NewPingRequest(message))
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
-	_, err = stream.Write(data)
+	payload, err := compressor.EncodeFrame(data)
 	if err != nil {
+		return fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := transport.WriteFrame(stream, payload); err != nil {
 		return fmt.Errorf("failed to write to stream: %w", err)
 	}
-	log.Printf("[Client] ✅ Sent ping: %s (seq: %d)", message.Content, message.Sequence)
+	log.Printf("[Client] ✅ Sent %s: %s (seq: %d, %d bytes, %d on the wire)", message.Type, message.Content, message.Sequence, len(data), len(payload))
+	if attachment != nil {
+		if err := sendAttachment(stream, attachment); err != nil {
+			// The server may have rejected the message; its response explains why
+			log.Printf("[Client] ❌ Failed to send attachment: %v", err)
+		}
+	}
 
-	// Read response (one-shot)
-	buffer := make([]byte, 4096)
-	n, err := stream.Read(buffer)
+	// Read the response frame
+	frame, err := transport.ReadFrame(stream, maxResponseBytes)
 	if err != nil {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
-	response, err := model.FromJSON(buffer[:n])
+	if frame, err = compressor.DecodeFrame(frame, maxResponseBytes); err != nil {
+		return fmt.Errorf("failed to decompress response: %w", err)
+	}
+	response, err := wire.UnmarshalResponse(frame)
 	if err != nil {
 		return fmt.Errorf("failed to parse response: %w", err)
 	}
-	log.Printf("[Client] ✅ Received response: %s (seq: %d)", response.Content, response.Sequence)
+	if err := response.Err(); err != nil {
+		return fmt.Errorf("server rejected message: %w", err)
+	}
+	logReply("[Client] ✅", response, wire, len(frame))
 	return nil
 }
 
-func sendPlain(u *url.URL) error {
+// sendAttachment streams the attachment payload after its message in checksummed chunks
+func sendAttachment(stream io.Writer, attachment *attachmentSource) error {
+	payload, err := attachment.open()
+	if err != nil {
+		return err
+	}
+	defer payload.Close()
+	started := time.Now()
+	chunks := transport.NewChunkWriter(stream, attachment.desc.Chunk)
+	if _, err := io.CopyN(chunks, payload, attachment.desc.Size); err != nil {
+		return err
+	}
+	if err := chunks.Close(); err != nil {
+		return err
+	}
+	elapsed := time.Since(started)
+	log.Printf("[Client] ✅ Sent attachment: %d bytes in %s (%.1f MiB/s)", attachment.desc.Size, elapsed.Round(time.Millisecond), float64(attachment.desc.Size)/(1<<20)/elapsed.Seconds())
+	return nil
+}
+
+func sendPlain(u *url.URL, debug *transport.Debug, tlsConfig *tls.Config, authn *auth.Authenticator, message *model.Message, wire codec.Codec, compressor *compress.Compressor) error {
 	// Server listens with TLS only; auto-upgrade http -> https for /plain
 	if u.Scheme == "http" {
 		log.Printf("[Client] (plain) Upgrading scheme http -> https for TLS endpoint")
 		u.Scheme = "https"
 	}
 
-	// Build message
-	message := model.NewPingMessage("Initial ping from client (plain)", 1, "client", "server")
-	data, err := message.ToJSON()
+	data, err := wire.MarshalRequest(request.NewPingRequest(message))
 	if err != nil {
 		return fmt.Errorf("marshal message: %w", err)
 	}
+	compressed, err := compressor.Compress(data)
+	if err != nil {
+		return fmt.Errorf("compress message: %w", err)
+	}
+	if compressed != nil {
+		data = compressed
+	}
 
 	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("build request: %w", err)
 	}
-	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Type", wire.ContentType())
+	req.Header.Set("Accept", wire.ContentType())
+	if compressor != nil {
+		req.Header.Set("Accept-Encoding", compressor.Name())
+		if compressed != nil {
+			req.Header.Set("Content-Encoding", compressor.Name())
+		}
+	}
+	for key, values := range authn.Headers(http.MethodPost, u.Path, data) {
+		req.Header[key] = values
+	}
 
-	tr := &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	tr := &http.Transport{TLSClientConfig: debug.ApplyTLS(tlsConfig.Clone())}
 	client := &http.Client{Transport: tr}
 	log.Printf("[Client] (plain) POST %s", u.String())
 	resp, err := client.Do(req)
@@ -148,14 +328,43 @@ func sendPlain(u *url.URL) error {
 		return fmt.Errorf("request failed: %w", err)
 	}
 	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
 	log.Printf("[Client] (plain) Response: %s", resp.Status)
-	if len(body) > 0 {
-		if rmsg, perr := model.FromJSON(body); perr == nil {
-			log.Printf("[Client] (plain) Received response: %s (seq: %d)", rmsg.Content, rmsg.Sequence)
-		} else {
-			log.Printf("[Client] (plain) Body: %s", string(body))
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" && len(body) > 0 {
+		if body, err = compress.Decompress(encoding, body, maxResponseBytes); err != nil {
+			return fmt.Errorf("decompress response: %w", err)
+		}
+	}
+	replyCodec, ok := codec.ByContentType(resp.Header.Get("Content-Type"))
+	if !ok {
+		replyCodec = wire
+	}
+	reply, err := replyCodec.UnmarshalResponse(body)
+	if err != nil {
+		log.Printf("[Client] (plain) Body: %q", body)
+		if resp.StatusCode >= http.StatusBadRequest {
+			return fmt.Errorf("server rejected message: %s", resp.Status)
 		}
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	if err := reply.Err(); err != nil {
+		if reply.RetryAfter > 0 {
+			return fmt.Errorf("server rejected message: %s: %w (retry after %ds)", resp.Status, err, reply.RetryAfter)
+		}
+		return fmt.Errorf("server rejected message: %s: %w", resp.Status, err)
 	}
+	logReply("[Client] (plain)", reply, replyCodec, len(body))
 	return nil
 }
+
+// logReply logs the message of a successful response envelope
+func logReply(prefix string, reply *response.PingResponse, wire codec.Codec, size int) {
+	switch {
+	case reply.Message == nil:
+		log.Printf("%s Message already received, still being processed (duplicate)", prefix)
+	case reply.Duplicate:
+		log.Printf("%s Message already received, original %s response: %s (seq: %d, %s, %d bytes)", prefix, reply.Message.Type, reply.Message.Content, reply.Message.Sequence, wire.Name(), size)
+	default:
+		log.Printf("%s Received %s response: %s (seq: %d, %s, %d bytes)", prefix, reply.Message.Type, reply.Message.Content, reply.Message.Sequence, wire.Name(), size)
+	}
+}
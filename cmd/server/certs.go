@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/certs"
+)
+
+const certsUsage = `Usage: server certs <command> [flags]
+
+Commands:
+  ca           Create a local CA (ECDSA P-256)
+  leaf         Issue a CA-signed leaf certificate for localhost and extra hosts (creates the CA if missing)
+  short-lived  Create a self-signed certificate valid for at most 14 days and print its
+               serverCertificateHashes value, so browsers connect without trusting a CA
+  hash         Print the SHA-256 hash of an existing certificate
+
+Run "server certs <command> -h" for the flags of a command.
+`
+
+// runCerts implements the certs subcommand and returns the process exit code
+func runCerts(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, certsUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "ca":
+		err = certsCA(args[1:])
+	case "leaf":
+		err = certsLeaf(args[1:])
+	case "short-lived":
+		err = certsShortLived(args[1:])
+	case "hash":
+		err = certsHash(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, certsUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown certs command %q\n\n%s", args[0], certsUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "certs %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// certsCA creates the CA key pair
+func certsCA(args []string) error {
+	fs := flag.NewFlagSet("certs ca", flag.ContinueOnError)
+	dir := fs.String("dir", "certs", "Output directory")
+	days := fs.Int("days", 3650, "Validity in days")
+	force := fs.Bool("force", false, "Overwrite an existing CA")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	certFile, keyFile := filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key")
+	if !*force && fileExists(certFile) {
+		return fmt.Errorf("%s already exists (use -force to replace it)", certFile)
+	}
+	ca, err := certs.NewCA("Magic-Cylinder Local CA", daysToDuration(*days))
+	if err != nil {
+		return err
+	}
+	if err := ca.Write(certFile, keyFile); err != nil {
+		return err
+	}
+	fmt.Printf("CA certificate: %s\nCA key:         %s\nExpires:        %s\n", certFile, keyFile, ca.Cert.NotAfter.Format(time.RFC3339))
+	fmt.Printf("Trust %s in your OS or browser to accept leaf certificates issued by it.\n", certFile)
+	return nil
+}
+
+// certsLeaf issues a leaf certificate signed by the CA
+func certsLeaf(args []string) error {
+	fs := flag.NewFlagSet("certs leaf", flag.ContinueOnError)
+	dir := fs.String("dir", "certs", "Output directory (also holds ca.crt/ca.key)")
+	name := fs.String("name", "server", "Base name of the output files (<name>.crt, <name>.key) and common name")
+	hosts := fs.String("hosts", "", "Extra comma-separated DNS names or IPs (localhost, 127.0.0.1 and ::1 are always included)")
+	days := fs.Int("days", 365, "Validity in days")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	caCert, caKey := filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key")
+	var ca *certs.KeyPair
+	var err error
+	if fileExists(caCert) {
+		if ca, err = certs.Load(caCert, caKey); err != nil {
+			return err
+		}
+	} else {
+		if ca, err = certs.NewCA("Magic-Cylinder Local CA", daysToDuration(3650)); err != nil {
+			return err
+		}
+		if err := ca.Write(caCert, caKey); err != nil {
+			return err
+		}
+		fmt.Printf("Created CA:     %s\n", caCert)
+	}
+
+	leaf, err := ca.Issue(*name, hostList(*hosts), daysToDuration(*days))
+	if err != nil {
+		return err
+	}
+	return writeLeaf(leaf, *dir, *name)
+}
+
+// certsShortLived creates a self-signed certificate for serverCertificateHashes
+func certsShortLived(args []string) error {
+	fs := flag.NewFlagSet("certs short-lived", flag.ContinueOnError)
+	dir := fs.String("dir", "certs", "Output directory")
+	name := fs.String("name", "server", "Base name of the output files (<name>.crt, <name>.key) and common name")
+	hosts := fs.String("hosts", "", "Extra comma-separated DNS names or IPs (localhost, 127.0.0.1 and ::1 are always included)")
+	days := fs.Int("days", 14, "Validity in days (at most 14)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	leaf, err := certs.NewShortLived(*name, hostList(*hosts), daysToDuration(*days))
+	if err != nil {
+		return err
+	}
+	if err := writeLeaf(leaf, *dir, *name); err != nil {
+		return err
+	}
+	printHash(leaf.Cert)
+	return nil
+}
+
+// certsHash prints the serverCertificateHashes value of a certificate
+func certsHash(args []string) error {
+	fs := flag.NewFlagSet("certs hash", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: server certs hash <certificate.crt>")
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("expected exactly one certificate file")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	cert, err := certs.ParseCertificate(data)
+	if err != nil {
+		return err
+	}
+	printHash(cert)
+	if err := certs.HashCompatible(cert, time.Now()); err != nil {
+		fmt.Printf("Warning: browsers will reject this certificate for serverCertificateHashes: %v\n", err)
+	}
+	return nil
+}
+
+// writeLeaf writes a leaf key pair and prints where it went
+func writeLeaf(leaf *certs.KeyPair, dir, name string) error {
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := leaf.Write(certFile, keyFile); err != nil {
+		return err
+	}
+	sans := append([]string{}, leaf.Cert.DNSNames...)
+	for _, ip := range leaf.Cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	fmt.Printf("Certificate:    %s\nKey:            %s\nSANs:           %s\nExpires:        %s\n",
+		certFile, keyFile, strings.Join(sans, ", "), leaf.Cert.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// printHash prints the certificate hash in the formats accepted by the dashboard and browsers
+func printHash(cert *x509.Certificate) {
+	fmt.Printf("SHA-256 (hex):    %s\n", certs.FingerprintHex(cert))
+	fmt.Printf("SHA-256 (base64): %s\n", certs.FingerprintBase64(cert))
+	fmt.Printf("Browser option:   serverCertificateHashes: [{ algorithm: \"sha-256\", value: <bytes of the hash above> }]\n")
+}
+
+// hostList returns the default hosts plus the comma-separated extra hosts
+func hostList(extra string) []string {
+	hosts := append([]string{}, certs.DefaultHosts...)
+	for _, host := range strings.Split(extra, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// daysToDuration converts a number of days to a duration
+func daysToDuration(days int) time.Duration {
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// fileExists reports whether a file exists
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
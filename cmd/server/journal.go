@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/journal"
+)
+
+const journalUsage = `Usage: server journal <command> [flags]
+
+Commands:
+  analyze  Merge the journals of several servers and report chains, hop latency
+           percentiles, sequence gaps, duplicates, failures and throughput
+
+Run "server journal <command> -h" for the flags of a command.
+`
+
+// runJournal implements the journal subcommand and returns the process exit code
+func runJournal(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, journalUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "analyze":
+		err = journalAnalyze(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, journalUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown journal command %q\n\n%s", args[0], journalUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "journal %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// journalAnalyze reports on the merged journal files given as arguments
+func journalAnalyze(args []string) error {
+	fs := flag.NewFlagSet("journal analyze", flag.ContinueOnError)
+	format := fs.String("format", "table", "Output format: table or json")
+	bucket := fs.Duration("bucket", 10*time.Second, "Width of the throughput intervals")
+	chains := fs.Int("chains", 20, "Chains listed in the table, most problems first (0 for all; json lists all)")
+	rotated := fs.Bool("rotated", true, "Also read the rotated files (<file>.1, <file>.2, …) of each journal")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: server journal analyze [flags] <journal.jsonl>...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("expected at least one journal file")
+	}
+	if *format != "table" && *format != "json" {
+		return fmt.Errorf("unknown format %q (want table or json)", *format)
+	}
+	if *bucket <= 0 {
+		return fmt.Errorf("bucket must be positive (got %s)", *bucket)
+	}
+
+	files, err := journal.Files(fs.Args(), *rotated)
+	if err != nil {
+		return err
+	}
+	entries, skipped, err := journal.Read(files)
+	if err != nil {
+		return err
+	}
+	report := journal.Analyze(entries, *bucket)
+	report.Files, report.Skipped = files, skipped
+
+	if *format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.WriteTable(os.Stdout, *chains)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+)
+
+const keysUsage = `Usage: server keys <command> [flags]
+
+Commands:
+  generate  Create an Ed25519 message signing key pair (<name>.key and <name>.pub)
+  public    Print the base64 public key of a private key, for signing.peers
+
+Run "server keys <command> -h" for the flags of a command.
+`
+
+// runKeys implements the keys subcommand and returns the process exit code
+func runKeys(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, keysUsage)
+		return 2
+	}
+
+	var err error
+	switch args[0] {
+	case "generate":
+		err = keysGenerate(args[1:])
+	case "public":
+		err = keysPublic(args[1:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, keysUsage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown keys command %q\n\n%s", args[0], keysUsage)
+		return 2
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "keys %s: %v\n", args[0], err)
+		return 1
+	}
+	return 0
+}
+
+// keysGenerate creates a signing key pair
+func keysGenerate(args []string) error {
+	fs := flag.NewFlagSet("keys generate", flag.ContinueOnError)
+	dir := fs.String("dir", "keys", "Output directory")
+	name := fs.String("name", "server", "Key name; use the server name so peers can map it in signing.peers")
+	force := fs.Bool("force", false, "Overwrite an existing key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	keyFile := filepath.Join(*dir, *name+".key")
+	if !*force && fileExists(keyFile) {
+		return fmt.Errorf("%s already exists (use -force to replace it)", keyFile)
+	}
+	public, err := signing.GenerateKey(*dir, *name)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s and %s\n", keyFile, filepath.Join(*dir, *name+".pub"))
+	fmt.Printf("Public key (signing.peers.%s): %s\n", *name, signing.EncodePublicKey(public))
+	return nil
+}
+
+// keysPublic prints the public key of a private key file
+func keysPublic(args []string) error {
+	fs := flag.NewFlagSet("keys public", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("expected exactly one private key file")
+	}
+	signer, err := signing.NewSigner(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Println(signing.EncodePublicKey(signer.PublicKey()))
+	return nil
+}
@@ -2,41 +2,249 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/ryo-arima/magic-cylinder/internal"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
 	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/cors"
+	"github.com/ryo-arima/magic-cylinder/internal/logging"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
+// listFlag collects repeatable flags (-target, -pin); each value may also be a comma-separated list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
 func main() {
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "certs":
+			os.Exit(runCerts(os.Args[2:]))
+		case "keys":
+			os.Exit(runKeys(os.Args[2:]))
+		case "journal":
+			os.Exit(runJournal(os.Args[2:]))
+		}
+	}
+
 	// Parse command-line arguments
-	port := flag.String("port", "8443", "Server port")
+	configFile := flag.String("config", os.Getenv("MC_CONFIG"), "Config file (.yaml, .yml, .json or .toml; default $MC_CONFIG)")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration (defaults < file < MC_* env < flags) as YAML and exit")
+	port := flag.String("port", "8443", "Server port (overrides listen.address)")
 	name := flag.String("name", "server", "Server name")
-	targetURL := flag.String("target", "", "Target server URL for echo (e.g., https://localhost:8444/webtransport)")
+	var targets listFlag
+	flag.Var(&targets, "target", "Target server URL for echo, repeatable (e.g., https://localhost:8444/webtransport)")
 	delay := flag.Int("delay", 0, "Delay seconds before echoing to target (0 for no delay)")
+	keyLogFile := flag.String("keylog", "", "Append TLS session keys to this file for traffic decryption (default $SSLKEYLOGFILE)")
+	qlogDir := flag.String("qlog", "", "Write a qlog trace per QUIC connection into this directory (default $QLOGDIR)")
+	caFile := flag.String("ca", "", "CA bundle used to verify peer certificates when echoing (overrides tls.ca_file)")
+	var pins listFlag
+	flag.Var(&pins, "pin", "SHA-256 fingerprint (hex or base64) of an accepted peer certificate, repeatable (overrides tls.pins)")
+	insecure := flag.Bool("insecure", false, "Skip peer certificate verification when echoing (development only)")
+	clientAuth := flag.String("client-auth", "", "Client certificates on the listener: none, request or require (overrides tls.client_auth)")
+	var allowedPeers listFlag
+	flag.Var(&allowedPeers, "allow-peer", "Sender name allowed to join the chain, repeatable (overrides tls.allowed_peers)")
+	var allowedOrigins listFlag
+	flag.Var(&allowedOrigins, "allow-origin", "Browser origin allowed to use /webtransport and /plain, repeatable; * allows any (overrides cors.allowed_origins)")
+	signKey := flag.String("sign-key", "", "Ed25519 key signing emitted messages (overrides signing.key_file)")
+	signPolicy := flag.String("sign-policy", "", "Received message signatures: off, flag or reject (overrides signing.policy)")
+	echoCodec := flag.String("echo-codec", "", "Codec offered first when echoing: json, cbor, msgpack or protobuf (overrides encoding.echo)")
+	echoCompress := flag.String("echo-compress", "", "Compression offered when echoing: none, zstd or gzip (overrides compression.echo)")
+	statePath := flag.String("state", "", "bbolt file keeping sequence, chain and peer state across restarts (overrides state.path)")
+	journalPath := flag.String("journal", "", "Append every message received and sent to this JSONL file (overrides journal.path)")
+	adminAddr := flag.String("admin", "", "Admin listener address for pprof and runtime stats (e.g. :6060, binds to localhost when no host is given)")
 	flag.Parse()
 
-	log.Printf("=== %s Starting ===", *name)
-	log.Printf("[Main] Command-line arguments parsed:")
-	log.Printf("[Main]   - Port: %s", *port)
-	log.Printf("[Main]   - Name: %s", *name)
-	log.Printf("[Main]   - Target URL: %s", *targetURL)
-	log.Printf("[Main]   - Delay (s): %d", *delay)
+	// Initialize configuration: defaults, config file, environment, then explicit flags.
+	// The same steps run again on every reload so flags keep overriding the file.
+	loadConfig := func() (*config.ServerConfig, error) {
+		cfg, err := config.Load(*configFile)
+		if err != nil {
+			return nil, err
+		}
+		flag.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				cfg.Listen.Address = ":" + *port
+			case "name":
+				cfg.Name = *name
+			case "target":
+				cfg.Targets = targets
+			case "delay":
+				cfg.Delay = config.Duration(time.Duration(*delay) * time.Second)
+			case "keylog":
+				cfg.Transport.KeyLogFile = *keyLogFile
+			case "qlog":
+				cfg.Transport.QlogDir = *qlogDir
+			case "admin":
+				cfg.Listen.Admin = *adminAddr
+			case "ca":
+				cfg.TLS.CAFile = *caFile
+			case "pin":
+				cfg.TLS.Pins = pins
+			case "insecure":
+				cfg.TLS.Insecure = *insecure
+			case "client-auth":
+				cfg.TLS.ClientAuth = *clientAuth
+			case "allow-peer":
+				cfg.TLS.AllowedPeers = allowedPeers
+			case "allow-origin":
+				cfg.CORS.AllowedOrigins = allowedOrigins
+			case "sign-key":
+				cfg.Signing.KeyFile = *signKey
+			case "sign-policy":
+				cfg.Signing.Policy = *signPolicy
+			case "echo-codec":
+				cfg.Encoding.Echo = *echoCodec
+			case "echo-compress":
+				cfg.Compression.Echo = *echoCompress
+			case "state":
+				cfg.State.Path = *statePath
+			case "journal":
+				cfg.Journal.Path = *journalPath
+			}
+		})
+		return cfg, nil
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		log.Fatalf("[Main] Failed to load configuration: %v", err)
+	}
+	validationErr := cfg.Validate()
+
+	if *printConfig {
+		out, err := cfg.Render("yaml")
+		if err != nil {
+			log.Fatalf("[Main] Failed to render configuration: %v", err)
+		}
+		fmt.Print(string(out))
+		if validationErr != nil {
+			fmt.Fprintln(os.Stderr, validationErr)
+			os.Exit(1)
+		}
+		return
+	}
+	if validationErr != nil {
+		log.Fatalf("[Main] %v", validationErr)
+	}
+
+	if err := logging.Setup(cfg.Logging.Level, cfg.Logging.File, cfg.Logging.Microseconds); err != nil {
+		log.Fatalf("[Main] Failed to set up logging: %v", err)
+	}
+	defer logging.Close()
+
+	log.Printf("=== %s Starting ===", cfg.Name)
+	log.Printf("[Main] Configuration loaded:")
+	log.Printf("[Main]   - Config file: %s", *configFile)
+	log.Printf("[Main]   - Listen address: %s", cfg.Listen.Address)
+	log.Printf("[Main]   - Name: %s", cfg.Name)
+	log.Printf("[Main]   - Target URLs: %v", cfg.Targets)
+	for _, target := range cfg.Targets {
+		log.Printf("[Main]     %s echoes over %s (chosen by the path)", target, config.TargetTransport(target))
+	}
+	log.Printf("[Main]   - Delay: %s", cfg.Delay)
+	log.Printf("[Main]   - Key log file: %s", cfg.Transport.KeyLogFile)
+	log.Printf("[Main]   - qlog directory: %s", cfg.Transport.QlogDir)
+	log.Printf("[Main]   - Admin address: %s", cfg.Listen.Admin)
+	log.Printf("[Main]   - Log level: %s", cfg.Logging.Level)
+	log.Printf("[Main]   - Client certificates: %s (allowed peers: %v)", cfg.TLS.ClientAuth, cfg.TLS.AllowedPeers)
+	log.Printf("[Main]   - Codecs accepted: %v (json always), echoing with %s", cfg.Encoding.Accept, cfg.Encoding.Echo)
+	log.Printf("[Main]   - Compression accepted: %v, echoing with %s (threshold %d bytes)", cfg.Compression.Accept, cfg.Compression.Echo, cfg.Compression.Threshold)
+	log.Printf("[Main]   - Content strategy: %s (max length %d)", cfg.Content.Strategy, cfg.Content.MaxLength)
+	log.Printf("[Main]   - State file: %s (resume chains: %t, window %s, delay %s)", cfg.State.Path, cfg.State.Resume, cfg.State.ResumeWindow, cfg.State.ResumeDelay)
+	log.Printf("[Main]   - Journal: %s (rotated at %d bytes, %d backups)", cfg.Journal.Path, cfg.Journal.MaxBytes, cfg.Journal.MaxBackups)
+	log.Printf("[Main]   - Allowed browser origins: same origin + %v", cfg.CORS.AllowedOrigins)
+	if slices.Contains(cfg.CORS.AllowedOrigins, cors.AnyOrigin) {
+		log.Printf("[Main] ⚠ Any browser origin may drive this server (cors.allowed_origins contains *)")
+	}
+
+	log.Printf("[Main] Loading TLS certificates from %s and %s", cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	certStore, err := transport.NewCertificateStore(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		log.Fatalf("[Main] %v", err)
+	}
+	log.Printf("[Main] TLS certificates loaded successfully")
+
+	// The serving key pair doubles as client certificate when a target requests one
+	peerTLS := transport.ClientTLSOptions{CAFile: cfg.TLS.CAFile, Pins: cfg.TLS.Pins, Insecure: cfg.TLS.Insecure, Certificate: certStore}
+	clientTLS, err := transport.NewClientTLSConfig(peerTLS)
+	if err != nil {
+		log.Fatalf("[Main] Failed to set up peer certificate verification: %v", err)
+	}
+	if peerTLS.Insecure {
+		log.Printf("[Main] ⚠ Peer certificate verification is DISABLED (-insecure); targets can be impersonated")
+	} else {
+		log.Printf("[Main]   - Peer verification: %s", peerTLS.Mode())
+	}
+
+	authn, err := auth.New(cfg.Auth.Mode, cfg.Auth.Tokens, cfg.Auth.Token, cfg.Auth.MaxSkew.Std(), cfg.Auth.QueryToken)
+	if err != nil {
+		log.Fatalf("[Main] Failed to set up authentication: %v", err)
+	}
+	log.Printf("[Main]   - Authentication: %s (access_token query parameter: %t)", authn.Mode(), authn.QueryToken())
+	if authn.Mode() == auth.ModeBearer && !authn.QueryToken() {
+		log.Printf("[Main] ⚠ Browsers cannot send the bearer token to /events and /webtransport without auth.query_token; the dashboard will not connect")
+	}
+
+	signer, err := signing.NewSigner(cfg.Signing.KeyFile)
+	if err != nil {
+		log.Fatalf("[Main] Failed to load signing key: %v", err)
+	}
+	verifier, err := signing.NewVerifier(cfg.Signing.Policy, cfg.Signing.Peers)
+	if err != nil {
+		log.Fatalf("[Main] Failed to load peer signing keys: %v", err)
+	}
+	if signer != nil {
+		log.Printf("[Main]   - Message signing: %s (public key %s)", cfg.Signing.KeyFile, signing.EncodePublicKey(signer.PublicKey()))
+	} else {
+		log.Printf("[Main]   - Message signing: disabled")
+	}
+	log.Printf("[Main]   - Signature verification: %s (%d peer key(s))", verifier.Policy(), len(cfg.Signing.Peers))
 
-	// Initialize configuration and dependencies
-	log.Printf("[Main] Initializing server configuration...")
-	cfg := config.NewServerConfig(*port, *name, *targetURL)
-	log.Printf("[Main] Configuration created: Port=%s, Name=%s, Target=%s", cfg.Port, cfg.Name, cfg.TargetURL)
+	debug, err := transport.NewDebug(cfg.Transport.KeyLogFile, cfg.Transport.QlogDir, cfg.Name)
+	if err != nil {
+		log.Fatalf("[Main] Failed to set up QUIC/TLS debugging: %v", err)
+	}
+	defer debug.Close()
 
 	log.Printf("[Main] Initializing dependencies...")
-	router := internal.InitializeDependencies(*targetURL, *delay)
+	router := internal.InitializeDependencies(cfg, debug, clientTLS, authn, signer, verifier)
 
 	log.Printf("[Main] Creating server instance...")
-	server := internal.NewServer(cfg.Port, cfg.CertFile, cfg.KeyFile)
+	server := internal.NewServer(cfg, debug, certStore)
+	server.EnableReload(*configFile, func() (*config.ServerConfig, error) {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		return cfg, cfg.Validate()
+	})
 
 	// Start the server
-	log.Printf("[Main] Starting server %s...", *name)
+	log.Printf("[Main] Starting server %s...", cfg.Name)
 	if err := server.Start(router); err != nil {
+		debug.Close()
 		log.Fatalf("[Main] Server failed to start: %v", err)
 	}
 }
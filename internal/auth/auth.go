@@ -0,0 +1,241 @@
+// Package auth authenticates messages sent to /webtransport and /plain.
+//
+// Two schemes are supported:
+//
+//   - bearer: "Authorization: Bearer <token>". Browsers cannot set headers on a
+//     WebTransport session or an EventSource, so the token can be accepted as the
+//     access_token query parameter as well; this is opt-in, as URLs end up in
+//     logs and browser history.
+//   - hmac: X-MC-Timestamp (unix seconds), X-MC-Nonce and X-MC-Signature, the hex
+//     HMAC-SHA256 over "METHOD\nPATH\nTIMESTAMP\nNONCE\nhex(sha256(body))" keyed
+//     with a shared secret. The timestamp must be within the allowed clock skew
+//     and a nonce is accepted once while it is, so a request cannot be replayed.
+//
+// A nil *Authenticator is valid and accepts every request.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Authentication modes (auth.mode)
+const (
+	// ModeNone disables authentication
+	ModeNone = "none"
+	// ModeBearer checks a bearer token
+	ModeBearer = "bearer"
+	// ModeHMAC checks an HMAC-SHA256 request signature
+	ModeHMAC = "hmac"
+)
+
+// Header and query parameter names
+const (
+	HeaderTimestamp  = "X-MC-Timestamp"
+	HeaderNonce      = "X-MC-Nonce"
+	HeaderSignature  = "X-MC-Signature"
+	QueryAccessToken = "access_token"
+)
+
+// maxNonceLength is the longest accepted HMAC nonce
+const maxNonceLength = 64
+
+// maxNonces is how many HMAC nonces are remembered at most. Only correctly signed
+// requests add one; while the cache is full new requests are refused rather than
+// forgetting nonces that could still be replayed.
+const maxNonces = 1 << 18
+
+// ErrUnauthorized is returned (wrapped) for missing or invalid credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authenticator verifies incoming credentials and signs outgoing requests
+type Authenticator struct {
+	mode       string        // ModeBearer or ModeHMAC
+	accepted   [][]byte      // Accepted tokens or secrets (several allow rotation)
+	outgoing   []byte        // Token or secret used when echoing
+	maxSkew    time.Duration // Accepted clock difference for HMAC timestamps
+	queryToken bool          // Accept the bearer token as the access_token query parameter
+	mu         sync.Mutex
+	nonces     map[string]time.Time // HMAC nonces seen -> when their timestamp leaves the skew
+	swept      time.Time            // Last removal of expired nonces
+	now        func() time.Time
+}
+
+// New creates an authenticator. It returns nil for ModeNone.
+// An empty outgoing credential defaults to the first accepted one. With
+// queryToken, bearer tokens are also accepted as the access_token query parameter.
+func New(mode string, accepted []string, outgoing string, maxSkew time.Duration, queryToken bool) (*Authenticator, error) {
+	switch mode {
+	case ModeNone, "":
+		return nil, nil
+	case ModeBearer, ModeHMAC:
+	default:
+		return nil, fmt.Errorf("unknown auth mode %q", mode)
+	}
+	if len(accepted) == 0 {
+		return nil, fmt.Errorf("auth mode %s requires at least one token", mode)
+	}
+
+	a := &Authenticator{mode: mode, maxSkew: maxSkew, queryToken: queryToken, nonces: make(map[string]time.Time), now: time.Now}
+	for _, token := range accepted {
+		a.accepted = append(a.accepted, []byte(token))
+	}
+	a.outgoing = a.accepted[0]
+	if outgoing != "" {
+		a.outgoing = []byte(outgoing)
+	}
+	return a, nil
+}
+
+// Mode returns the authentication mode for log output
+func (a *Authenticator) Mode() string {
+	if a == nil {
+		return ModeNone
+	}
+	return a.mode
+}
+
+// Verify checks the credentials of an incoming request. Body is the request
+// body covered by an HMAC signature (nil for WebTransport CONNECT requests).
+func (a *Authenticator) Verify(r *http.Request, body []byte) error {
+	if a == nil {
+		return nil
+	}
+	if a.mode == ModeBearer {
+		return a.verifyBearer(r)
+	}
+	return a.verifyHMAC(r, body)
+}
+
+// Headers returns the credentials to attach to an outgoing request
+func (a *Authenticator) Headers(method, path string, body []byte) http.Header {
+	header := make(http.Header)
+	if a == nil {
+		return header
+	}
+	if a.mode == ModeBearer {
+		header.Set("Authorization", "Bearer "+string(a.outgoing))
+		return header
+	}
+	timestamp := strconv.FormatInt(a.now().Unix(), 10)
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	nonceHex := hex.EncodeToString(nonce)
+	header.Set(HeaderTimestamp, timestamp)
+	header.Set(HeaderNonce, nonceHex)
+	header.Set(HeaderSignature, hex.EncodeToString(sign(a.outgoing, method, path, timestamp, nonceHex, body)))
+	return header
+}
+
+// QueryToken reports whether bearer tokens are accepted as the access_token query parameter
+func (a *Authenticator) QueryToken() bool {
+	return a != nil && a.mode == ModeBearer && a.queryToken
+}
+
+// verifyBearer checks the Authorization header, or the access_token query
+// parameter when that is enabled
+func (a *Authenticator) verifyBearer(r *http.Request) error {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok && r.URL.Query().Has(QueryAccessToken) {
+		if !a.queryToken {
+			return fmt.Errorf("%w: %s query parameter is disabled (auth.query_token), use the Authorization header", ErrUnauthorized, QueryAccessToken)
+		}
+		token = r.URL.Query().Get(QueryAccessToken)
+	}
+	if token == "" {
+		return fmt.Errorf("%w: missing bearer token", ErrUnauthorized)
+	}
+	for _, accepted := range a.accepted {
+		if subtle.ConstantTimeCompare([]byte(token), accepted) == 1 {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: invalid bearer token", ErrUnauthorized)
+}
+
+// verifyHMAC checks the timestamp, nonce and signature headers
+func (a *Authenticator) verifyHMAC(r *http.Request, body []byte) error {
+	timestamp := r.Header.Get(HeaderTimestamp)
+	nonce := r.Header.Get(HeaderNonce)
+	signature := r.Header.Get(HeaderSignature)
+	if timestamp == "" || nonce == "" || signature == "" {
+		return fmt.Errorf("%w: missing %s, %s or %s header", ErrUnauthorized, HeaderTimestamp, HeaderNonce, HeaderSignature)
+	}
+	if len(nonce) > maxNonceLength {
+		return fmt.Errorf("%w: nonce longer than %d characters", ErrUnauthorized, maxNonceLength)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp %q", ErrUnauthorized, timestamp)
+	}
+	signed := time.Unix(seconds, 0)
+	if skew := a.now().Sub(signed); math.Abs(float64(skew)) > float64(a.maxSkew) {
+		return fmt.Errorf("%w: timestamp outside the allowed skew of %s (off by %s)", ErrUnauthorized, a.maxSkew, skew.Round(time.Second))
+	}
+	mac, err := hex.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("%w: signature is not hex", ErrUnauthorized)
+	}
+	for _, secret := range a.accepted {
+		if hmac.Equal(mac, sign(secret, r.Method, r.URL.Path, timestamp, nonce, body)) {
+			return a.useNonce(nonce, signed.Add(a.maxSkew))
+		}
+	}
+	return fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+}
+
+// useNonce records the nonce of a correctly signed request until expiry, when its
+// timestamp is refused anyway, and fails if it was already used
+func (a *Authenticator) useNonce(nonce string, expiry time.Time) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	if now.Sub(a.swept) >= a.maxSkew {
+		for seen, until := range a.nonces {
+			if now.After(until) {
+				delete(a.nonces, seen)
+			}
+		}
+		a.swept = now
+	}
+	if until, ok := a.nonces[nonce]; ok && !now.After(until) {
+		return fmt.Errorf("%w: nonce already used (replayed request)", ErrUnauthorized)
+	}
+	if len(a.nonces) >= maxNonces {
+		return fmt.Errorf("%w: too many recent requests to remember their nonces", ErrUnauthorized)
+	}
+	a.nonces[nonce] = expiry
+	return nil
+}
+
+// sign computes the HMAC-SHA256 over the canonical request
+func sign(secret []byte, method, path, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s\n%s\n%s", method, path, timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+	return mac.Sum(nil)
+}
+
+// RedactURL returns the URL for log output with the access token removed
+func RedactURL(u *url.URL) string {
+	query := u.Query()
+	if !query.Has(QueryAccessToken) {
+		return u.String()
+	}
+	query.Set(QueryAccessToken, "REDACTED")
+	redacted := *u
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// canonicalSignature signs a request the way the package doc describes, independently of sign
+func canonicalSignature(secret, method, path, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHMAC(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	body := []byte(`{"header":{"version":1}}`)
+	ts := func(offset time.Duration) string { return strconv.FormatInt(now.Add(offset).Unix(), 10) }
+
+	tests := []struct {
+		name      string
+		method    string // Of the verified request (POST /plain unless set)
+		path      string
+		body      []byte
+		timestamp string
+		nonce     string // "n1" unless set; "-" for none
+		signature string // Empty for none; "sign" for the canonical signature of the request
+		secret    string // Secret of the canonical signature
+		wantErr   bool
+	}{
+		{name: "valid", timestamp: ts(0), signature: "sign", secret: "secret-a"},
+		{name: "second accepted secret", timestamp: ts(0), signature: "sign", secret: "secret-b"},
+		{name: "empty body", body: []byte{}, timestamp: ts(0), signature: "sign", secret: "secret-a"},
+		{name: "timestamp at the skew limit", timestamp: ts(-30 * time.Second), signature: "sign", secret: "secret-a"},
+		{name: "timestamp in the future within skew", timestamp: ts(30 * time.Second), signature: "sign", secret: "secret-a"},
+		{name: "timestamp too old", timestamp: ts(-31 * time.Second), signature: "sign", secret: "secret-a", wantErr: true},
+		{name: "timestamp too far ahead", timestamp: ts(time.Minute), signature: "sign", secret: "secret-a", wantErr: true},
+		{name: "unknown secret", timestamp: ts(0), signature: "sign", secret: "secret-c", wantErr: true},
+		{name: "missing timestamp", signature: "sign", secret: "secret-a", wantErr: true},
+		{name: "missing signature", timestamp: ts(0), wantErr: true},
+		{name: "timestamp not a number", timestamp: "yesterday", signature: "sign", secret: "secret-a", wantErr: true},
+		{name: "signature not hex", timestamp: ts(0), signature: "not-hex", wantErr: true},
+		{name: "signature of another timestamp", timestamp: ts(0), signature: canonicalSignature("secret-a", "POST", "/plain", ts(-1), "n1", body), wantErr: true},
+		{name: "signature of another method", method: "PUT", timestamp: ts(0), signature: canonicalSignature("secret-a", "POST", "/plain", ts(0), "n1", body), wantErr: true},
+		{name: "signature of another path", path: "/webtransport", timestamp: ts(0), signature: canonicalSignature("secret-a", "POST", "/plain", ts(0), "n1", body), wantErr: true},
+		{name: "signature of another body", body: []byte(`{}`), timestamp: ts(0), signature: canonicalSignature("secret-a", "POST", "/plain", ts(0), "n1", body), wantErr: true},
+		{name: "signature of another nonce", nonce: "n2", timestamp: ts(0), signature: canonicalSignature("secret-a", "POST", "/plain", ts(0), "n1", body), wantErr: true},
+		{name: "missing nonce", nonce: "-", timestamp: ts(0), signature: "sign", secret: "secret-a", wantErr: true},
+		{name: "nonce too long", nonce: strings.Repeat("n", 65), timestamp: ts(0), signature: "sign", secret: "secret-a", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(ModeHMAC, []string{"secret-a", "secret-b"}, "", 30*time.Second, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.now = func() time.Time { return now }
+			method, path, reqBody := "POST", "/plain", body
+			if tt.method != "" {
+				method = tt.method
+			}
+			if tt.path != "" {
+				path = tt.path
+			}
+			if tt.body != nil {
+				reqBody = tt.body
+			}
+			nonce := "n1"
+			switch tt.nonce {
+			case "-":
+				nonce = ""
+			case "":
+			default:
+				nonce = tt.nonce
+			}
+			signature := tt.signature
+			if signature == "sign" {
+				signature = canonicalSignature(tt.secret, method, path, tt.timestamp, nonce, reqBody)
+			}
+			r := httptest.NewRequest(method, "https://localhost:8443"+path, nil)
+			if tt.timestamp != "" {
+				r.Header.Set(HeaderTimestamp, tt.timestamp)
+			}
+			if nonce != "" {
+				r.Header.Set(HeaderNonce, nonce)
+			}
+			if signature != "" {
+				r.Header.Set(HeaderSignature, signature)
+			}
+
+			err = a.Verify(r, reqBody)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Fatalf("Verify() = %v, want ErrUnauthorized", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify() = %v", err)
+			}
+		})
+	}
+}
+
+func TestHeadersVerify(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	tests := []struct {
+		name     string
+		mode     string
+		outgoing string
+		wantErr  bool
+	}{
+		{name: "hmac", mode: ModeHMAC},
+		{name: "hmac with the second secret", mode: ModeHMAC, outgoing: "secret-b"},
+		{name: "hmac with an unknown secret", mode: ModeHMAC, outgoing: "secret-c", wantErr: true},
+		{name: "bearer", mode: ModeBearer},
+		{name: "bearer with an unknown token", mode: ModeBearer, outgoing: "secret-c", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender, err := New(tt.mode, []string{"secret-a", "secret-b"}, tt.outgoing, 30*time.Second, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			receiver, err := New(tt.mode, []string{"secret-a", "secret-b"}, "", 30*time.Second, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sender.now = func() time.Time { return now }
+			receiver.now = func() time.Time { return now.Add(5 * time.Second) }
+
+			body := []byte("ping")
+			r := httptest.NewRequest(http.MethodPost, "https://localhost:8443/plain", nil)
+			r.Header = sender.Headers(http.MethodPost, "/plain", body)
+			err = receiver.Verify(r, body)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Verify() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyBearer(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		query      string
+		queryToken bool // auth.query_token
+		wantErr    bool
+	}{
+		{name: "header", header: "Bearer token-a"},
+		{name: "second accepted token", header: "Bearer token-b"},
+		{name: "query parameter when enabled", query: "token-a", queryToken: true},
+		{name: "query parameter when disabled", query: "token-a", wantErr: true},
+		{name: "header with a disabled query parameter", header: "Bearer token-a", query: "token-c"},
+		{name: "unknown query token", query: "token-c", queryToken: true, wantErr: true},
+		{name: "unknown token", header: "Bearer token-c", wantErr: true},
+		{name: "other scheme", header: "Basic dG9rZW4tYQ==", wantErr: true},
+		{name: "missing", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := New(ModeBearer, []string{"token-a", "token-b"}, "", 0, tt.queryToken)
+			if err != nil {
+				t.Fatal(err)
+			}
+			target := "https://localhost:8443/webtransport"
+			if tt.query != "" {
+				target += "?" + QueryAccessToken + "=" + url.QueryEscape(tt.query)
+			}
+			r := httptest.NewRequest(http.MethodConnect, target, nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			err = a.Verify(r, nil)
+			if tt.wantErr != errors.Is(err, ErrUnauthorized) || (!tt.wantErr && err != nil) {
+				t.Fatalf("Verify() = %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHMACNonceReplay(t *testing.T) {
+	now := time.Unix(1760000000, 0)
+	a, err := New(ModeHMAC, []string{"secret-a"}, "", 30*time.Second, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.now = func() time.Time { return now }
+	body := []byte("ping")
+	request := func(timestamp time.Time, nonce string) *http.Request {
+		ts := strconv.FormatInt(timestamp.Unix(), 10)
+		r := httptest.NewRequest(http.MethodPost, "https://localhost:8443/plain", nil)
+		r.Header.Set(HeaderTimestamp, ts)
+		r.Header.Set(HeaderNonce, nonce)
+		r.Header.Set(HeaderSignature, canonicalSignature("secret-a", http.MethodPost, "/plain", ts, nonce, body))
+		return r
+	}
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		timestamp time.Duration // Relative to the current time
+		nonce     string
+		wantErr   bool
+	}{
+		{name: "first use", nonce: "n1"},
+		{name: "replayed", nonce: "n1", wantErr: true},
+		{name: "same nonce with a new timestamp", advance: 10 * time.Second, nonce: "n1", wantErr: true},
+		{name: "another nonce", nonce: "n2"},
+		{name: "replayed once the timestamp left the skew", advance: 25 * time.Second, timestamp: -35 * time.Second, nonce: "n1", wantErr: true},
+		{name: "nonce reused after it expired", advance: 30 * time.Second, nonce: "n1"},
+	}
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		err := a.Verify(request(now.Add(s.timestamp), s.nonce), body)
+		if s.wantErr != (err != nil) || (err != nil && !errors.Is(err, ErrUnauthorized)) {
+			t.Fatalf("%s: Verify() = %v, want error %t", s.name, err, s.wantErr)
+		}
+	}
+	if len(a.nonces) != 1 {
+		t.Errorf("%d nonces remembered, want 1 (the expired ones swept)", len(a.nonces))
+	}
+
+	// Headers signs every request with a fresh nonce
+	sender, _ := New(ModeHMAC, []string{"secret-a"}, "", 30*time.Second, false)
+	sender.now = a.now
+	first, second := sender.Headers(http.MethodPost, "/plain", body), sender.Headers(http.MethodPost, "/plain", body)
+	if first.Get(HeaderNonce) == "" || first.Get(HeaderNonce) == second.Get(HeaderNonce) {
+		t.Errorf("Headers() nonces %q and %q, want distinct ones", first.Get(HeaderNonce), second.Get(HeaderNonce))
+	}
+}
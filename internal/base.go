@@ -2,87 +2,245 @@ package internal
 
 import (
 	"context"
-	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
 	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/certs"
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
 // Server represents a WebTransport server instance
 type Server struct {
 	server     *webtransport.Server
 	httpServer *http.Server
-	port       string
-	certFile   string
-	keyFile    string
+	adminHTTP  *http.Server     // Optional diagnostics listener (pprof, runtime stats)
+	addr       string           // TCP and UDP listen address
+	port       string           // Port part of addr, used for log output
+	adminAddr  string           // Admin listener address, empty to disable
+	quicConfig *quic.Config     // QUIC options for the HTTP/3 listener
+	debug      *transport.Debug // Optional TLS key log / qlog output
+
+	cfg        *config.ServerConfig        // Configuration currently applied
+	certs      *transport.CertificateStore // Serving key pair, swapped on reload
+	router     *Router                     // Router receiving reloaded targets and delay
+	configFile string                      // Config file watched for changes (may be empty)
+	loader     ConfigLoader                // Reloads the configuration, nil disables reload
+	reloadCh   chan string                 // Reload requests from the file watcher
+	mu         sync.Mutex                  // Guards cfg between reloads and the file watcher
 }
 
-// NewServer creates a new WebTransport server
-func NewServer(port, certFile, keyFile string) *Server {
+// NewServer creates a new WebTransport server serving the key pair held by certStore.
+// The same store presents the client certificate when echoing (mutual TLS).
+func NewServer(cfg *config.ServerConfig, debug *transport.Debug, certStore *transport.CertificateStore) *Server {
+	_, port, _ := net.SplitHostPort(cfg.Listen.Address)
 	return &Server{
-		port:     port,
-		certFile: certFile,
-		keyFile:  keyFile,
+		addr:       cfg.Listen.Address,
+		port:       port,
+		adminAddr:  cfg.Listen.Admin,
+		quicConfig: transport.NewQUICConfig(cfg.Transport.MaxIdleTimeout.Std(), cfg.Transport.KeepAlivePeriod.Std()),
+		debug:      debug,
+		cfg:        cfg,
+		certs:      certStore,
+		reloadCh:   make(chan string, 1),
 	}
 }
 
 // Start starts the WebTransport server with the given router
 func (s *Server) Start(router *Router) error {
-	log.Printf("[Server] Loading TLS certificates from %s and %s", s.certFile, s.keyFile)
-	cert, err := tls.LoadX509KeyPair(s.certFile, s.keyFile)
-	if err != nil {
-		return fmt.Errorf("failed to load TLS certificate: %w", err)
-	}
-	log.Printf("[Server] TLS certificates loaded successfully")
+	s.router = router
+	defer func() {
+		if err := router.Close(); err != nil {
+			log.Printf("[Server] Failed to save the sequence number or close the state file or journal: %v", err)
+		}
+	}()
 
-	tlsConfig := &tls.Config{
-		Certificates: []tls.Certificate{cert},
+	// GetCertificate (rather than Certificates) lets a reload apply to new handshakes
+	log.Printf("[Server] Configuring TLS (client certificates: %s)", s.cfg.TLS.ClientAuth)
+	tlsConfig, err := transport.NewServerTLSConfig(s.certs, transport.ServerTLSOptions{
+		ClientAuth:   s.cfg.TLS.ClientAuth,
+		ClientCAFile: s.cfg.TLS.ClientCA(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure TLS: %w", err)
 	}
+	tlsConfig = s.debug.ApplyTLS(tlsConfig)
 
 	log.Printf("[Server] Initializing WebTransport server")
-	s.server = &webtransport.Server{}
+	s.server = &webtransport.Server{
+		H3: http3.Server{
+			Addr:       s.addr,
+			TLSConfig:  http3.ConfigureTLSConfig(tlsConfig),
+			QUICConfig: s.debug.ApplyQUIC(s.quicConfig),
+		},
+		CheckOrigin: router.origins.CheckOrigin,
+	}
 
 	log.Printf("[Server] Setting up routes")
-	router.SetupRoutes(s.server)
+	mux := router.SetupRoutes(s.server)
+	s.server.H3.Handler = mux
 
 	s.httpServer = &http.Server{
-		Addr:      ":" + s.port,
+		Addr:      s.addr,
+		Handler:   mux,
 		TLSConfig: tlsConfig,
 	}
 
 	log.Printf("[Server] =====================================")
-	log.Printf("[Server] Server starting on port %s", s.port)
+	log.Printf("[Server] Server starting on %s", s.addr)
 	log.Printf("[Server] WebTransport endpoint: https://localhost:%s/webtransport", s.port)
 	log.Printf("[Server] Health check endpoint: https://localhost:%s/health", s.port)
+	log.Printf("[Server] Liveness/readiness endpoints: https://localhost:%s/livez, https://localhost:%s/readyz", s.port, s.port)
+	log.Printf("[Server] Dashboard: https://localhost:%s/dashboard/", s.port)
 	log.Printf("[Server] =====================================")
 
+	health := router.healthRepository
+	health.SetCertificate(s.certs.Leaf())
+	logCertificateHash(s.certs.Leaf())
+
+	addr := s.addr
+	log.Printf("[Server] Starting HTTPS (TCP) listener on %s", addr)
+	tcpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		health.SetListener("tcp", addr, err)
+		return fmt.Errorf("failed to listen on tcp %s: %w", addr, err)
+	}
+	health.SetListener("tcp", tcpListener.Addr().String(), nil)
+
+	log.Printf("[Server] Starting HTTP/3 (UDP) listener on %s", addr)
+	udpConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		tcpListener.Close()
+		health.SetListener("udp", addr, err)
+		return fmt.Errorf("failed to listen on udp %s: %w", addr, err)
+	}
+	health.SetListener("udp", udpConn.LocalAddr().String(), nil)
+
 	go func() {
-		log.Printf("[Server] Starting HTTPS/HTTP3 listener on :%s", s.port)
-		if err := s.httpServer.ListenAndServeTLS(s.certFile, s.keyFile); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("[Server] Server failed to start: %v", err)
+		if err := s.httpServer.ServeTLS(tcpListener, "", ""); err != nil && err != http.ErrServerClosed {
+			log.Printf("[Server] ❌ HTTPS (TCP) listener stopped: %v", err)
+			health.SetListener("tcp", tcpListener.Addr().String(), err)
 		}
 	}()
 
+	go func() {
+		if err := s.server.Serve(udpConn); err != nil && err != http.ErrServerClosed {
+			log.Printf("[Server] ❌ HTTP/3 (UDP) listener stopped: %v", err)
+			health.SetListener("udp", udpConn.LocalAddr().String(), err)
+		}
+	}()
+
+	if s.adminAddr != "" {
+		if err := s.startAdmin(router); err != nil {
+			return err
+		}
+	}
+
+	go router.ResumeChains()
+
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	if s.loader != nil && s.cfg.Reload.WatchInterval > 0 {
+		go s.watchFiles(s.cfg.Reload.WatchInterval.Std(), stopWatch)
+	}
+
 	return s.waitForShutdown()
 }
 
-// waitForShutdown waits for interrupt signal and gracefully shuts down the server
+// logCertificateHash logs the serverCertificateHashes value when browsers can pin the certificate
+func logCertificateHash(leaf *x509.Certificate) {
+	if err := certs.HashCompatible(leaf, time.Now()); err != nil {
+		log.Printf("[Server] Certificate not usable with serverCertificateHashes (%v); browsers must trust its CA", err)
+		return
+	}
+	log.Printf("[Server] Certificate SHA-256 for serverCertificateHashes: %s", certs.FingerprintHex(leaf))
+}
+
+// startAdmin starts the diagnostics listener. A bare port (":6060" or "6060")
+// binds to localhost so pprof is never exposed on public interfaces by accident.
+func (s *Server) startAdmin(router *Router) error {
+	addr := s.adminAddr
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid admin address %q: %w", s.adminAddr, err)
+	}
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr = net.JoinHostPort(host, port)
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		log.Printf("[Server] ⚠ Admin listener on non-loopback address %s exposes pprof and goroutine dumps", addr)
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on admin address %s: %w", addr, err)
+	}
+	s.adminHTTP = &http.Server{
+		Addr:    addr,
+		Handler: router.SetupAdminRoutes(),
+	}
+
+	log.Printf("[Server] Admin endpoints: http://%s/debug/pprof/, /debug/goroutines, /debug/runtime", listener.Addr())
+	go func() {
+		if err := s.adminHTTP.Serve(listener); err != nil && err != http.ErrServerClosed {
+			log.Printf("[Server] ❌ Admin listener stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// waitForShutdown waits for interrupt signal and gracefully shuts down the server.
+// SIGHUP and file watcher notifications reload the configuration in between.
 func (s *Server) waitForShutdown() error {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+wait:
+	for {
+		select {
+		case <-quit:
+			break wait
+		case <-hup:
+			s.reload("SIGHUP")
+		case reason := <-s.reloadCh:
+			s.reload(reason)
+		}
+	}
 
 	log.Printf("[Server] Shutdown signal received, initiating graceful shutdown...")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
+	if err := s.server.Close(); err != nil {
+		log.Printf("[Server] HTTP/3 listener close error: %v", err)
+	}
+
+	if s.adminHTTP != nil {
+		if err := s.adminHTTP.Shutdown(ctx); err != nil {
+			log.Printf("[Server] Admin listener shutdown error: %v", err)
+		}
+	}
+
 	if err := s.httpServer.Shutdown(ctx); err != nil {
 		log.Printf("[Server] Forced shutdown due to error: %v", err)
 		return fmt.Errorf("server forced to shutdown: %w", err)
@@ -0,0 +1,262 @@
+// Package certs creates the ECDSA certificates used by the servers: a local CA,
+// CA-signed leaf certificates, and short-lived self-signed certificates that
+// browsers accept through WebTransport serverCertificateHashes without trusting a CA.
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MaxHashValidity is the longest validity browsers accept for certificates
+// pinned with serverCertificateHashes
+const MaxHashValidity = 14 * 24 * time.Hour
+
+// DefaultHosts are the SANs every leaf certificate includes
+var DefaultHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// KeyPair is a certificate with its ECDSA private key
+type KeyPair struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewCA creates a self-signed CA certificate that may only sign leaf certificates
+func NewCA(commonName string, validity time.Duration) (*KeyPair, error) {
+	template, err := newTemplate(commonName, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.MaxPathLenZero = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	return create(template, nil)
+}
+
+// Issue creates a leaf certificate for the given hosts signed by the CA
+func (ca *KeyPair) Issue(commonName string, hosts []string, validity time.Duration) (*KeyPair, error) {
+	if !ca.Cert.IsCA {
+		return nil, errors.New("issuer is not a CA certificate")
+	}
+	template, err := newLeafTemplate(commonName, hosts, validity)
+	if err != nil {
+		return nil, err
+	}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	return create(template, ca)
+}
+
+// NewShortLived creates a self-signed leaf certificate usable with serverCertificateHashes.
+// The validity must not exceed MaxHashValidity.
+func NewShortLived(commonName string, hosts []string, validity time.Duration) (*KeyPair, error) {
+	if validity > MaxHashValidity {
+		return nil, fmt.Errorf("validity %s exceeds the %s allowed for serverCertificateHashes", validity, MaxHashValidity)
+	}
+	template, err := newLeafTemplate(commonName, hosts, validity)
+	if err != nil {
+		return nil, err
+	}
+	return create(template, nil)
+}
+
+// Load reads a PEM certificate and PKCS#8 or SEC 1 ECDSA key
+func Load(certFile, keyFile string) (*KeyPair, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	cert, err := ParseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", certFile, err)
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %w", err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM block found", keyFile)
+	}
+	var key *ecdsa.PrivateKey
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+		var ok bool
+		if key, ok = parsed.(*ecdsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("%s: not an ECDSA key", keyFile)
+		}
+	case "EC PRIVATE KEY":
+		if key, err = x509.ParseECPrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("%s: %w", keyFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s: unsupported key type %q", keyFile, block.Type)
+	}
+	return &KeyPair{Cert: cert, Key: key}, nil
+}
+
+// ParseCertificate decodes the first PEM certificate
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// Write stores the certificate and key as PEM files (the key readable by the owner only)
+func (kp *KeyPair) Write(certFile, keyFile string) error {
+	keyDER, err := x509.MarshalPKCS8PrivateKey(kp.Key)
+	if err != nil {
+		return fmt.Errorf("failed to encode key: %w", err)
+	}
+	for _, path := range []string{certFile, keyFile} {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: kp.Cert.Raw})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write certificate: %w", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write key: %w", err)
+	}
+	return nil
+}
+
+// Fingerprint returns the SHA-256 hash of the DER certificate, the value
+// expected by serverCertificateHashes
+func Fingerprint(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.Raw)
+}
+
+// FingerprintHex returns the fingerprint as lowercase hex
+func FingerprintHex(cert *x509.Certificate) string {
+	sum := Fingerprint(cert)
+	return hex.EncodeToString(sum[:])
+}
+
+// FingerprintBase64 returns the fingerprint as standard base64
+func FingerprintBase64(cert *x509.Certificate) string {
+	sum := Fingerprint(cert)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// ParseFingerprint decodes a SHA-256 fingerprint given as hex (optionally
+// colon-separated, as printed by openssl) or standard base64
+func ParseFingerprint(s string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	s = strings.TrimSpace(s)
+	decoded, err := hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	if err != nil || len(decoded) != sha256.Size {
+		decoded, err = base64.StdEncoding.DecodeString(s)
+	}
+	if err != nil || len(decoded) != sha256.Size {
+		return sum, fmt.Errorf("invalid SHA-256 fingerprint %q (expected 64 hex characters or 44 base64 characters)", s)
+	}
+	copy(sum[:], decoded)
+	return sum, nil
+}
+
+// HashCompatible reports why a certificate cannot be used with serverCertificateHashes,
+// or nil if it can (ECDSA key, validity of at most 14 days, currently valid)
+func HashCompatible(cert *x509.Certificate, now time.Time) error {
+	if _, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok {
+		return errors.New("key is not ECDSA")
+	}
+	if validity := cert.NotAfter.Sub(cert.NotBefore); validity > MaxHashValidity {
+		return fmt.Errorf("validity %s exceeds %s", validity.Round(time.Hour), MaxHashValidity)
+	}
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return errors.New("certificate is not currently valid")
+	}
+	return nil
+}
+
+// newTemplate returns a certificate template with a random serial number.
+// NotBefore is backdated slightly to tolerate clock skew.
+func newTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	if validity <= 0 {
+		return nil, fmt.Errorf("validity must be positive (got %s)", validity)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"Magic-Cylinder"},
+			CommonName:   commonName,
+		},
+		NotBefore: now.Add(-time.Minute),
+		NotAfter:  now.Add(validity - time.Minute),
+	}, nil
+}
+
+// newLeafTemplate returns a template for a server and client leaf certificate
+func newLeafTemplate(commonName string, hosts []string, validity time.Duration) (*x509.Certificate, error) {
+	template, err := newTemplate(commonName, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	if len(template.DNSNames) == 0 && len(template.IPAddresses) == 0 {
+		return nil, errors.New("at least one host is required")
+	}
+	return template, nil
+}
+
+// create generates a P-256 key and signs the template (self-signed when issuer is nil)
+func create(template *x509.Certificate, issuer *KeyPair) (*KeyPair, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.Cert, issuer.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+	return &KeyPair{Cert: cert, Key: key}, nil
+}
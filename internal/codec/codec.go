@@ -0,0 +1,159 @@
+// Package codec encodes the request and response envelopes on the wire. JSON is the default; CBOR,
+// MessagePack and Protobuf are negotiated per WebTransport session
+// (WT-Available-Protocols / WT-Protocol headers) or per /plain request
+// (Content-Type and Accept).
+package codec
+
+import (
+	"mime"
+	"slices"
+	"strings"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+)
+
+// Negotiation headers of a WebTransport CONNECT request and its response.
+// Values are structured-field lists of strings, e.g. `"cbor", "json"`.
+const (
+	HeaderAvailableProtocols = "WT-Available-Protocols"
+	HeaderProtocol           = "WT-Protocol"
+)
+
+// Codec encodes and decodes the envelopes in one wire format
+type Codec interface {
+	// Name is the protocol name used in negotiation and configuration
+	Name() string
+	// ContentType is the media type on /plain requests and responses
+	ContentType() string
+	// MarshalRequest encodes a request envelope
+	MarshalRequest(req *request.PingRequest) ([]byte, error)
+	// UnmarshalRequest decodes and validates a request envelope; unknown fields are
+	// rejected (model.ErrInvalidMessage or model.ErrUnsupportedVersion is wrapped)
+	UnmarshalRequest(data []byte) (*request.PingRequest, error)
+	// MarshalResponse encodes a response envelope
+	MarshalResponse(resp *response.PingResponse) ([]byte, error)
+	// UnmarshalResponse decodes and validates a response envelope like UnmarshalRequest
+	UnmarshalResponse(data []byte) (*response.PingResponse, error)
+}
+
+// Supported codecs
+var (
+	JSON     Codec = jsonCodec{}
+	CBOR     Codec = newCBORCodec()
+	MsgPack  Codec = msgpackCodec{}
+	Protobuf Codec = protobufCodec{}
+)
+
+// all lists the codecs in their default order of preference
+var all = []Codec{JSON, CBOR, MsgPack, Protobuf}
+
+// Names returns the names of all supported codecs
+func Names() []string {
+	names := make([]string, 0, len(all))
+	for _, c := range all {
+		names = append(names, c.Name())
+	}
+	return names
+}
+
+// ByName returns the codec with the given name
+func ByName(name string) (Codec, bool) {
+	for _, c := range all {
+		if c.Name() == name {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// ByContentType returns the codec for a Content-Type or Accept media type.
+// An empty media type selects JSON.
+func ByContentType(contentType string) (Codec, bool) {
+	if strings.TrimSpace(contentType) == "" {
+		return JSON, true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, false
+	}
+	switch mediaType {
+	case "application/json":
+		return JSON, true
+	case "application/cbor":
+		return CBOR, true
+	case "application/msgpack", "application/vnd.msgpack", "application/x-msgpack":
+		return MsgPack, true
+	case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+		return Protobuf, true
+	}
+	return nil, false
+}
+
+// Negotiate picks the first protocol offered by the client (a WT-Available-Protocols
+// value) that is accepted by the server. JSON is the fallback when nothing was
+// offered or none of the offered protocols is accepted.
+func Negotiate(offered string, accepted []string) Codec {
+	for _, name := range ParseList(offered) {
+		if c, ok := Accepted(name, accepted); ok {
+			return c
+		}
+	}
+	return JSON
+}
+
+// Accepted returns the codec with the given name if it is in the accepted list.
+// JSON is always accepted.
+func Accepted(name string, accepted []string) (Codec, bool) {
+	c, ok := ByName(name)
+	if !ok || (c != JSON && !slices.Contains(accepted, name)) {
+		return nil, false
+	}
+	return c, true
+}
+
+// Selected returns the codec chosen by the server in a WT-Protocol response header
+// (JSON when the header is missing or names an unknown codec)
+func Selected(value string) Codec {
+	for _, name := range ParseList(value) {
+		if c, ok := ByName(name); ok {
+			return c
+		}
+	}
+	return JSON
+}
+
+// FromAccept returns the first media type of an Accept header that names an
+// accepted codec (q-values are ignored; list the preferred type first)
+func FromAccept(value string, accepted []string) (Codec, bool) {
+	for _, mediaType := range strings.Split(value, ",") {
+		if c, ok := ByContentType(mediaType); ok && strings.TrimSpace(mediaType) != "" {
+			if _, ok := Accepted(c.Name(), accepted); ok {
+				return c, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// FormatList encodes protocol names as a structured-field list of strings
+func FormatList(names ...string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = `"` + name + `"`
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// ParseList decodes a structured-field list of strings (bare tokens are accepted too)
+func ParseList(value string) []string {
+	var names []string
+	for _, item := range strings.Split(value, ",") {
+		// Drop parameters (;key=value) and the quotes of sf-strings
+		item, _, _ = strings.Cut(item, ";")
+		if item = strings.Trim(strings.TrimSpace(item), `"`); item != "" {
+			names = append(names, item)
+		}
+	}
+	return names
+}
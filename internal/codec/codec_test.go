@@ -0,0 +1,220 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// testMessage returns a message with every field set
+func testMessage() *model.Message {
+	return &model.Message{
+		ID: "9f2c", Nonce: "a1b2", Type: model.PongMessage, Content: "Pong response to: héllo",
+		Timestamp: time.Date(2026, 10, 18, 9, 30, 0, 123456789, time.UTC), Sequence: 42,
+		From: "server1", To: "server2", Chain: "3c7d", Hop: 7, Signature: "c2ln",
+	}
+}
+
+// sameMessage compares messages with the timestamps compared as instants, as
+// the codecs do not keep the location
+func sameMessage(got, want *model.Message) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	if !got.Timestamp.Equal(want.Timestamp) {
+		return false
+	}
+	g, w := *got, *want
+	g.Timestamp, w.Timestamp = time.Time{}, time.Time{}
+	return g == w
+}
+
+func TestRoundTrip(t *testing.T) {
+	requests := []struct {
+		name string
+		req  *request.PingRequest
+	}{
+		{name: "full request", req: request.NewPingRequest(testMessage())},
+		{name: "minimal request", req: request.NewPingRequest(&model.Message{Type: model.PingMessage, Timestamp: time.Unix(1760000000, 0), From: "client"})},
+	}
+	responses := []struct {
+		name string
+		resp *response.PingResponse
+	}{
+		{name: "reply", resp: response.NewPingResponse(testMessage())},
+		{name: "pending duplicate", resp: &response.PingResponse{Header: model.NewHeader(), Success: true, Duplicate: true}},
+		{name: "rate limited", resp: &response.PingResponse{Header: model.NewHeader(), Code: response.CodeRateLimited, Error: "chain rate limit exceeded", RetryAfter: 2}},
+	}
+
+	for _, c := range all {
+		for _, tt := range requests {
+			t.Run(c.Name()+"/"+tt.name, func(t *testing.T) {
+				data, err := c.MarshalRequest(tt.req)
+				if err != nil {
+					t.Fatalf("MarshalRequest() = %v", err)
+				}
+				got, err := c.UnmarshalRequest(data)
+				if err != nil {
+					t.Fatalf("UnmarshalRequest() = %v", err)
+				}
+				if got.Header != tt.req.Header || !sameMessage(got.Message, tt.req.Message) {
+					t.Fatalf("round trip:\n got %+v %+v\nwant %+v %+v", got.Header, got.Message, tt.req.Header, tt.req.Message)
+				}
+				// Signatures cover the fields, so they must survive every codec
+				if !bytes.Equal(got.Message.SigningBytes(), tt.req.Message.SigningBytes()) {
+					t.Error("signing bytes changed in the round trip")
+				}
+			})
+		}
+		for _, tt := range responses {
+			t.Run(c.Name()+"/"+tt.name, func(t *testing.T) {
+				data, err := c.MarshalResponse(tt.resp)
+				if err != nil {
+					t.Fatalf("MarshalResponse() = %v", err)
+				}
+				got, err := c.UnmarshalResponse(data)
+				if err != nil {
+					t.Fatalf("UnmarshalResponse() = %v", err)
+				}
+				if !sameMessage(got.Message, tt.resp.Message) {
+					t.Fatalf("round trip message:\n got %+v\nwant %+v", got.Message, tt.resp.Message)
+				}
+				g, w := *got, *tt.resp
+				g.Message, w.Message = nil, nil
+				if !reflect.DeepEqual(g, w) {
+					t.Fatalf("round trip:\n got %+v\nwant %+v", g, w)
+				}
+			})
+		}
+	}
+}
+
+// requestWithExtra is a request envelope with a field the codecs do not know
+type requestWithExtra struct {
+	Header  model.Header `json:"header"`
+	Message any          `json:"message"`
+	Extra   string       `json:"extra,omitempty"`
+}
+
+// messageWithExtra is a message with a field the codecs do not know
+type messageWithExtra struct {
+	model.Message
+	Extra string `json:"extra"`
+}
+
+func TestUnknownFieldsRejected(t *testing.T) {
+	encoders := map[string]func(v any) ([]byte, error){
+		"json":    json.Marshal,
+		"cbor":    CBOR.(cborCodec).enc.Marshal,
+		"msgpack": marshalMsgpack,
+	}
+	tests := []struct {
+		name  string
+		value requestWithExtra
+	}{
+		{name: "envelope field", value: requestWithExtra{Header: model.NewHeader(), Message: testMessage(), Extra: "x"}},
+		{name: "message field", value: requestWithExtra{Header: model.NewHeader(), Message: messageWithExtra{Message: *testMessage(), Extra: "x"}}},
+	}
+	for name, encode := range encoders {
+		c, _ := ByName(name)
+		// The same envelope without the extra field must decode, or the test proves nothing
+		valid, err := encode(requestWithExtra{Header: model.NewHeader(), Message: testMessage()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.UnmarshalRequest(valid); err != nil {
+			t.Fatalf("%s: envelope without extra fields rejected: %v", name, err)
+		}
+		for _, tt := range tests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				data, err := encode(tt.value)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.UnmarshalRequest(data); !errors.Is(err, model.ErrInvalidMessage) {
+					t.Fatalf("UnmarshalRequest() = %v, want ErrInvalidMessage", err)
+				}
+			})
+		}
+	}
+
+	// Protobuf: an unknown field number at each level
+	extra := protowire.AppendTag(nil, 99, protowire.VarintType)
+	extra = protowire.AppendVarint(extra, 1)
+	header := protowire.AppendTag(nil, pbVersion, protowire.VarintType)
+	header = protowire.AppendVarint(header, protowire.EncodeZigZag(model.ProtocolVersion))
+	message := marshalProtobuf(testMessage())
+	envelope := func(header, message []byte) []byte {
+		b := protowire.AppendTag(nil, pbEnvelopeHeader, protowire.BytesType)
+		b = protowire.AppendBytes(b, header)
+		b = protowire.AppendTag(b, pbEnvelopeMessage, protowire.BytesType)
+		return protowire.AppendBytes(b, message)
+	}
+	if _, err := Protobuf.UnmarshalRequest(envelope(header, message)); err != nil {
+		t.Fatalf("protobuf: envelope without extra fields rejected: %v", err)
+	}
+	protobufTests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "envelope field", data: append(envelope(header, message), extra...)},
+		{name: "header field", data: envelope(append(header, extra...), message)},
+		{name: "message field", data: envelope(header, append(message, extra...))},
+	}
+	for _, tt := range protobufTests {
+		t.Run("protobuf/"+tt.name, func(t *testing.T) {
+			if _, err := Protobuf.UnmarshalRequest(tt.data); !errors.Is(err, model.ErrInvalidMessage) {
+				t.Fatalf("UnmarshalRequest() = %v, want ErrInvalidMessage", err)
+			}
+		})
+	}
+}
+
+func TestUnmarshalRejectsInvalidEnvelopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     *request.PingRequest
+		wantErr error
+	}{
+		{name: "newer version", req: &request.PingRequest{Header: model.Header{Version: model.ProtocolVersion + 1}, Message: testMessage()}, wantErr: model.ErrUnsupportedVersion},
+		{name: "missing version", req: &request.PingRequest{Message: testMessage()}, wantErr: model.ErrUnsupportedVersion},
+		{name: "missing message", req: &request.PingRequest{Header: model.NewHeader()}, wantErr: model.ErrInvalidMessage},
+		{name: "missing sender", req: request.NewPingRequest(&model.Message{Type: model.PingMessage, Timestamp: time.Now()}), wantErr: model.ErrInvalidMessage},
+		{name: "negative hop", req: request.NewPingRequest(&model.Message{Type: model.PingMessage, Timestamp: time.Now(), From: "client", Hop: -1}), wantErr: model.ErrInvalidMessage},
+		{name: "invalid type", req: request.NewPingRequest(&model.Message{Type: "Ping!", Timestamp: time.Now(), From: "client"}), wantErr: model.ErrInvalidMessage},
+	}
+	for _, c := range all {
+		for _, tt := range tests {
+			t.Run(c.Name()+"/"+tt.name, func(t *testing.T) {
+				data, err := c.MarshalRequest(tt.req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if _, err := c.UnmarshalRequest(data); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("UnmarshalRequest() = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+
+	t.Run("json/trailing data", func(t *testing.T) {
+		data, _ := JSON.MarshalRequest(request.NewPingRequest(testMessage()))
+		if _, err := JSON.UnmarshalRequest(append(data, []byte(`{}`)...)); !errors.Is(err, model.ErrInvalidMessage) {
+			t.Fatalf("UnmarshalRequest() = %v, want ErrInvalidMessage", err)
+		}
+	})
+	t.Run("protobuf/truncated", func(t *testing.T) {
+		data, _ := Protobuf.MarshalRequest(request.NewPingRequest(testMessage()))
+		if _, err := Protobuf.UnmarshalRequest(data[:len(data)-3]); !errors.Is(err, model.ErrInvalidMessage) {
+			t.Fatalf("UnmarshalRequest() = %v, want ErrInvalidMessage", err)
+		}
+	})
+}
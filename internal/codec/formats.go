@@ -0,0 +1,155 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// jsonCodec is the default text format (JSON tags of the entities)
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+
+func (jsonCodec) MarshalRequest(req *request.PingRequest) ([]byte, error) {
+	return json.Marshal(req)
+}
+
+func (jsonCodec) UnmarshalRequest(data []byte) (*request.PingRequest, error) {
+	var req request.PingRequest
+	if err := decodeJSON(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, req.Validate()
+}
+
+func (jsonCodec) MarshalResponse(resp *response.PingResponse) ([]byte, error) {
+	return json.Marshal(resp)
+}
+
+func (jsonCodec) UnmarshalResponse(data []byte) (*response.PingResponse, error) {
+	var resp response.PingResponse
+	if err := decodeJSON(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, resp.Validate()
+}
+
+// decodeJSON decodes a single JSON value, rejecting unknown fields and trailing data
+func decodeJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	if decoder.More() {
+		return fmt.Errorf("%w: unexpected data after the JSON object", model.ErrInvalidMessage)
+	}
+	return nil
+}
+
+// cborCodec encodes RFC 8949 CBOR maps keyed like the JSON fields.
+// Timestamps are RFC 3339 strings with nanoseconds so signatures still verify.
+type cborCodec struct {
+	enc cbor.EncMode
+	dec cbor.DecMode
+}
+
+func newCBORCodec() cborCodec {
+	enc, err := cbor.EncOptions{Time: cbor.TimeRFC3339Nano}.EncMode()
+	if err != nil {
+		panic(err)
+	}
+	dec, err := cbor.DecOptions{ExtraReturnErrors: cbor.ExtraDecErrorUnknownField}.DecMode()
+	if err != nil {
+		panic(err)
+	}
+	return cborCodec{enc: enc, dec: dec}
+}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+
+func (c cborCodec) MarshalRequest(req *request.PingRequest) ([]byte, error) {
+	return c.enc.Marshal(req)
+}
+
+func (c cborCodec) UnmarshalRequest(data []byte) (*request.PingRequest, error) {
+	var req request.PingRequest
+	if err := c.dec.Unmarshal(data, &req); err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	return &req, req.Validate()
+}
+
+func (c cborCodec) MarshalResponse(resp *response.PingResponse) ([]byte, error) {
+	return c.enc.Marshal(resp)
+}
+
+func (c cborCodec) UnmarshalResponse(data []byte) (*response.PingResponse, error) {
+	var resp response.PingResponse
+	if err := c.dec.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	return &resp, resp.Validate()
+}
+
+// msgpackCodec encodes MessagePack maps keyed like the JSON fields
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+func (msgpackCodec) MarshalRequest(req *request.PingRequest) ([]byte, error) {
+	return marshalMsgpack(req)
+}
+
+func (msgpackCodec) UnmarshalRequest(data []byte) (*request.PingRequest, error) {
+	var req request.PingRequest
+	if err := unmarshalMsgpack(data, &req); err != nil {
+		return nil, err
+	}
+	return &req, req.Validate()
+}
+
+func (msgpackCodec) MarshalResponse(resp *response.PingResponse) ([]byte, error) {
+	return marshalMsgpack(resp)
+}
+
+func (msgpackCodec) UnmarshalResponse(data []byte) (*response.PingResponse, error) {
+	var resp response.PingResponse
+	if err := unmarshalMsgpack(data, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, resp.Validate()
+}
+
+// marshalMsgpack encodes an envelope with the JSON field names and compact integers
+func marshalMsgpack(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unmarshalMsgpack decodes an envelope, rejecting unknown fields
+func unmarshalMsgpack(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	return nil
+}
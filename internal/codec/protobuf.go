@@ -0,0 +1,311 @@
+package codec
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufCodec encodes the envelopes by hand with the wire format of the schema
+// in magic_cylinder.proto (timestamps in Unix nanoseconds, retry_after in seconds).
+// Unknown fields are rejected like in the other codecs.
+type protobufCodec struct{}
+
+// Protobuf field numbers of Message
+const (
+	pbID protowire.Number = iota + 1
+	pbNonce
+	pbType
+	pbContent
+	pbTimestamp
+	pbSequence
+	pbFrom
+	pbTo
+	pbChain
+	pbSignature
+	pbHop
+)
+
+// Protobuf field numbers of Header, PingRequest and PingResponse
+const (
+	pbVersion protowire.Number = 1
+
+	pbEnvelopeHeader  protowire.Number = 1
+	pbEnvelopeMessage protowire.Number = 2
+	pbSuccess         protowire.Number = 3
+	pbError           protowire.Number = 4
+	pbCode            protowire.Number = 5
+	pbRetryAfter      protowire.Number = 6
+	pbDuplicate       protowire.Number = 7
+)
+
+func (protobufCodec) Name() string        { return "protobuf" }
+func (protobufCodec) ContentType() string { return "application/x-protobuf" }
+
+func (protobufCodec) MarshalRequest(req *request.PingRequest) ([]byte, error) {
+	b := appendProtobufHeader(nil, req.Header)
+	if req.Message != nil {
+		b = protowire.AppendTag(b, pbEnvelopeMessage, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtobuf(req.Message))
+	}
+	return b, nil
+}
+
+func (protobufCodec) UnmarshalRequest(data []byte) (*request.PingRequest, error) {
+	req := &request.PingRequest{}
+	err := consumeProtobuf(data, func(num protowire.Number, typ protowire.Type, value []byte, _ uint64) error {
+		switch num {
+		case pbEnvelopeHeader:
+			return unmarshalProtobufHeader(typ, value, &req.Header)
+		case pbEnvelopeMessage:
+			return unmarshalProtobufMessage(typ, value, &req.Message)
+		}
+		return fmt.Errorf("unknown field %d", num)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	return req, req.Validate()
+}
+
+func (protobufCodec) MarshalResponse(resp *response.PingResponse) ([]byte, error) {
+	b := appendProtobufHeader(nil, resp.Header)
+	if resp.Message != nil {
+		b = protowire.AppendTag(b, pbEnvelopeMessage, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalProtobuf(resp.Message))
+	}
+	appendBool := func(num protowire.Number, value bool) {
+		if value {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, 1)
+		}
+	}
+	appendBool(pbSuccess, resp.Success)
+	for _, field := range []struct {
+		num   protowire.Number
+		value string
+	}{{pbError, resp.Error}, {pbCode, resp.Code}} {
+		if field.value != "" {
+			b = protowire.AppendTag(b, field.num, protowire.BytesType)
+			b = protowire.AppendString(b, field.value)
+		}
+	}
+	if resp.RetryAfter != 0 {
+		b = protowire.AppendTag(b, pbRetryAfter, protowire.VarintType)
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(resp.RetryAfter)))
+	}
+	appendBool(pbDuplicate, resp.Duplicate)
+	return b, nil
+}
+
+func (protobufCodec) UnmarshalResponse(data []byte) (*response.PingResponse, error) {
+	resp := &response.PingResponse{}
+	err := consumeProtobuf(data, func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error {
+		switch num {
+		case pbEnvelopeHeader:
+			return unmarshalProtobufHeader(typ, value, &resp.Header)
+		case pbEnvelopeMessage:
+			return unmarshalProtobufMessage(typ, value, &resp.Message)
+		case pbSuccess, pbDuplicate, pbRetryAfter:
+			if typ != protowire.VarintType {
+				return fmt.Errorf("field %d: wire type %d, want varint", num, typ)
+			}
+			switch num {
+			case pbSuccess:
+				resp.Success = varint != 0
+			case pbDuplicate:
+				resp.Duplicate = varint != 0
+			default:
+				resp.RetryAfter = int(protowire.DecodeZigZag(varint))
+			}
+			return nil
+		case pbError, pbCode:
+			if typ != protowire.BytesType {
+				return fmt.Errorf("field %d: wire type %d, want bytes", num, typ)
+			}
+			if num == pbError {
+				resp.Error = string(value)
+			} else {
+				resp.Code = string(value)
+			}
+			return nil
+		}
+		return fmt.Errorf("unknown field %d", num)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", model.ErrInvalidMessage, err)
+	}
+	return resp, resp.Validate()
+}
+
+// appendProtobufHeader appends the header field of an envelope
+func appendProtobufHeader(b []byte, header model.Header) []byte {
+	var h []byte
+	if header.Version != 0 {
+		h = protowire.AppendTag(h, pbVersion, protowire.VarintType)
+		h = protowire.AppendVarint(h, protowire.EncodeZigZag(int64(header.Version)))
+	}
+	b = protowire.AppendTag(b, pbEnvelopeHeader, protowire.BytesType)
+	return protowire.AppendBytes(b, h)
+}
+
+// unmarshalProtobufHeader decodes the header field of an envelope
+func unmarshalProtobufHeader(typ protowire.Type, value []byte, header *model.Header) error {
+	if typ != protowire.BytesType {
+		return fmt.Errorf("header: wire type %d, want bytes", typ)
+	}
+	return consumeProtobuf(value, func(num protowire.Number, typ protowire.Type, _ []byte, varint uint64) error {
+		if num != pbVersion || typ != protowire.VarintType {
+			return fmt.Errorf("header: unknown field %d", num)
+		}
+		header.Version = int(protowire.DecodeZigZag(varint))
+		return nil
+	})
+}
+
+// unmarshalProtobufMessage decodes the message field of an envelope
+func unmarshalProtobufMessage(typ protowire.Type, value []byte, message **model.Message) error {
+	if typ != protowire.BytesType {
+		return fmt.Errorf("message: wire type %d, want bytes", typ)
+	}
+	decoded, err := unmarshalProtobuf(value)
+	if err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+	*message = decoded
+	return nil
+}
+
+// consumeProtobuf calls fn with each field of data: the payload of a bytes field or
+// the value of a varint field (other wire types are rejected)
+func consumeProtobuf(data []byte, fn func(num protowire.Number, typ protowire.Type, value []byte, varint uint64) error) error {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		var value []byte
+		var varint uint64
+		switch typ {
+		case protowire.BytesType:
+			value, n = protowire.ConsumeBytes(data)
+		case protowire.VarintType:
+			varint, n = protowire.ConsumeVarint(data)
+		default:
+			return fmt.Errorf("field %d: unsupported wire type %d", num, typ)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		data = data[n:]
+		if err := fn(num, typ, value, varint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// marshalProtobuf encodes the fields of a Message
+func marshalProtobuf(message *model.Message) []byte {
+	var b []byte
+	appendString := func(num protowire.Number, value string) {
+		if value != "" {
+			b = protowire.AppendTag(b, num, protowire.BytesType)
+			b = protowire.AppendString(b, value)
+		}
+	}
+	appendInt := func(num protowire.Number, value int64) {
+		if value != 0 {
+			b = protowire.AppendTag(b, num, protowire.VarintType)
+			b = protowire.AppendVarint(b, protowire.EncodeZigZag(value))
+		}
+	}
+
+	appendString(pbID, message.ID)
+	appendString(pbNonce, message.Nonce)
+	appendString(pbType, string(message.Type))
+	appendString(pbContent, message.Content)
+	if !message.Timestamp.IsZero() {
+		appendInt(pbTimestamp, message.Timestamp.UnixNano())
+	}
+	appendInt(pbSequence, int64(message.Sequence))
+	appendString(pbFrom, message.From)
+	appendString(pbTo, message.To)
+	appendString(pbChain, message.Chain)
+	appendString(pbSignature, message.Signature)
+	appendInt(pbHop, int64(message.Hop))
+	return b
+}
+
+// unmarshalProtobuf decodes the fields of a Message
+func unmarshalProtobuf(data []byte) (*model.Message, error) {
+	message := &model.Message{}
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch num {
+		case pbTimestamp, pbSequence, pbHop:
+			if typ != protowire.VarintType {
+				return nil, fmt.Errorf("field %d: wire type %d, want varint", num, typ)
+			}
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			value := protowire.DecodeZigZag(v)
+			switch num {
+			case pbTimestamp:
+				message.Timestamp = time.Unix(0, value)
+			case pbSequence:
+				message.Sequence = int(value)
+			default:
+				message.Hop = int(value)
+			}
+		case pbID, pbNonce, pbType, pbContent, pbFrom, pbTo, pbChain, pbSignature:
+			if typ != protowire.BytesType {
+				return nil, fmt.Errorf("field %d: wire type %d, want bytes", num, typ)
+			}
+			v, n := protowire.ConsumeString(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			*protobufStringField(message, num) = v
+		default:
+			return nil, fmt.Errorf("unknown field %d", num)
+		}
+	}
+	return message, nil
+}
+
+// protobufStringField returns the string field of a message for a field number
+func protobufStringField(message *model.Message, num protowire.Number) *string {
+	switch num {
+	case pbID:
+		return &message.ID
+	case pbNonce:
+		return &message.Nonce
+	case pbType:
+		return (*string)(&message.Type)
+	case pbContent:
+		return &message.Content
+	case pbFrom:
+		return &message.From
+	case pbTo:
+		return &message.To
+	case pbChain:
+		return &message.Chain
+	default:
+		return &message.Signature
+	}
+}
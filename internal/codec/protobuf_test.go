@@ -0,0 +1,192 @@
+package codec
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	protoComment = regexp.MustCompile(`//[^\n]*`)
+	protoPackage = regexp.MustCompile(`package\s+([\w.]+)\s*;`)
+	protoMessage = regexp.MustCompile(`message\s+(\w+)\s*\{([^}]*)\}`)
+	protoField   = regexp.MustCompile(`(\w+)\s+(\w+)\s*=\s*(\d+)\s*;`)
+)
+
+// protoScalars maps the scalar types used by the schema to descriptor types
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"string": descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"sint64": descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"bool":   descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+}
+
+// loadSchema parses magic_cylinder.proto into descriptors. Only the subset the
+// schema uses is understood: flat messages of scalar and message fields.
+func loadSchema(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+	data, err := os.ReadFile("magic_cylinder.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	src := protoComment.ReplaceAllString(string(data), "")
+	pkg := protoPackage.FindStringSubmatch(src)
+	if pkg == nil {
+		t.Fatal("magic_cylinder.proto: no package")
+	}
+	file := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("magic_cylinder.proto"),
+		Package: proto.String(pkg[1]),
+		Syntax:  proto.String("proto3"),
+	}
+	for _, m := range protoMessage.FindAllStringSubmatch(src, -1) {
+		message := &descriptorpb.DescriptorProto{Name: proto.String(m[1])}
+		for _, f := range protoField.FindAllStringSubmatch(m[2], -1) {
+			number, _ := strconv.Atoi(f[3])
+			field := &descriptorpb.FieldDescriptorProto{
+				Name:     proto.String(f[2]),
+				JsonName: proto.String(f[2]),
+				Number:   proto.Int32(int32(number)),
+				Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			}
+			if typ, ok := protoScalars[f[1]]; ok {
+				field.Type = typ.Enum()
+			} else {
+				field.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+				field.TypeName = proto.String("." + pkg[1] + "." + f[1])
+			}
+			message.Field = append(message.Field, field)
+		}
+		file.MessageType = append(file.MessageType, message)
+	}
+	fd, err := protodesc.NewFile(file, nil)
+	if err != nil {
+		t.Fatalf("magic_cylinder.proto: %v", err)
+	}
+	return fd
+}
+
+// newDynamic builds a message of the schema from field values (string, int64,
+// bool or a nested message) keyed by field name
+func newDynamic(t *testing.T, md protoreflect.MessageDescriptor, fields map[string]any) *dynamicpb.Message {
+	t.Helper()
+	m := dynamicpb.NewMessage(md)
+	for name, value := range fields {
+		fd := md.Fields().ByName(protoreflect.Name(name))
+		if fd == nil {
+			t.Fatalf("%s has no field %q", md.Name(), name)
+		}
+		m.Set(fd, protoreflect.ValueOf(value))
+	}
+	return m
+}
+
+func TestProtobufMatchesSchema(t *testing.T) {
+	schema := loadSchema(t).Messages()
+	header := func(version int64) *dynamicpb.Message {
+		return newDynamic(t, schema.ByName("Header"), map[string]any{"version": version})
+	}
+	timestamp := time.Unix(0, 1760000000123456789)
+	full := &model.Message{
+		ID: "9f2c", Nonce: "a1b2", Type: model.PongMessage, Content: "Pong response to: hello",
+		Timestamp: timestamp, Sequence: 42, From: "server1", To: "server2", Chain: "3c7d", Signature: "c2ln", Hop: 7,
+	}
+	fullProto := newDynamic(t, schema.ByName("Message"), map[string]any{
+		"id": "9f2c", "nonce": "a1b2", "type": "pong", "content": "Pong response to: hello",
+		"timestamp": timestamp.UnixNano(), "sequence": int64(42), "from": "server1", "to": "server2",
+		"chain": "3c7d", "signature": "c2ln", "hop": int64(7),
+	})
+	minimal := &model.Message{Type: model.PingMessage, Timestamp: timestamp, From: "client"}
+	minimalProto := newDynamic(t, schema.ByName("Message"), map[string]any{
+		"type": "ping", "timestamp": timestamp.UnixNano(), "from": "client",
+	})
+
+	tests := []struct {
+		name   string
+		schema string // Message of the schema the envelope is encoded as
+		value  any    // *request.PingRequest or *response.PingResponse
+		want   map[string]any
+	}{
+		{
+			name:   "request with every message field",
+			schema: "PingRequest",
+			value:  &request.PingRequest{Header: model.Header{Version: 1}, Message: full},
+			want:   map[string]any{"header": header(1), "message": fullProto},
+		},
+		{
+			name:   "request with the required message fields",
+			schema: "PingRequest",
+			value:  &request.PingRequest{Header: model.Header{Version: 1}, Message: minimal},
+			want:   map[string]any{"header": header(1), "message": minimalProto},
+		},
+		{
+			name:   "duplicate response",
+			schema: "PingResponse",
+			value:  &response.PingResponse{Header: model.Header{Version: 1}, Message: full, Success: true, Duplicate: true},
+			want:   map[string]any{"header": header(1), "message": fullProto, "success": true, "duplicate": true},
+		},
+		{
+			name:   "rate limited response",
+			schema: "PingResponse",
+			value:  &response.PingResponse{Header: model.Header{Version: 1}, Error: "chain rate limit exceeded", Code: response.CodeRateLimited, RetryAfter: 3},
+			want: map[string]any{"header": header(1), "error": "chain rate limit exceeded",
+				"code": string(response.CodeRateLimited), "retry_after": int64(3)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := newDynamic(t, schema.ByName(protoreflect.Name(tt.schema)), tt.want)
+
+			// Codec to schema: every field decodes to the field of the same number and type
+			var encoded []byte
+			var err error
+			switch value := tt.value.(type) {
+			case *request.PingRequest:
+				encoded, err = Protobuf.MarshalRequest(value)
+			case *response.PingResponse:
+				encoded, err = Protobuf.MarshalResponse(value)
+			}
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			got := dynamicpb.NewMessage(want.Descriptor())
+			if err := proto.Unmarshal(encoded, got); err != nil {
+				t.Fatalf("decode with the schema: %v", err)
+			}
+			if !proto.Equal(got, want) {
+				t.Errorf("decoded with the schema:\n got %v\nwant %v", got, want)
+			}
+
+			// Schema to codec: an encoding made from the schema decodes to the same envelope
+			fromSchema, err := proto.Marshal(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded any
+			switch tt.value.(type) {
+			case *request.PingRequest:
+				decoded, err = Protobuf.UnmarshalRequest(fromSchema)
+			case *response.PingResponse:
+				decoded, err = Protobuf.UnmarshalResponse(fromSchema)
+			}
+			if err != nil {
+				t.Fatalf("unmarshal the schema encoding: %v", err)
+			}
+			if !reflect.DeepEqual(decoded, tt.value) {
+				t.Errorf("unmarshaled the schema encoding:\n got %+v\nwant %+v", decoded, tt.value)
+			}
+		})
+	}
+}
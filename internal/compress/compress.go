@@ -0,0 +1,193 @@
+// Package compress implements the optional zstd/gzip compression of message payloads.
+// WebTransport peers negotiate an algorithm per session (X-MC-Accept-Compression /
+// X-MC-Compression headers); every frame of such a session starts with a marker byte
+// telling whether the rest is compressed. /plain uses Content-Encoding and Accept-Encoding.
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported algorithms
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+// Algorithms lists the supported compression algorithms
+var Algorithms = []string{Zstd, Gzip}
+
+// Negotiation headers of a WebTransport CONNECT request and its response
+const (
+	HeaderAccept   = "X-MC-Accept-Compression"
+	HeaderSelected = "X-MC-Compression"
+)
+
+// Frame markers, the first byte of every frame of a session with compression
+const (
+	markerRaw  byte = 0x0
+	markerGzip byte = 0x1
+	markerZstd byte = 0x2
+)
+
+// ErrUnsupported is returned (wrapped) for an unknown algorithm or frame marker
+var ErrUnsupported = errors.New("unsupported compression")
+
+// ErrTooLarge is returned (wrapped) when a payload decompresses beyond the allowed size
+var ErrTooLarge = errors.New("decompressed payload too large")
+
+// zstdEncoder is shared; EncodeAll is safe for concurrent use
+var zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+
+// Compressor compresses the payloads of one session or request with one algorithm.
+// A nil Compressor leaves payloads untouched (no compression negotiated).
+type Compressor struct {
+	algorithm string
+	threshold int // Payloads smaller than this are sent uncompressed
+}
+
+// New creates a compressor for the algorithm; it returns nil for "none" or ""
+func New(algorithm string, threshold int) (*Compressor, error) {
+	switch algorithm {
+	case "", None:
+		return nil, nil
+	case Gzip, Zstd:
+		return &Compressor{algorithm: algorithm, threshold: threshold}, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupported, algorithm)
+}
+
+// Name returns the algorithm ("none" for a nil compressor)
+func (c *Compressor) Name() string {
+	if c == nil {
+		return None
+	}
+	return c.algorithm
+}
+
+// Compress returns the payload compressed, or nil when it is below the threshold
+// or does not get smaller
+func (c *Compressor) Compress(payload []byte) ([]byte, error) {
+	if c == nil || len(payload) < c.threshold {
+		return nil, nil
+	}
+	compressed, err := compress(c.algorithm, payload)
+	if err != nil || len(compressed) >= len(payload) {
+		return nil, err
+	}
+	return compressed, nil
+}
+
+// EncodeFrame returns the frame payload for a message payload: a marker byte
+// followed by the payload, compressed when that is worthwhile
+func (c *Compressor) EncodeFrame(payload []byte) ([]byte, error) {
+	if c == nil {
+		return payload, nil
+	}
+	compressed, err := c.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	if compressed == nil {
+		return append([]byte{markerRaw}, payload...), nil
+	}
+	return append([]byte{marker(c.algorithm)}, compressed...), nil
+}
+
+// DecodeFrame returns the message payload of a frame, decompressed to at most maxSize bytes
+func (c *Compressor) DecodeFrame(frame []byte, maxSize int) ([]byte, error) {
+	if c == nil {
+		return frame, nil
+	}
+	if len(frame) == 0 {
+		return nil, fmt.Errorf("%w: frame without marker", ErrUnsupported)
+	}
+	switch frame[0] {
+	case markerRaw:
+		return frame[1:], nil
+	case marker(c.algorithm):
+		return Decompress(c.algorithm, frame[1:], maxSize)
+	}
+	return nil, fmt.Errorf("%w: frame marker 0x%x in a %s session", ErrUnsupported, frame[0], c.algorithm)
+}
+
+// Decompress decodes a payload compressed with the algorithm, reading at most maxSize bytes
+func Decompress(algorithm string, data []byte, maxSize int) ([]byte, error) {
+	var r io.ReadCloser
+	switch algorithm {
+	case Gzip:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		r = gz
+	case Zstd:
+		dec, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		r = dec.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnsupported, algorithm)
+	}
+	defer r.Close()
+
+	payload, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", algorithm, err)
+	}
+	if len(payload) > maxSize {
+		return nil, fmt.Errorf("%w: over %d bytes", ErrTooLarge, maxSize)
+	}
+	return payload, nil
+}
+
+// Negotiate picks the first algorithm offered by the peer (a header list such as
+// `"zstd", "gzip"` or an Accept-Encoding value) that is accepted. It returns ""
+// when none is.
+func Negotiate(offered string, accepted []string) string {
+	for _, item := range strings.Split(offered, ",") {
+		item, _, _ = strings.Cut(item, ";")
+		algorithm := strings.ToLower(strings.Trim(strings.TrimSpace(item), `"`))
+		if slices.Contains(Algorithms, algorithm) && slices.Contains(accepted, algorithm) {
+			return algorithm
+		}
+	}
+	return ""
+}
+
+// compress encodes a payload with the algorithm
+func compress(algorithm string, payload []byte) ([]byte, error) {
+	switch algorithm {
+	case Zstd:
+		return zstdEncoder.EncodeAll(payload, nil), nil
+	case Gzip:
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(payload); err != nil {
+			return nil, err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupported, algorithm)
+}
+
+// marker returns the frame marker of an algorithm
+func marker(algorithm string) byte {
+	if algorithm == Zstd {
+		return markerZstd
+	}
+	return markerGzip
+}
@@ -0,0 +1,160 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var (
+	// compressible is a payload both algorithms shrink
+	compressible = []byte(strings.Repeat(`{"type":"pong","content":"Pong response to: hello"}`, 40))
+	// incompressible does not get smaller
+	incompressible = func() []byte {
+		b := make([]byte, 512)
+		x := uint32(2463534242)
+		for i := range b {
+			x ^= x << 13
+			x ^= x >> 17
+			x ^= x << 5
+			b[i] = byte(x)
+		}
+		return b
+	}()
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		algorithm  string
+		threshold  int
+		payload    []byte
+		wantMarker byte
+	}{
+		{name: "zstd", algorithm: Zstd, threshold: 256, payload: compressible, wantMarker: markerZstd},
+		{name: "gzip", algorithm: Gzip, threshold: 256, payload: compressible, wantMarker: markerGzip},
+		{name: "below the threshold", algorithm: Zstd, threshold: len(compressible) + 1, payload: compressible, wantMarker: markerRaw},
+		{name: "at the threshold", algorithm: Gzip, threshold: len(compressible), payload: compressible, wantMarker: markerGzip},
+		{name: "does not get smaller", algorithm: Zstd, threshold: 0, payload: incompressible, wantMarker: markerRaw},
+		{name: "empty payload", algorithm: Gzip, threshold: 0, payload: []byte{}, wantMarker: markerRaw},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.algorithm, tt.threshold)
+			if err != nil {
+				t.Fatal(err)
+			}
+			frame, err := c.EncodeFrame(tt.payload)
+			if err != nil {
+				t.Fatalf("EncodeFrame() = %v", err)
+			}
+			if frame[0] != tt.wantMarker {
+				t.Fatalf("marker = 0x%x, want 0x%x", frame[0], tt.wantMarker)
+			}
+			if tt.wantMarker != markerRaw && len(frame) >= len(tt.payload) {
+				t.Errorf("compressed frame of %d bytes for a %d byte payload", len(frame), len(tt.payload))
+			}
+			got, err := c.DecodeFrame(frame, len(tt.payload))
+			if err != nil {
+				t.Fatalf("DecodeFrame() = %v", err)
+			}
+			if !bytes.Equal(got, tt.payload) {
+				t.Fatal("payload changed in the round trip")
+			}
+		})
+	}
+}
+
+func TestNoCompression(t *testing.T) {
+	for _, algorithm := range []string{"", None} {
+		c, err := New(algorithm, 0)
+		if err != nil || c != nil {
+			t.Fatalf("New(%q) = %v, %v, want nil, nil", algorithm, c, err)
+		}
+		if c.Name() != None {
+			t.Errorf("Name() = %q, want %q", c.Name(), None)
+		}
+		frame, _ := c.EncodeFrame(compressible)
+		if !bytes.Equal(frame, compressible) {
+			t.Error("nil compressor changed the payload")
+		}
+	}
+	if _, err := New("brotli", 0); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("New(brotli) = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestDecodeFrameErrors(t *testing.T) {
+	zstdCompressor, _ := New(Zstd, 0)
+	gzipCompressor, _ := New(Gzip, 0)
+	zstdFrame, _ := zstdCompressor.EncodeFrame(compressible)
+	tests := []struct {
+		name    string
+		c       *Compressor
+		frame   []byte
+		maxSize int
+		wantErr error
+	}{
+		{name: "frame without marker", c: zstdCompressor, frame: []byte{}, maxSize: 1024, wantErr: ErrUnsupported},
+		{name: "unknown marker", c: zstdCompressor, frame: []byte{0x7, 1, 2}, maxSize: 1024, wantErr: ErrUnsupported},
+		{name: "marker of another algorithm", c: gzipCompressor, frame: zstdFrame, maxSize: len(compressible), wantErr: ErrUnsupported},
+		{name: "decompresses beyond the limit", c: zstdCompressor, frame: zstdFrame, maxSize: len(compressible) - 1, wantErr: ErrTooLarge},
+		{name: "corrupted data", c: zstdCompressor, frame: append([]byte{markerZstd}, compressible[:20]...), maxSize: 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.c.DecodeFrame(tt.frame, tt.maxSize)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Fatalf("DecodeFrame() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecompress(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			data, err := compress(algorithm, compressible)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Decompress(algorithm, data, len(compressible))
+			if err != nil || !bytes.Equal(got, compressible) {
+				t.Fatalf("Decompress() = %d bytes, %v", len(got), err)
+			}
+			if _, err := Decompress(algorithm, data, len(compressible)-1); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("Decompress() over the limit = %v, want ErrTooLarge", err)
+			}
+		})
+	}
+	if _, err := Decompress("deflate", compressible, 1024); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Decompress(deflate) = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		offered  string
+		accepted []string
+		want     string
+	}{
+		{name: "first offered wins", offered: `"zstd", "gzip"`, accepted: []string{Gzip, Zstd}, want: Zstd},
+		{name: "offer order, not accepted order", offered: "gzip, zstd", accepted: []string{Zstd, Gzip}, want: Gzip},
+		{name: "only gzip accepted", offered: `"zstd", "gzip"`, accepted: []string{Gzip}, want: Gzip},
+		{name: "accept-encoding with weights", offered: "br;q=1.0, gzip;q=0.8", accepted: Algorithms, want: Gzip},
+		{name: "case insensitive", offered: "ZSTD", accepted: Algorithms, want: Zstd},
+		{name: "nothing in common", offered: "br, deflate", accepted: Algorithms},
+		{name: "compression disabled", offered: "zstd, gzip", accepted: nil},
+		{name: "no offer", offered: "", accepted: Algorithms},
+		{name: "accepted but unsupported", offered: "br", accepted: []string{"br"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.offered, tt.accepted); got != tt.want {
+				t.Errorf("Negotiate(%q, %v) = %q, want %q", tt.offered, tt.accepted, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,21 +1,289 @@
 package config
 
+import "time"
+
 // ServerConfig holds the configuration for a server instance
 type ServerConfig struct {
-	Port      string // Server port number
-	CertFile  string // Path to TLS certificate file
-	KeyFile   string // Path to TLS key file
-	Name      string // Server name for logging
-	TargetURL string // URL of the other server to echo messages to
+	Name        string            `json:"name" yaml:"name" toml:"name"`                      // Server name for logging and message sender
+	Listen      ListenConfig      `json:"listen" yaml:"listen" toml:"listen"`                // Listener addresses
+	TLS         TLSConfig         `json:"tls" yaml:"tls" toml:"tls"`                         // Serving certificate and peer verification
+	Targets     []string          `json:"targets" yaml:"targets" toml:"targets"`             // URLs of the servers to echo messages to
+	Delay       Duration          `json:"delay" yaml:"delay" toml:"delay"`                   // Artificial delay before each echo
+	Transport   TransportConfig   `json:"transport" yaml:"transport" toml:"transport"`       // QUIC/TLS transport options
+	Limits      LimitsConfig      `json:"limits" yaml:"limits" toml:"limits"`                // Buffer and history limits
+	Logging     LoggingConfig     `json:"logging" yaml:"logging" toml:"logging"`             // Log output and level
+	Reload      ReloadConfig      `json:"reload" yaml:"reload" toml:"reload"`                // Hot reload of config and certificates
+	Auth        AuthConfig        `json:"auth" yaml:"auth" toml:"auth"`                      // Authentication of /webtransport and /plain
+	Signing     SigningConfig     `json:"signing" yaml:"signing" toml:"signing"`             // Ed25519 message signatures
+	CORS        CORSConfig        `json:"cors" yaml:"cors" toml:"cors"`                      // Browser origins allowed to use /webtransport and /plain
+	Dedupe      DedupeConfig      `json:"dedupe" yaml:"dedupe" toml:"dedupe"`                // Replay protection and message deduplication
+	Encoding    EncodingConfig    `json:"encoding" yaml:"encoding" toml:"encoding"`          // Wire codecs negotiated with clients and used for echoes
+	Compression CompressionConfig `json:"compression" yaml:"compression" toml:"compression"` // Payload compression negotiated with peers
+	Content     ContentConfig     `json:"content" yaml:"content" toml:"content"`             // Content of generated ping/pong messages
+	Handlers    HandlersConfig    `json:"handlers" yaml:"handlers" toml:"handlers"`          // Message types handled besides ping and pong
+	Handshake   HandshakeConfig   `json:"handshake" yaml:"handshake" toml:"handshake"`       // Hello exchange with targets before echoing
+	Attachments AttachmentsConfig `json:"attachments" yaml:"attachments" toml:"attachments"` // Binary payloads streamed after attachment messages
+	State       StateConfig       `json:"state" yaml:"state" toml:"state"`                   // Sequence, chain and peer state kept across restarts
+	Journal     JournalConfig     `json:"journal" yaml:"journal" toml:"journal"`             // JSONL record of every message received and sent
+}
+
+// ListenConfig holds the listener addresses
+type ListenConfig struct {
+	Address string `json:"address" yaml:"address" toml:"address"` // TCP (HTTPS) and UDP (HTTP/3) address, e.g. ":8443"
+	Admin   string `json:"admin" yaml:"admin" toml:"admin"`       // Optional admin listener for pprof/runtime diagnostics
+}
+
+// TLSConfig holds the serving certificate paths and how peer certificates are verified when echoing
+type TLSConfig struct {
+	CertFile string   `json:"cert_file" yaml:"cert_file" toml:"cert_file"` // Path to TLS certificate file
+	KeyFile  string   `json:"key_file" yaml:"key_file" toml:"key_file"`    // Path to TLS key file
+	CAFile   string   `json:"ca_file" yaml:"ca_file" toml:"ca_file"`       // CA bundle used to verify peers (empty uses the system roots)
+	Pins     []string `json:"pins" yaml:"pins" toml:"pins"`                // SHA-256 fingerprints (hex or base64) of accepted peer certificates
+	Insecure bool     `json:"insecure" yaml:"insecure" toml:"insecure"`    // Skip peer certificate verification (development only)
+
+	ClientAuth   string   `json:"client_auth" yaml:"client_auth" toml:"client_auth"`          // Client certificates on the listener: none, request or require
+	ClientCAFile string   `json:"client_ca_file" yaml:"client_ca_file" toml:"client_ca_file"` // CA bundle for client certificates (empty uses ca_file)
+	AllowedPeers []string `json:"allowed_peers" yaml:"allowed_peers" toml:"allowed_peers"`    // Sender names allowed to join the chain (empty allows any verified peer)
+}
+
+// ClientCA returns the CA bundle used to verify client certificates
+func (t TLSConfig) ClientCA() string {
+	if t.ClientCAFile != "" {
+		return t.ClientCAFile
+	}
+	return t.CAFile
+}
+
+// TransportConfig holds QUIC/TLS transport options shared by listeners and dialers
+type TransportConfig struct {
+	KeyLogFile      string   `json:"keylog_file" yaml:"keylog_file" toml:"keylog_file"`                   // Optional TLS key log file (SSLKEYLOGFILE format)
+	QlogDir         string   `json:"qlog_dir" yaml:"qlog_dir" toml:"qlog_dir"`                            // Optional directory for per-connection qlog traces
+	MaxIdleTimeout  Duration `json:"max_idle_timeout" yaml:"max_idle_timeout" toml:"max_idle_timeout"`    // QUIC idle timeout (0 uses the quic-go default)
+	KeepAlivePeriod Duration `json:"keep_alive_period" yaml:"keep_alive_period" toml:"keep_alive_period"` // QUIC keep-alive period (0 disables)
+	ProbeTimeout    Duration `json:"probe_timeout" yaml:"probe_timeout" toml:"probe_timeout"`             // Timeout of each /readyz peer probe
+	ProbeCacheTTL   Duration `json:"probe_cache_ttl" yaml:"probe_cache_ttl" toml:"probe_cache_ttl"`       // How long /readyz reuses a peer probe result
+}
+
+// LimitsConfig holds buffer and history limits, rate limits and concurrency caps (0 disables a limit)
+type LimitsConfig struct {
+	MaxFrameBytes int `json:"max_frame_bytes" yaml:"max_frame_bytes" toml:"max_frame_bytes"` // Largest message frame read from a WebTransport stream
+	MaxBodyBytes  int `json:"max_body_bytes" yaml:"max_body_bytes" toml:"max_body_bytes"`    // Largest /plain request or response body
+	EventHistory  int `json:"event_history" yaml:"event_history" toml:"event_history"`       // Events replayed to new dashboard subscribers
+
+	ClientRate           float64 `json:"client_rate" yaml:"client_rate" toml:"client_rate"`                                     // Sessions and messages per second per remote address
+	ClientBurst          int     `json:"client_burst" yaml:"client_burst" toml:"client_burst"`                                  // Burst allowed above client_rate
+	ChainRate            float64 `json:"chain_rate" yaml:"chain_rate" toml:"chain_rate"`                                        // Messages per second per chain
+	ChainBurst           int     `json:"chain_burst" yaml:"chain_burst" toml:"chain_burst"`                                     // Burst allowed above chain_rate
+	MaxSessions          int     `json:"max_sessions" yaml:"max_sessions" toml:"max_sessions"`                                  // Concurrent WebTransport sessions
+	MaxStreamsPerSession int     `json:"max_streams_per_session" yaml:"max_streams_per_session" toml:"max_streams_per_session"` // Concurrent streams within one session
+	MaxInFlightEchoes    int     `json:"max_in_flight_echoes" yaml:"max_in_flight_echoes" toml:"max_in_flight_echoes"`          // Concurrent echoes to targets
+}
+
+// LoggingConfig holds log output options
+type LoggingConfig struct {
+	Level        string `json:"level" yaml:"level" toml:"level"`                      // Minimum level: info, warn or error
+	File         string `json:"file" yaml:"file" toml:"file"`                         // Log file path (empty for stderr)
+	Microseconds bool   `json:"microseconds" yaml:"microseconds" toml:"microseconds"` // Include microseconds in timestamps
+}
+
+// ReloadConfig holds hot reload options (SIGHUP always triggers a reload)
+type ReloadConfig struct {
+	WatchInterval Duration `json:"watch_interval" yaml:"watch_interval" toml:"watch_interval"` // Poll interval for config/cert file changes (0 disables the watcher)
+}
+
+// AuthConfig holds the authentication of /webtransport and /plain
+type AuthConfig struct {
+	Mode       string   `json:"mode" yaml:"mode" toml:"mode"`                      // none, bearer or hmac
+	Tokens     []string `json:"tokens" yaml:"tokens" toml:"tokens"`                // Accepted bearer tokens or HMAC secrets (several allow rotation)
+	Token      string   `json:"token" yaml:"token" toml:"token"`                   // Credential sent when echoing (empty uses the first of tokens)
+	MaxSkew    Duration `json:"max_skew" yaml:"max_skew" toml:"max_skew"`          // Accepted clock difference for HMAC timestamps
+	QueryToken bool     `json:"query_token" yaml:"query_token" toml:"query_token"` // bearer: also accept the token as the access_token query parameter (browsers)
+}
+
+// SigningConfig holds the Ed25519 signing of emitted messages and the verification of received ones
+type SigningConfig struct {
+	KeyFile string            `json:"key_file" yaml:"key_file" toml:"key_file"` // Private key signing emitted messages (empty leaves them unsigned)
+	Policy  string            `json:"policy" yaml:"policy" toml:"policy"`       // Received messages: off, flag or reject
+	Peers   map[string]string `json:"peers" yaml:"peers" toml:"peers"`          // Sender name -> public key (base64 or path of a .pub file)
+}
+
+// CORSConfig holds the browser origins allowed besides the server's own (the dashboard)
+type CORSConfig struct {
+	AllowedOrigins []string `json:"allowed_origins" yaml:"allowed_origins" toml:"allowed_origins"` // scheme://host[:port] entries, or "*" for any (development only)
+	MaxAge         Duration `json:"max_age" yaml:"max_age" toml:"max_age"`                         // How long browsers cache a /plain preflight response
+}
+
+// DedupeConfig holds the window of recently processed message IDs
+type DedupeConfig struct {
+	Window     Duration `json:"window" yaml:"window" toml:"window"`                // How long message IDs are remembered; older (or future) timestamps are rejected
+	MaxEntries int      `json:"max_entries" yaml:"max_entries" toml:"max_entries"` // Upper bound on remembered IDs (new messages are refused while it is reached)
+}
+
+// EncodingConfig holds the wire codecs (json, cbor, msgpack, protobuf)
+type EncodingConfig struct {
+	Accept []string `json:"accept" yaml:"accept" toml:"accept"` // Codecs accepted from clients; JSON is always accepted
+	Echo   string   `json:"echo" yaml:"echo" toml:"echo"`       // Codec offered first when echoing to targets
+}
+
+// CompressionConfig holds the zstd/gzip compression of message payloads
+type CompressionConfig struct {
+	Accept    []string `json:"accept" yaml:"accept" toml:"accept"`          // Algorithms accepted from peers (zstd, gzip); empty disables compression
+	Echo      string   `json:"echo" yaml:"echo" toml:"echo"`                // Algorithm offered when echoing to targets: none, zstd or gzip
+	Threshold int      `json:"threshold" yaml:"threshold" toml:"threshold"` // Payloads smaller than this many bytes are sent uncompressed
+}
+
+// ContentConfig holds how the content of a reply is derived from the incoming message
+type ContentConfig struct {
+	Strategy  string `json:"strategy" yaml:"strategy" toml:"strategy"`       // wrap, keep, truncate, template or hash
+	MaxLength int    `json:"max_length" yaml:"max_length" toml:"max_length"` // Upper bound in bytes for truncate and template (0 for unlimited)
+	Template  string `json:"template" yaml:"template" toml:"template"`       // text/template for the template strategy (fields: Type, Server, Sequence, Hop, Chain, From, Previous)
+}
+
+// HandlersConfig holds the built-in handlers of message types other than ping and pong
+type HandlersConfig struct {
+	Enabled       []string `json:"enabled" yaml:"enabled" toml:"enabled"`                      // echo, stop, stats, attachment and/or custom:* (other types are rejected)
+	ForwardCustom bool     `json:"forward_custom" yaml:"forward_custom" toml:"forward_custom"` // Echo replies to custom:* messages to the targets like ping/pong
 }
 
-// NewServerConfig creates a new server configuration
-func NewServerConfig(port, name, targetURL string) *ServerConfig {
+// Types returns the handled message types: ping, pong and hello, then the enabled ones
+func (h HandlersConfig) Types() []string {
+	return append([]string{"ping", "pong", "hello"}, h.Enabled...)
+}
+
+// HandshakeConfig holds the hello exchange advertising protocol versions, codecs,
+// compression and message types to targets
+type HandshakeConfig struct {
+	Enabled bool     `json:"enabled" yaml:"enabled" toml:"enabled"` // Say hello to each target before the first echo
+	TTL     Duration `json:"ttl" yaml:"ttl" toml:"ttl"`             // How long the capabilities of a peer are cached
+}
+
+// AttachmentsConfig holds the limits of attachments received on WebTransport streams
+type AttachmentsConfig struct {
+	MaxBytes   int64 `json:"max_bytes" yaml:"max_bytes" toml:"max_bytes"`       // Largest attachment accepted
+	ChunkBytes int   `json:"chunk_bytes" yaml:"chunk_bytes" toml:"chunk_bytes"` // Largest chunk accepted
+	MaxHops    int   `json:"max_hops" yaml:"max_hops" toml:"max_hops"`          // Hops after which an attachment is no longer forwarded
+}
+
+// StateConfig holds the on-disk store of the sequence counter, active chains and peer capabilities
+type StateConfig struct {
+	Path         string   `json:"path" yaml:"path" toml:"path"`                            // bbolt database file; empty keeps state in memory only
+	Resume       bool     `json:"resume" yaml:"resume" toml:"resume"`                      // Continue the chains that were active when the server stopped
+	ResumeWindow Duration `json:"resume_window" yaml:"resume_window" toml:"resume_window"` // Chains idle for longer are forgotten instead of resumed
+	ResumeDelay  Duration `json:"resume_delay" yaml:"resume_delay" toml:"resume_delay"`    // Wait for peers to continue a chain before resuming it
+}
+
+// JournalConfig holds the JSONL journal of every message received and sent
+type JournalConfig struct {
+	Path       string `json:"path" yaml:"path" toml:"path"`                      // Journal file; empty disables the journal
+	MaxBytes   int64  `json:"max_bytes" yaml:"max_bytes" toml:"max_bytes"`       // Size after which the file is rotated to <path>.1
+	MaxBackups int    `json:"max_backups" yaml:"max_backups" toml:"max_backups"` // Rotated files kept (<path>.1 is the newest)
+}
+
+// NewServerConfig creates a new server configuration with default values
+func NewServerConfig() *ServerConfig {
 	return &ServerConfig{
-		Port:      port,
-		CertFile:  "certs/server.crt",
-		KeyFile:   "certs/server.key",
-		Name:      name,
-		TargetURL: targetURL,
+		Name: "server",
+		Listen: ListenConfig{
+			Address: ":8443",
+		},
+		TLS: TLSConfig{
+			CertFile:   "certs/server.crt",
+			KeyFile:    "certs/server.key",
+			ClientAuth: "none",
+		},
+		Transport: TransportConfig{
+			ProbeTimeout:  Duration(3 * time.Second),
+			ProbeCacheTTL: Duration(10 * time.Second),
+		},
+		Limits: LimitsConfig{
+			MaxFrameBytes:        64 << 10,
+			MaxBodyBytes:         64 << 10,
+			EventHistory:         100,
+			MaxSessions:          256,
+			MaxStreamsPerSession: 64,
+			MaxInFlightEchoes:    64,
+		},
+		Logging: LoggingConfig{
+			Level: "info",
+		},
+		Reload: ReloadConfig{
+			WatchInterval: Duration(2 * time.Second),
+		},
+		Auth: AuthConfig{
+			Mode:    "none",
+			MaxSkew: Duration(5 * time.Minute),
+		},
+		Signing: SigningConfig{
+			Policy: "off",
+		},
+		CORS: CORSConfig{
+			MaxAge: Duration(10 * time.Minute),
+		},
+		Dedupe: DedupeConfig{
+			Window:     Duration(5 * time.Minute),
+			MaxEntries: 10000,
+		},
+		Encoding: EncodingConfig{
+			Accept: []string{"json", "cbor", "msgpack", "protobuf"},
+			Echo:   "json",
+		},
+		Compression: CompressionConfig{
+			Accept:    []string{"zstd", "gzip"},
+			Echo:      "none",
+			Threshold: 1024,
+		},
+		Content: ContentConfig{
+			Strategy:  "truncate",
+			MaxLength: 256,
+		},
+		Handlers: HandlersConfig{
+			Enabled: []string{"echo", "stop", "stats", "attachment", "custom:*"},
+		},
+		Handshake: HandshakeConfig{
+			Enabled: true,
+			TTL:     Duration(10 * time.Minute),
+		},
+		Attachments: AttachmentsConfig{
+			MaxBytes:   64 << 20,
+			ChunkBytes: 64 << 10,
+			MaxHops:    4,
+		},
+		State: StateConfig{
+			Resume:       true,
+			ResumeWindow: Duration(2 * time.Minute),
+			ResumeDelay:  Duration(10 * time.Second),
+		},
+		Journal: JournalConfig{
+			MaxBytes:   64 << 20,
+			MaxBackups: 5,
+		},
+	}
+}
+
+// Duration is a time.Duration encoded as a string such as "1.5s" in config files
+type Duration time.Duration
+
+// Std returns the value as a time.Duration
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+// String returns the duration in time.Duration notation
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText encodes the duration as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalText decodes a duration string such as "500ms" or "2s"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
 	}
+	*d = Duration(parsed)
+	return nil
 }
@@ -0,0 +1,238 @@
+package config
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix is the prefix of environment variables overriding config values.
+// Variable names follow the YAML keys, e.g. MC_LISTEN_ADDRESS or MC_LOGGING_LEVEL.
+const EnvPrefix = "MC_"
+
+// Load builds the configuration from defaults, the optional config file and
+// environment variable overrides (in that order of precedence).
+// The conventional SSLKEYLOGFILE and QLOGDIR variables seed the transport defaults.
+func Load(path string) (*ServerConfig, error) {
+	cfg := NewServerConfig()
+	cfg.Transport.KeyLogFile = os.Getenv("SSLKEYLOGFILE")
+	cfg.Transport.QlogDir = os.Getenv("QLOGDIR")
+	if path != "" {
+		if err := cfg.LoadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.ApplyEnv(os.Environ()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadFile decodes a YAML, JSON or TOML file (chosen by extension) over the current values.
+// Unknown keys are rejected so typos do not silently fall back to defaults.
+func (c *ServerConfig) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(c); err != nil {
+			return fmt.Errorf("failed to parse YAML config %s: %w", path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(c); err != nil {
+			return fmt.Errorf("failed to parse JSON config %s: %w", path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), c)
+		if err != nil {
+			return fmt.Errorf("failed to parse TOML config %s: %w", path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("failed to parse TOML config %s: unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q (use .yaml, .yml, .json or .toml)", ext)
+	}
+	return nil
+}
+
+// ApplyEnv overrides values from MC_* variables in the given environment ("KEY=value" entries).
+// Lists are comma-separated; unknown MC_* variables are rejected.
+func (c *ServerConfig) ApplyEnv(environ []string) error {
+	fields := make(map[string]reflect.Value)
+	collectEnvFields(reflect.ValueOf(c).Elem(), strings.TrimSuffix(EnvPrefix, "_"), fields)
+
+	var unknown []string
+	for _, entry := range environ {
+		key, value, ok := strings.Cut(entry, "=")
+		if !ok || !strings.HasPrefix(key, EnvPrefix) || key == EnvPrefix+"CONFIG" {
+			continue
+		}
+		field, found := fields[key]
+		if !found {
+			unknown = append(unknown, key)
+			continue
+		}
+		if err := setFromString(field, value); err != nil {
+			return fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown environment overrides: %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// EnvNames returns the names of all supported environment overrides
+func EnvNames() []string {
+	fields := make(map[string]reflect.Value)
+	collectEnvFields(reflect.ValueOf(NewServerConfig()).Elem(), strings.TrimSuffix(EnvPrefix, "_"), fields)
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// redacted replaces a secret in rendered output, keeping whether it was set
+const redacted = "***"
+
+// Render encodes the configuration in the given format ("yaml", "json" or "toml")
+// with the authentication secrets redacted
+func (c *ServerConfig) Render(format string) ([]byte, error) {
+	c = c.Redacted()
+	switch format {
+	case "yaml", "yml":
+		return yaml.Marshal(c)
+	case "json":
+		return json.MarshalIndent(c, "", "  ")
+	case "toml":
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q (use yaml, json or toml)", format)
+	}
+}
+
+// Redacted returns a copy of the configuration whose bearer tokens and HMAC
+// secrets are replaced by "***", so it can be printed or logged
+func (c *ServerConfig) Redacted() *ServerConfig {
+	out := *c
+	out.Auth.Tokens = make([]string, len(c.Auth.Tokens))
+	for i := range out.Auth.Tokens {
+		out.Auth.Tokens[i] = redacted
+	}
+	if out.Auth.Token != "" {
+		out.Auth.Token = redacted
+	}
+	return &out
+}
+
+// collectEnvFields maps MC_<SECTION>_<KEY> names to settable leaf fields using the YAML keys
+func collectEnvFields(v reflect.Value, prefix string, fields map[string]reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		key, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		name := prefix + "_" + strings.ToUpper(key)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct && !isTextField(field) {
+			collectEnvFields(field, name, fields)
+			continue
+		}
+		fields[name] = field
+	}
+}
+
+// isTextField reports whether the field decodes itself from text (e.g. Duration)
+func isTextField(field reflect.Value) bool {
+	_, ok := field.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// setFromString assigns a string value to a leaf field
+func setFromString(field reflect.Value, value string) error {
+	if isTextField(field) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported list type %s", field.Type())
+		}
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items))
+	case reflect.Map:
+		if field.Type() != reflect.TypeOf(map[string]string(nil)) {
+			return fmt.Errorf("unsupported map type %s", field.Type())
+		}
+		items := make(map[string]string)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item == "" {
+				continue
+			}
+			key, val, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", item)
+			}
+			items[strings.TrimSpace(key)] = strings.TrimSpace(val)
+		}
+		field.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported field kind %s", field.Kind())
+	}
+	return nil
+}
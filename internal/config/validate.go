@@ -0,0 +1,368 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/ryo-arima/magic-cylinder/internal/certs"
+	"github.com/ryo-arima/magic-cylinder/internal/content"
+	"github.com/ryo-arima/magic-cylinder/internal/cors"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+)
+
+// LogLevels lists the accepted logging.level values, from most to least verbose
+var LogLevels = []string{"info", "warn", "error"}
+
+// ClientAuthModes lists the accepted tls.client_auth values
+var ClientAuthModes = []string{"none", "request", "require"}
+
+// AuthModes lists the accepted auth.mode values
+var AuthModes = []string{"none", "bearer", "hmac"}
+
+// SigningPolicies lists the accepted signing.policy values
+var SigningPolicies = []string{"off", "flag", "reject"}
+
+// Codecs lists the accepted encoding.accept and encoding.echo values
+var Codecs = []string{"json", "cbor", "msgpack", "protobuf"}
+
+// CompressionAlgorithms lists the accepted compression.accept values (compression.echo also accepts "none")
+var CompressionAlgorithms = []string{"zstd", "gzip"}
+
+// Handlers lists the accepted handlers.enabled values
+var Handlers = []string{"echo", "stop", "stats", "attachment", "custom:*"}
+
+// minMessageBytes is the smallest accepted frame/body limit (a message with short fields)
+const minMessageBytes = 512
+
+// minTokenLength is the shortest accepted auth token or HMAC secret
+const minTokenLength = 16
+
+// ValidationError lists every problem found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+// Error returns all problems, one per line
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the configuration and reports all problems at once
+func (c *ServerConfig) Validate() error {
+	v := &ValidationError{}
+	add := func(field, format string, args ...any) {
+		v.Problems = append(v.Problems, field+": "+fmt.Sprintf(format, args...))
+	}
+
+	if strings.TrimSpace(c.Name) == "" {
+		add("name", "must not be empty")
+	}
+
+	if err := validateAddress(c.Listen.Address, false); err != nil {
+		add("listen.address", "%v", err)
+	}
+	if c.Listen.Admin != "" {
+		if err := validateAddress(c.Listen.Admin, true); err != nil {
+			add("listen.admin", "%v", err)
+		}
+	}
+
+	if err := validateReadable(c.TLS.CertFile); err != nil {
+		add("tls.cert_file", "%v", err)
+	}
+	if err := validateReadable(c.TLS.KeyFile); err != nil {
+		add("tls.key_file", "%v", err)
+	}
+	if c.TLS.CAFile != "" {
+		if err := validateReadable(c.TLS.CAFile); err != nil {
+			add("tls.ca_file", "%v", err)
+		}
+	}
+	for i, pin := range c.TLS.Pins {
+		if _, err := certs.ParseFingerprint(pin); err != nil {
+			add(fmt.Sprintf("tls.pins[%d]", i), "%v", err)
+		}
+	}
+	if c.TLS.Insecure && (c.TLS.CAFile != "" || len(c.TLS.Pins) > 0) {
+		add("tls.insecure", "cannot be combined with ca_file or pins")
+	}
+	switch {
+	case !slices.Contains(ClientAuthModes, c.TLS.ClientAuth):
+		add("tls.client_auth", "must be one of %s (got %q)", strings.Join(ClientAuthModes, ", "), c.TLS.ClientAuth)
+	case c.TLS.ClientAuth != "none" && c.TLS.ClientCA() == "":
+		add("tls.client_ca_file", "required when client_auth is %q (or set ca_file)", c.TLS.ClientAuth)
+	case c.TLS.ClientAuth != "none":
+		if err := validateReadable(c.TLS.ClientCA()); err != nil {
+			add("tls.client_ca_file", "%v", err)
+		}
+	}
+	if len(c.TLS.AllowedPeers) > 0 && c.TLS.ClientAuth == "none" {
+		add("tls.allowed_peers", "requires client_auth request or require")
+	}
+
+	seen := make(map[string]bool)
+	for i, target := range c.Targets {
+		field := fmt.Sprintf("targets[%d]", i)
+		if err := validateTarget(target); err != nil {
+			add(field, "%v", err)
+		}
+		if seen[target] {
+			add(field, "duplicate target %q", target)
+		}
+		seen[target] = true
+	}
+
+	if c.Delay < 0 {
+		add("delay", "must not be negative (got %s)", c.Delay)
+	}
+	if c.Transport.MaxIdleTimeout < 0 {
+		add("transport.max_idle_timeout", "must not be negative (got %s)", c.Transport.MaxIdleTimeout)
+	}
+	if c.Transport.KeepAlivePeriod < 0 {
+		add("transport.keep_alive_period", "must not be negative (got %s)", c.Transport.KeepAlivePeriod)
+	}
+	if c.Transport.MaxIdleTimeout > 0 && c.Transport.KeepAlivePeriod >= c.Transport.MaxIdleTimeout {
+		add("transport.keep_alive_period", "must be shorter than max_idle_timeout (%s >= %s)", c.Transport.KeepAlivePeriod, c.Transport.MaxIdleTimeout)
+	}
+	if c.Transport.ProbeTimeout <= 0 {
+		add("transport.probe_timeout", "must be positive (got %s)", c.Transport.ProbeTimeout)
+	}
+	if c.Transport.ProbeCacheTTL <= 0 {
+		add("transport.probe_cache_ttl", "must be positive (got %s)", c.Transport.ProbeCacheTTL)
+	}
+
+	if c.Limits.MaxFrameBytes < minMessageBytes {
+		add("limits.max_frame_bytes", "must be at least %d (got %d)", minMessageBytes, c.Limits.MaxFrameBytes)
+	}
+	if c.Limits.MaxBodyBytes < minMessageBytes {
+		add("limits.max_body_bytes", "must be at least %d (got %d)", minMessageBytes, c.Limits.MaxBodyBytes)
+	}
+	if c.Limits.EventHistory < 0 {
+		add("limits.event_history", "must not be negative (got %d)", c.Limits.EventHistory)
+	}
+	for _, limit := range []struct {
+		field string
+		value float64
+	}{
+		{"limits.client_rate", c.Limits.ClientRate},
+		{"limits.client_burst", float64(c.Limits.ClientBurst)},
+		{"limits.chain_rate", c.Limits.ChainRate},
+		{"limits.chain_burst", float64(c.Limits.ChainBurst)},
+		{"limits.max_sessions", float64(c.Limits.MaxSessions)},
+		{"limits.max_streams_per_session", float64(c.Limits.MaxStreamsPerSession)},
+		{"limits.max_in_flight_echoes", float64(c.Limits.MaxInFlightEchoes)},
+	} {
+		if limit.value < 0 {
+			add(limit.field, "must not be negative (got %v)", limit.value)
+		}
+	}
+
+	if !slices.Contains(LogLevels, c.Logging.Level) {
+		add("logging.level", "must be one of %s (got %q)", strings.Join(LogLevels, ", "), c.Logging.Level)
+	}
+
+	if c.Reload.WatchInterval < 0 {
+		add("reload.watch_interval", "must not be negative (got %s)", c.Reload.WatchInterval)
+	}
+
+	switch {
+	case !slices.Contains(AuthModes, c.Auth.Mode):
+		add("auth.mode", "must be one of %s (got %q)", strings.Join(AuthModes, ", "), c.Auth.Mode)
+	case c.Auth.Mode != "none" && len(c.Auth.Tokens) == 0:
+		add("auth.tokens", "at least one token is required when mode is %q", c.Auth.Mode)
+	}
+	for i, token := range c.Auth.Tokens {
+		if len(token) < minTokenLength {
+			add(fmt.Sprintf("auth.tokens[%d]", i), "must be at least %d characters", minTokenLength)
+		}
+	}
+	if c.Auth.Token != "" && len(c.Auth.Token) < minTokenLength {
+		add("auth.token", "must be at least %d characters", minTokenLength)
+	}
+	if c.Auth.Mode == "hmac" && c.Auth.MaxSkew <= 0 {
+		add("auth.max_skew", "must be positive (got %s)", c.Auth.MaxSkew)
+	}
+	if c.Auth.QueryToken && c.Auth.Mode != "bearer" {
+		add("auth.query_token", "requires mode bearer (got %q)", c.Auth.Mode)
+	}
+
+	if c.Signing.KeyFile != "" {
+		if _, err := signing.LoadPrivateKey(c.Signing.KeyFile); err != nil {
+			add("signing.key_file", "%v", err)
+		}
+	}
+	switch {
+	case !slices.Contains(SigningPolicies, c.Signing.Policy):
+		add("signing.policy", "must be one of %s (got %q)", strings.Join(SigningPolicies, ", "), c.Signing.Policy)
+	case c.Signing.Policy != "off" && len(c.Signing.Peers) == 0:
+		add("signing.peers", "at least one peer key is required when policy is %q", c.Signing.Policy)
+	}
+	for _, name := range slices.Sorted(maps.Keys(c.Signing.Peers)) {
+		if _, err := signing.ParsePublicKey(c.Signing.Peers[name]); err != nil {
+			add("signing.peers."+name, "%v", err)
+		}
+	}
+
+	for i, origin := range c.CORS.AllowedOrigins {
+		if err := cors.ValidateOrigin(origin); err != nil {
+			add(fmt.Sprintf("cors.allowed_origins[%d]", i), "%v", err)
+		}
+	}
+	if c.CORS.MaxAge < 0 {
+		add("cors.max_age", "must not be negative (got %s)", c.CORS.MaxAge)
+	}
+
+	switch {
+	case c.Dedupe.Window <= 0:
+		add("dedupe.window", "must be positive (got %s)", c.Dedupe.Window)
+	case c.Dedupe.Window <= c.Delay:
+		add("dedupe.window", "must be longer than delay (%s <= %s), or echoed messages arrive stale", c.Dedupe.Window, c.Delay)
+	}
+	if c.Dedupe.MaxEntries <= 0 {
+		add("dedupe.max_entries", "must be positive (got %d)", c.Dedupe.MaxEntries)
+	}
+
+	for i, name := range c.Encoding.Accept {
+		if !slices.Contains(Codecs, name) {
+			add(fmt.Sprintf("encoding.accept[%d]", i), "must be one of %s (got %q)", strings.Join(Codecs, ", "), name)
+		}
+	}
+	if !slices.Contains(Codecs, c.Encoding.Echo) {
+		add("encoding.echo", "must be one of %s (got %q)", strings.Join(Codecs, ", "), c.Encoding.Echo)
+	}
+
+	for i, algorithm := range c.Compression.Accept {
+		if !slices.Contains(CompressionAlgorithms, algorithm) {
+			add(fmt.Sprintf("compression.accept[%d]", i), "must be one of %s (got %q)", strings.Join(CompressionAlgorithms, ", "), algorithm)
+		}
+	}
+	if c.Compression.Echo != "none" && !slices.Contains(CompressionAlgorithms, c.Compression.Echo) {
+		add("compression.echo", "must be none or one of %s (got %q)", strings.Join(CompressionAlgorithms, ", "), c.Compression.Echo)
+	}
+	if c.Compression.Threshold < 0 {
+		add("compression.threshold", "must not be negative (got %d)", c.Compression.Threshold)
+	}
+
+	if _, err := content.New(c.Content.Strategy, c.Content.MaxLength, c.Content.Template); err != nil {
+		add("content", "%v", err)
+	}
+
+	for i, name := range c.Handlers.Enabled {
+		switch {
+		case !slices.Contains(Handlers, name):
+			add(fmt.Sprintf("handlers.enabled[%d]", i), "must be one of %s (got %q)", strings.Join(Handlers, ", "), name)
+		case slices.Index(c.Handlers.Enabled, name) != i:
+			add(fmt.Sprintf("handlers.enabled[%d]", i), "duplicate handler %q", name)
+		}
+	}
+	if c.Attachments.MaxBytes <= 0 {
+		add("attachments.max_bytes", "must be positive (got %d)", c.Attachments.MaxBytes)
+	}
+	if c.Attachments.ChunkBytes <= 0 || c.Attachments.ChunkBytes > c.Limits.MaxFrameBytes {
+		add("attachments.chunk_bytes", "must be between 1 and limits.max_frame_bytes (%d) (got %d)", c.Limits.MaxFrameBytes, c.Attachments.ChunkBytes)
+	}
+	if c.Attachments.MaxHops < 1 {
+		add("attachments.max_hops", "must be at least 1 (got %d)", c.Attachments.MaxHops)
+	}
+	if c.State.ResumeWindow <= 0 {
+		add("state.resume_window", "must be positive (got %s)", c.State.ResumeWindow)
+	}
+	if c.State.ResumeDelay < 0 || c.State.ResumeDelay >= c.State.ResumeWindow {
+		add("state.resume_delay", "must be at least 0 and below state.resume_window (%s) (got %s)", c.State.ResumeWindow, c.State.ResumeDelay)
+	}
+	if c.Journal.MaxBytes <= 0 {
+		add("journal.max_bytes", "must be positive (got %d)", c.Journal.MaxBytes)
+	}
+	if c.Journal.MaxBackups < 0 {
+		add("journal.max_backups", "must not be negative (got %d)", c.Journal.MaxBackups)
+	}
+	if c.Handshake.Enabled && c.Handshake.TTL <= 0 {
+		add("handshake.ttl", "must be positive when the handshake is enabled (got %s)", c.Handshake.TTL)
+	}
+
+	if len(v.Problems) > 0 {
+		return v
+	}
+	return nil
+}
+
+// validateAddress checks a host:port listen address (a bare port is accepted when allowBarePort is set)
+func validateAddress(addr string, allowBarePort bool) error {
+	if addr == "" {
+		return errors.New("must not be empty")
+	}
+	if allowBarePort && !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %v", addr, err)
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port %q in %q", port, addr)
+	}
+	return nil
+}
+
+// validateReadable checks that a file exists and can be opened
+func validateReadable(path string) error {
+	if path == "" {
+		return errors.New("must not be empty")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// validateTarget checks an echo target URL (https, with host and a /webtransport or /plain path)
+func validateTarget(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %v", target, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("unsupported scheme %q in %q (use https)", u.Scheme, target)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("missing host in %q", target)
+	}
+	switch strings.TrimSuffix(u.Path, "/") {
+	case "/webtransport", "/plain":
+	default:
+		return fmt.Errorf("path of %q must be /webtransport or /plain", target)
+	}
+	if u.Scheme == "http" && TargetTransport(target) == TransportWebTransport {
+		return fmt.Errorf("WebTransport target %q requires https", target)
+	}
+	return nil
+}
+
+// Echo transports, selected by the path of the target URL
+const (
+	TransportWebTransport = "webtransport"
+	TransportPlain        = "plain"
+)
+
+// TargetTransport returns the transport echoes to a target use: plain for a /plain
+// path, WebTransport otherwise. The scheme does not decide, as both endpoints are
+// served over https.
+func TargetTransport(target string) string {
+	path := target
+	if u, err := url.Parse(target); err == nil {
+		path = u.Path
+	}
+	if strings.HasSuffix(strings.TrimSuffix(path, "/"), "/plain") {
+		return TransportPlain
+	}
+	return TransportWebTransport
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validConfig returns the default configuration with readable certificate files
+func validConfig(t *testing.T) *ServerConfig {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := NewServerConfig()
+	cfg.Name = "server1"
+	cfg.TLS.CertFile = filepath.Join(dir, "server.crt")
+	cfg.TLS.KeyFile = filepath.Join(dir, "server.key")
+	for _, path := range []string{cfg.TLS.CertFile, cfg.TLS.KeyFile} {
+		if err := os.WriteFile(path, []byte("test"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	if err := validConfig(t).Validate(); err != nil {
+		t.Fatalf("Validate() of the default configuration = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *ServerConfig)
+		want   []string // Problems expected, by their leading "field: message" text
+	}{
+		{name: "empty name", modify: func(c *ServerConfig) { c.Name = " " }, want: []string{"name: must not be empty"}},
+		{name: "listen address without port", modify: func(c *ServerConfig) { c.Listen.Address = "localhost" }, want: []string{"listen.address: invalid address"}},
+		{name: "listen port out of range", modify: func(c *ServerConfig) { c.Listen.Address = ":70000" }, want: []string{"listen.address: invalid port"}},
+		{name: "admin bare port", modify: func(c *ServerConfig) { c.Listen.Admin = "9090" }},
+		{name: "admin port zero", modify: func(c *ServerConfig) { c.Listen.Admin = "0" }, want: []string{"listen.admin: invalid port"}},
+		{name: "missing certificate", modify: func(c *ServerConfig) { c.TLS.CertFile = "/nonexistent/server.crt" }, want: []string{"tls.cert_file: cannot read"}},
+		{name: "empty key file", modify: func(c *ServerConfig) { c.TLS.KeyFile = "" }, want: []string{"tls.key_file: must not be empty"}},
+		{name: "insecure with pins", modify: func(c *ServerConfig) { c.TLS.Insecure, c.TLS.Pins = true, []string{strings.Repeat("ab", 32)} }, want: []string{"tls.insecure: cannot be combined"}},
+		{name: "invalid pin", modify: func(c *ServerConfig) { c.TLS.Pins = []string{"not-a-pin"} }, want: []string{"tls.pins[0]:"}},
+		{name: "unknown client auth", modify: func(c *ServerConfig) { c.TLS.ClientAuth = "always" }, want: []string{"tls.client_auth: must be one of"}},
+		{name: "client auth without a CA", modify: func(c *ServerConfig) { c.TLS.ClientAuth = "require" }, want: []string{"tls.client_ca_file: required"}},
+		{name: "allowed peers without client auth", modify: func(c *ServerConfig) { c.TLS.AllowedPeers = []string{"server2"} }, want: []string{"tls.allowed_peers: requires client_auth"}},
+		{name: "target scheme", modify: func(c *ServerConfig) { c.Targets = []string{"ftp://localhost:8444/plain"} }, want: []string{"targets[0]: unsupported scheme"}},
+		{name: "target path", modify: func(c *ServerConfig) { c.Targets = []string{"https://localhost:8444/echo"} }, want: []string{"targets[0]: path of"}},
+		{name: "webtransport target over http", modify: func(c *ServerConfig) { c.Targets = []string{"http://localhost:8444/webtransport"} }, want: []string{"targets[0]: WebTransport target"}},
+		{name: "target without host", modify: func(c *ServerConfig) { c.Targets = []string{"https:///plain"} }, want: []string{"targets[0]: missing host"}},
+		{
+			name: "duplicate target",
+			modify: func(c *ServerConfig) {
+				c.Targets = []string{"https://localhost:8444/plain", "https://localhost:8444/plain"}
+			},
+			want: []string{"targets[1]: duplicate target"},
+		},
+		{name: "negative delay", modify: func(c *ServerConfig) { c.Delay = Duration(-time.Second) }, want: []string{"delay: must not be negative"}},
+		{
+			name: "keep alive not below idle timeout",
+			modify: func(c *ServerConfig) {
+				c.Transport.MaxIdleTimeout, c.Transport.KeepAlivePeriod = Duration(time.Second), Duration(time.Second)
+			},
+			want: []string{"transport.keep_alive_period: must be shorter"},
+		},
+		{name: "frame limit too small", modify: func(c *ServerConfig) { c.Limits.MaxFrameBytes = 100 }, want: []string{"limits.max_frame_bytes: must be at least", "attachments.chunk_bytes:"}},
+		{name: "negative rate", modify: func(c *ServerConfig) { c.Limits.ChainRate = -1 }, want: []string{"limits.chain_rate: must not be negative"}},
+		{name: "unknown log level", modify: func(c *ServerConfig) { c.Logging.Level = "debug" }, want: []string{"logging.level: must be one of"}},
+		{name: "auth without tokens", modify: func(c *ServerConfig) { c.Auth.Mode = "bearer" }, want: []string{"auth.tokens: at least one token"}},
+		{name: "short token", modify: func(c *ServerConfig) { c.Auth.Mode, c.Auth.Tokens = "bearer", []string{"short"} }, want: []string{"auth.tokens[0]: must be at least"}},
+		{
+			name: "hmac without skew",
+			modify: func(c *ServerConfig) {
+				c.Auth.Mode, c.Auth.Tokens, c.Auth.MaxSkew = "hmac", []string{strings.Repeat("s", 16)}, 0
+			},
+			want: []string{"auth.max_skew: must be positive"},
+		},
+		{name: "query token outside bearer mode", modify: func(c *ServerConfig) { c.Auth.QueryToken = true }, want: []string{"auth.query_token: requires mode bearer"}},
+		{name: "signing policy without peers", modify: func(c *ServerConfig) { c.Signing.Policy = "reject" }, want: []string{"signing.peers: at least one peer key"}},
+		{name: "invalid peer key", modify: func(c *ServerConfig) { c.Signing.Peers = map[string]string{"server2": "nope"} }, want: []string{"signing.peers.server2:"}},
+		{name: "invalid origin", modify: func(c *ServerConfig) { c.CORS.AllowedOrigins = []string{"localhost:3000"} }, want: []string{"cors.allowed_origins[0]:"}},
+		{
+			name:   "dedupe window not above the delay",
+			modify: func(c *ServerConfig) { c.Delay, c.Dedupe.Window = Duration(time.Minute), Duration(time.Minute) },
+			want:   []string{"dedupe.window: must be longer than delay"},
+		},
+		{name: "dedupe without entries", modify: func(c *ServerConfig) { c.Dedupe.MaxEntries = 0 }, want: []string{"dedupe.max_entries: must be positive"}},
+		{name: "unknown codec", modify: func(c *ServerConfig) { c.Encoding.Accept = []string{"xml"}; c.Encoding.Echo = "yaml" }, want: []string{"encoding.accept[0]:", "encoding.echo:"}},
+		{name: "unknown compression", modify: func(c *ServerConfig) { c.Compression.Accept = []string{"br"}; c.Compression.Echo = "br" }, want: []string{"compression.accept[0]:", "compression.echo:"}},
+		{name: "unknown content strategy", modify: func(c *ServerConfig) { c.Content.Strategy = "shout" }, want: []string{"content: unknown strategy"}},
+		{
+			name:   "unknown and duplicate handlers",
+			modify: func(c *ServerConfig) { c.Handlers.Enabled = []string{"echo", "shout", "echo"} },
+			want:   []string{"handlers.enabled[1]: must be one of", "handlers.enabled[2]: duplicate handler"},
+		},
+		{name: "chunk above the frame limit", modify: func(c *ServerConfig) { c.Attachments.ChunkBytes = c.Limits.MaxFrameBytes + 1 }, want: []string{"attachments.chunk_bytes:"}},
+		{name: "attachments without hops", modify: func(c *ServerConfig) { c.Attachments.MaxHops = 0 }, want: []string{"attachments.max_hops: must be at least 1"}},
+		{
+			name:   "resume delay not below the window",
+			modify: func(c *ServerConfig) { c.State.ResumeDelay = c.State.ResumeWindow },
+			want:   []string{"state.resume_delay: must be at least 0 and below"},
+		},
+		{name: "negative backups", modify: func(c *ServerConfig) { c.Journal.MaxBackups = -1 }, want: []string{"journal.max_backups: must not be negative"}},
+		{name: "handshake without ttl", modify: func(c *ServerConfig) { c.Handshake.Enabled, c.Handshake.TTL = true, 0 }, want: []string{"handshake.ttl: must be positive"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig(t)
+			tt.modify(cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			var v *ValidationError
+			if !errors.As(err, &v) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			if len(v.Problems) != len(tt.want) {
+				t.Fatalf("Validate() problems = %q, want %d", v.Problems, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.HasPrefix(v.Problems[i], want) {
+					t.Errorf("problem %d = %q, want it to start with %q", i, v.Problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidationErrorListsEveryProblem(t *testing.T) {
+	cfg := validConfig(t)
+	cfg.Name = ""
+	cfg.Logging.Level = "trace"
+	cfg.Journal.MaxBytes = 0
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil")
+	}
+	for _, field := range []string{"  - name:", "  - logging.level:", "  - journal.max_bytes:"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("error %q does not list %q", err, field)
+		}
+	}
+}
+
+func TestTargetTransport(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "https://localhost:8444/webtransport", want: TransportWebTransport},
+		{target: "https://localhost:8444/plain", want: TransportPlain},
+		{target: "https://localhost:8444/plain/", want: TransportPlain},
+		{target: "http://localhost:8444/plain", want: TransportPlain},
+		{target: "https://localhost:8444/plain?x=1", want: TransportPlain},
+		{target: "https://plain.example.com/webtransport", want: TransportWebTransport},
+	}
+	for _, tt := range tests {
+		if got := TargetTransport(tt.target); got != tt.want {
+			t.Errorf("TargetTransport(%q) = %q, want %q", tt.target, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package content generates the content of the message sent in reply to a ping or pong.
+// The legacy behaviour wraps the whole incoming content on every hop, so it grows without
+// bound; the other strategies keep it bounded.
+package content
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Strategies
+const (
+	// Wrap prefixes the incoming content with "<Type> response to: " (grows every hop)
+	Wrap = "wrap"
+	// Keep copies the incoming content unchanged
+	Keep = "keep"
+	// Truncate wraps like Wrap and cuts the result to the maximum length
+	Truncate = "truncate"
+	// Template renders a text/template with the hop, sequence and message fields
+	Template = "template"
+	// Hash replaces the content with the SHA-256 of the incoming content
+	Hash = "hash"
+)
+
+// Strategies lists the accepted strategy names
+var Strategies = []string{Wrap, Keep, Truncate, Template, Hash}
+
+// DefaultTemplate is used by the template strategy when none is configured
+const DefaultTemplate = "{{.Type}} #{{.Sequence}} from {{.Server}} (hop {{.Hop}})"
+
+// ellipsis marks truncated content
+const ellipsis = "…"
+
+// Data is the input of a content template
+type Data struct {
+	Type     model.MessageType // Type of the generated message
+	Server   string            // Name of the generating server
+	Sequence int               // Sequence of the generated message
+	Hop      int               // Hop of the generated message
+	Chain    string            // Chain ID
+	From     string            // Sender of the incoming message
+	Previous string            // Content of the incoming message
+}
+
+// Generator produces reply content with one strategy
+type Generator struct {
+	strategy  string
+	maxLength int // Upper bound in bytes for truncate and template output (0 for unlimited)
+	template  *template.Template
+}
+
+// New creates a generator. maxLength bounds the truncate and template strategies
+// (truncate requires it); tmpl is only used by the template strategy (empty for
+// DefaultTemplate).
+func New(strategy string, maxLength int, tmpl string) (*Generator, error) {
+	if maxLength < 0 || (maxLength > 0 && maxLength <= len(ellipsis)) {
+		return nil, fmt.Errorf("max length must be 0 (unlimited) or above %d (got %d)", len(ellipsis), maxLength)
+	}
+	g := &Generator{strategy: strategy, maxLength: maxLength}
+	switch strategy {
+	case Wrap, Keep, Hash:
+	case Truncate:
+		if maxLength == 0 {
+			return nil, fmt.Errorf("strategy %q requires a max length", strategy)
+		}
+	case Template:
+		if tmpl == "" {
+			tmpl = DefaultTemplate
+		}
+		parsed, err := template.New("content").Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		// Render sample data so field typos are reported at startup, not on the first message
+		if err := parsed.Execute(&strings.Builder{}, Data{}); err != nil {
+			return nil, fmt.Errorf("invalid template: %w", err)
+		}
+		g.template = parsed
+	default:
+		return nil, fmt.Errorf("unknown strategy %q (use one of %s)", strategy, strings.Join(Strategies, ", "))
+	}
+	return g, nil
+}
+
+// Strategy returns the strategy name
+func (g *Generator) Strategy() string {
+	return g.strategy
+}
+
+// Next returns the content of the generated message described by data
+func (g *Generator) Next(data Data) (string, error) {
+	switch g.strategy {
+	case Keep:
+		return data.Previous, nil
+	case Hash:
+		sum := sha256.Sum256([]byte(data.Previous))
+		return "sha256:" + hex.EncodeToString(sum[:]), nil
+	case Template:
+		var b strings.Builder
+		if err := g.template.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("render content template: %w", err)
+		}
+		return limit(b.String(), g.maxLength), nil
+	case Truncate:
+		return limit(wrap(data), g.maxLength), nil
+	default:
+		return wrap(data), nil
+	}
+}
+
+// wrap returns the legacy "<Type> response to: <previous>" content
+func wrap(data Data) string {
+	label := string(data.Type)
+	if label != "" {
+		label = strings.ToUpper(label[:1]) + label[1:]
+	}
+	return label + " response to: " + data.Previous
+}
+
+// limit cuts s to at most maxLength bytes on a rune boundary, marking the cut
+func limit(s string, maxLength int) string {
+	if maxLength <= 0 || len(s) <= maxLength {
+		return s
+	}
+	cut := maxLength - len(ellipsis)
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + ellipsis
+}
@@ -0,0 +1,103 @@
+package content
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+func TestNext(t *testing.T) {
+	data := Data{Type: model.PongMessage, Server: "server2", Sequence: 7, Hop: 3, Chain: "3c7d", From: "server1", Previous: "Ping response to: héllo"}
+	tests := []struct {
+		name      string
+		strategy  string
+		maxLength int
+		template  string
+		data      Data
+		want      string
+	}{
+		{name: "wrap", strategy: Wrap, data: data, want: "Pong response to: Ping response to: héllo"},
+		{name: "wrap ignores the max length", strategy: Wrap, maxLength: 10, data: data, want: "Pong response to: Ping response to: héllo"},
+		{name: "wrap without a type", strategy: Wrap, data: Data{Previous: "x"}, want: " response to: x"},
+		{name: "keep", strategy: Keep, data: data, want: "Ping response to: héllo"},
+		{name: "hash", strategy: Hash, data: Data{Previous: "abc"}, want: "sha256:ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{name: "truncate below the limit", strategy: Truncate, maxLength: 100, data: data, want: "Pong response to: Ping response to: héllo"},
+		{name: "truncate at the limit", strategy: Truncate, maxLength: 21, data: data, want: "Pong response to: " + ellipsis},
+		{name: "truncate on a rune boundary", strategy: Truncate, maxLength: 41, data: data, want: "Pong response to: Ping response to: h" + ellipsis},
+		{name: "default template", strategy: Template, data: data, want: "pong #7 from server2 (hop 3)"},
+		{name: "custom template", strategy: Template, template: "{{.Chain}}/{{.From}}: {{len .Previous}}", data: data, want: "3c7d/server1: 24"},
+		{name: "template cut to the max length", strategy: Template, maxLength: 10, data: data, want: "pong #7" + ellipsis},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := New(tt.strategy, tt.maxLength, tt.template)
+			if err != nil {
+				t.Fatalf("New() = %v", err)
+			}
+			if g.Strategy() != tt.strategy {
+				t.Errorf("Strategy() = %q, want %q", g.Strategy(), tt.strategy)
+			}
+			got, err := g.Next(tt.data)
+			if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Next() = %q, want %q", got, tt.want)
+			}
+			if tt.maxLength > 0 && tt.strategy != Wrap && tt.strategy != Keep && len(got) > tt.maxLength {
+				t.Errorf("Next() is %d bytes, above the max length of %d", len(got), tt.maxLength)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("Next() = %q is not valid UTF-8", got)
+			}
+		})
+	}
+}
+
+func TestBoundedStrategiesStayBounded(t *testing.T) {
+	for _, strategy := range []string{Truncate, Template, Hash} {
+		t.Run(strategy, func(t *testing.T) {
+			g, err := New(strategy, 64, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			content := "Ping"
+			for hop := range 50 {
+				content, err = g.Next(Data{Type: model.PongMessage, Hop: hop, Previous: content})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if len(content) > 71 { // "sha256:" and 64 hex digits
+				t.Errorf("content grew to %d bytes after 50 hops", len(content))
+			}
+		})
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		strategy  string
+		maxLength int
+		template  string
+		wantErr   string
+	}{
+		{name: "unknown strategy", strategy: "shout", wantErr: "unknown strategy"},
+		{name: "truncate without a max length", strategy: Truncate, wantErr: "requires a max length"},
+		{name: "negative max length", strategy: Wrap, maxLength: -1, wantErr: "max length"},
+		{name: "max length too short for the ellipsis", strategy: Truncate, maxLength: len(ellipsis), wantErr: "max length"},
+		{name: "template syntax error", strategy: Template, template: "{{.Hop", wantErr: "invalid template"},
+		{name: "template field typo", strategy: Template, template: "{{.Hops}}", wantErr: "invalid template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.strategy, tt.maxLength, tt.template)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("New() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
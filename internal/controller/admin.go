@@ -0,0 +1,89 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/ryo-arima/magic-cylinder/internal/repository"
+)
+
+// adminController implements the AdminController interface
+type adminController struct {
+	health    repository.HealthRepository
+	peers     repository.PeerRepository
+	name      string    // Server name reported in responses
+	startedAt time.Time // Process start used for uptime
+}
+
+// NewAdminController creates a new admin controller
+func NewAdminController(health repository.HealthRepository, peers repository.PeerRepository, name string) AdminController {
+	return &adminController{
+		health:    health,
+		peers:     peers,
+		name:      name,
+		startedAt: time.Now(),
+	}
+}
+
+// HandleRuntime reports runtime and application counters as JSON
+func (c *adminController) HandleRuntime(w http.ResponseWriter, r *http.Request) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	now := time.Now()
+	stats := &response.RuntimeStats{
+		Server:         c.name,
+		StartedAt:      c.startedAt,
+		UptimeSeconds:  now.Sub(c.startedAt).Seconds(),
+		GoVersion:      runtime.Version(),
+		NumCPU:         runtime.NumCPU(),
+		GOMAXPROCS:     runtime.GOMAXPROCS(0),
+		Goroutines:     runtime.NumGoroutine(),
+		ActiveSessions: c.health.ActiveSessions(),
+		ActiveStreams:  c.health.ActiveStreams(),
+		InFlightEchoes: c.health.InFlightEchoes(),
+		Compression:    c.health.Compression(),
+		Peers:          c.peers.Peers(),
+		Senders:        c.peers.Senders(),
+		Memory: response.MemoryStats{
+			HeapAllocBytes:  mem.HeapAlloc,
+			HeapInuseBytes:  mem.HeapInuse,
+			HeapObjects:     mem.HeapObjects,
+			StackInuseBytes: mem.StackInuse,
+			SysBytes:        mem.Sys,
+			TotalAllocBytes: mem.TotalAlloc,
+			Mallocs:         mem.Mallocs,
+			Frees:           mem.Frees,
+		},
+		GC: response.GCStats{
+			NumGC:        mem.NumGC,
+			PauseTotalMs: float64(mem.PauseTotalNs) / 1e6,
+			NextGCBytes:  mem.NextGC,
+			CPUFraction:  mem.GCCPUFraction,
+		},
+		Time: now,
+	}
+	if mem.LastGC > 0 {
+		stats.GC.LastGC = time.Unix(0, int64(mem.LastGC))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(stats); err != nil {
+		log.Printf("[Admin] ❌ Failed to write runtime stats: %v", err)
+	}
+}
+
+// HandleGoroutines writes a full goroutine dump with stack traces
+func (c *adminController) HandleGoroutines(w http.ResponseWriter, r *http.Request) {
+	log.Printf("[Admin] Goroutine dump requested by %s (%d goroutines)", r.RemoteAddr, runtime.NumGoroutine())
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err := pprof.Lookup("goroutine").WriteTo(w, 2); err != nil {
+		log.Printf("[Admin] ❌ Failed to write goroutine dump: %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
+)
+
+// errRelayEnded closes the pipe of a target whose echo returned before reading the whole attachment
+var errRelayEnded = errors.New("echo to target ended")
+
+// checkAttachment parses the descriptor of an attachment message and checks it
+// against the attachments limits (ErrFrameTooLarge, wrapped, for oversized ones)
+func (c *commonController) checkAttachment(message *model.Message) (*model.Attachment, error) {
+	attachment, err := model.ParseAttachment(message.Content)
+	if err != nil {
+		return nil, err
+	}
+	if attachment.Size > c.attachments.MaxBytes {
+		return nil, fmt.Errorf("%w: attachment of %d bytes (limit %d)", transport.ErrFrameTooLarge, attachment.Size, c.attachments.MaxBytes)
+	}
+	if attachment.Chunk > c.attachments.ChunkBytes {
+		return nil, fmt.Errorf("%w: attachment chunks of %d bytes (limit %d)", transport.ErrFrameTooLarge, attachment.Chunk, c.attachments.ChunkBytes)
+	}
+	return attachment, nil
+}
+
+// relayAttachment reads the attachment following a message on the stream, verifying
+// each chunk, and streams it to the targets with reply as it arrives, so the whole
+// payload is never held in memory. The slowest target paces the reading; a target
+// that fails is dropped without affecting the others.
+func (c *commonController) relayAttachment(stream *webtransport.Stream, attachment *model.Attachment, reply *model.Message, targetURLs []string) error {
+	out := &fanout{}
+	for _, targetURL := range targetURLs {
+		if config.TargetTransport(targetURL) == config.TransportPlain {
+			log.Printf("[Controller] ⚠ Not relaying attachment to %s: attachments need a WebTransport target", targetURL)
+			continue
+		}
+		pr, pw := io.Pipe()
+		out.add(targetURL, pw)
+		go func() {
+			c.echoToTarget(targetURL, reply, pr, "[attachment] ")
+			pr.CloseWithError(errRelayEnded)
+		}()
+	}
+
+	log.Printf("[Controller] ⏳ Receiving %d-byte attachment %q in %d chunks on stream %d (relaying to %d targets)", attachment.Size, attachment.Name, attachment.Chunks(), stream.StreamID(), len(out.pipes))
+	started := time.Now()
+	chunks := transport.NewChunkReader(stream, attachment.Size, attachment.Chunk)
+	_, err := io.Copy(out, chunks)
+	if err == nil {
+		err = chunks.Verify(attachment.SHA256)
+	}
+	out.close(err)
+	if err != nil {
+		return fmt.Errorf("attachment %q: %w", attachment.Name, err)
+	}
+	elapsed := time.Since(started)
+	log.Printf("[Controller] ✅ Received attachment %q: %d bytes in %d chunks, %s (%.1f MiB/s), sha256 verified", attachment.Name, attachment.Size, chunks.Chunks(), elapsed.Round(time.Millisecond), float64(attachment.Size)/(1<<20)/elapsed.Seconds())
+	return nil
+}
+
+// fanout copies attachment data to the pipes of the forwarding targets
+type fanout struct {
+	targets []string
+	pipes   []*io.PipeWriter
+}
+
+// add registers the pipe of a target
+func (f *fanout) add(targetURL string, pipe *io.PipeWriter) {
+	f.targets = append(f.targets, targetURL)
+	f.pipes = append(f.pipes, pipe)
+}
+
+// Write copies p to every pipe, dropping those whose target stopped reading
+func (f *fanout) Write(p []byte) (int, error) {
+	for i := 0; i < len(f.pipes); {
+		if _, err := f.pipes[i].Write(p); err != nil {
+			log.Printf("[Controller] ⚠ Dropping attachment relay to %s: %v", f.targets[i], err)
+			f.targets = append(f.targets[:i], f.targets[i+1:]...)
+			f.pipes = append(f.pipes[:i], f.pipes[i+1:]...)
+			continue
+		}
+		i++
+	}
+	return len(p), nil
+}
+
+// close ends the attachment for every target: with io.EOF when err is nil,
+// otherwise with err so the targets reset their streams
+func (f *fanout) close(err error) {
+	for _, pipe := range f.pipes {
+		pipe.CloseWithError(err)
+	}
+}
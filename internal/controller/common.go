@@ -2,41 +2,162 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"net"
 	"net/http"
-	"strings"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/codec"
+	"github.com/ryo-arima/magic-cylinder/internal/compress"
+	"github.com/ryo-arima/magic-cylinder/internal/config"
 	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/ryo-arima/magic-cylinder/internal/handler"
+	"github.com/ryo-arima/magic-cylinder/internal/limit"
 	"github.com/ryo-arima/magic-cylinder/internal/repository"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
 // commonController implements the CommonController interface
 type commonController struct {
-	repo repository.CommonRepository
+	repo         repository.CommonRepository
+	events       repository.EventRepository
+	health       repository.HealthRepository
+	dedupe       repository.DedupeRepository
+	handlers     *handler.Registry   // Handlers of the accepted message types
+	name         string              // Server name recorded in published events
+	maxFrame     int                 // Largest message frame read from a stream
+	maxBody      int64               // Largest /plain request body
+	allowedPeers []string            // Sender names allowed to join the chain (empty allows any)
+	auth         *auth.Authenticator // Checks credentials of incoming messages (nil disables)
+	verifier     *signing.Verifier   // Checks message signatures (nil disables)
+	perClient    *limit.Limiter      // Sessions and messages per remote address (nil for unlimited)
+	perChain     *limit.Limiter      // Messages per chain (nil for unlimited)
+	sessions     *limit.Semaphore    // Concurrent WebTransport sessions (nil for unlimited)
+	echoes       *limit.Semaphore    // Concurrent echoes to targets (nil for unlimited)
+	maxStreams   int                 // Concurrent streams per session (0 for unlimited)
+	codecs       []string            // Codecs accepted from clients besides JSON
+	compression  []string            // Compression algorithms accepted from peers
+	threshold    int                 // Payloads smaller than this are sent uncompressed
+	attachments  config.AttachmentsConfig
+	state        repository.StateRepository   // Chains passing through this server, kept across restarts
+	resume       bool                         // Continue the saved chains at startup
+	resumeDelay  time.Duration                // Wait before resuming, so live chains are not resumed
+	started      time.Time                    // Chains updated since then are alive and not resumed
+	journal      repository.JournalRepository // Record of every message received and sent
 }
 
-// NewCommonController creates a new controller instance with repository dependency
-func NewCommonController(repo repository.CommonRepository) CommonController {
+// session is an accepted WebTransport session
+type session struct {
+	peer   *model.Peer // Identity proven by the client certificate (nil without one)
+	remote string      // Remote IP, the key of the per-client rate limit
+	addr   string      // Remote address with port, recorded in the journal
+	codec  codec.Codec // Codec negotiated for all streams of the session
+
+	compressor *compress.Compressor // Compression negotiated for the session (nil for none)
+}
+
+// eventDetails holds the optional fields of a published event
+type eventDetails struct {
+	signature string // Verification status of a received message ("" when not checked)
+	codec     string // Wire codec of the message
+	bytes     int    // Encoded size of the message
+
+	compression string // Compression negotiated for the payload ("" for none)
+	wireBytes   int    // Size on the wire when a compression was negotiated
+
+	remote   string // Remote address of the sender, or the target URL of an echo
+	streamID *int64 // Stream the message was received or answered on (nil for /plain)
+	code     string // Response code of a rejected message
+}
+
+// headerDuplicate marks a /plain response acknowledging a message that was already processed
+const headerDuplicate = "X-MC-Duplicate"
+
+// NewCommonController creates a new controller instance with repository dependencies
+func NewCommonController(repo repository.CommonRepository, events repository.EventRepository, health repository.HealthRepository, dedupe repository.DedupeRepository, state repository.StateRepository, journal repository.JournalRepository, handlers *handler.Registry, cfg *config.ServerConfig, authn *auth.Authenticator, verifier *signing.Verifier) CommonController {
 	return &commonController{
-		repo: repo,
+		repo:         repo,
+		events:       events,
+		health:       health,
+		dedupe:       dedupe,
+		handlers:     handlers,
+		name:         cfg.Name,
+		maxFrame:     cfg.Limits.MaxFrameBytes,
+		maxBody:      int64(cfg.Limits.MaxBodyBytes),
+		allowedPeers: cfg.TLS.AllowedPeers,
+		auth:         authn,
+		verifier:     verifier,
+		perClient:    limit.NewLimiter(cfg.Limits.ClientRate, cfg.Limits.ClientBurst),
+		perChain:     limit.NewLimiter(cfg.Limits.ChainRate, cfg.Limits.ChainBurst),
+		sessions:     limit.NewSemaphore(cfg.Limits.MaxSessions),
+		echoes:       limit.NewSemaphore(cfg.Limits.MaxInFlightEchoes),
+		maxStreams:   cfg.Limits.MaxStreamsPerSession,
+		codecs:       cfg.Encoding.Accept,
+		compression:  cfg.Compression.Accept,
+		threshold:    cfg.Compression.Threshold,
+		attachments:  cfg.Attachments,
+		state:        state,
+		resume:       cfg.State.Resume,
+		resumeDelay:  cfg.State.ResumeDelay.Std(),
+		started:      time.Now(),
+		journal:      journal,
 	}
 }
 
 // HandleWebTransport handles incoming WebTransport connection requests
-func (c *commonController) HandleWebTransport(server *webtransport.Server, w http.ResponseWriter, r *http.Request, targetURL string) {
+func (c *commonController) HandleWebTransport(server *webtransport.Server, w http.ResponseWriter, r *http.Request, targetURLs []string) {
 	log.Printf("[Controller] ============================================")
 	log.Printf("[Controller] New WebTransport connection request")
 	log.Printf("[Controller]   Remote Address: %s", r.RemoteAddr)
 	log.Printf("[Controller]   Method: %s", r.Method)
-	log.Printf("[Controller]   URL: %s", r.URL.String())
+	log.Printf("[Controller]   URL: %s", auth.RedactURL(r.URL))
 	log.Printf("[Controller]   Protocol: %s", r.Proto)
+	peer := model.PeerFromTLS(r.TLS)
+	log.Printf("[Controller]   Peer identity: %s", peer)
 	log.Printf("[Controller] ============================================")
 
+	if ok, retry := c.perClient.Allow(remoteHost(r.RemoteAddr)); !ok {
+		log.Printf("[Controller] ❌ Rejecting session from %s: client rate limit exceeded", r.RemoteAddr)
+		tooManyRequests(w, retry)
+		return
+	}
+	if err := c.auth.Verify(r, nil); err != nil {
+		log.Printf("[Controller] ❌ Rejecting session from %s: %v", r.RemoteAddr, err)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if peer == nil && len(c.allowedPeers) > 0 {
+		log.Printf("[Controller] ❌ Rejecting session from %s: no verified client certificate", r.RemoteAddr)
+		http.Error(w, "client certificate required", http.StatusForbidden)
+		return
+	}
+	if !c.sessions.TryAcquire() {
+		log.Printf("[Controller] ❌ Rejecting session from %s: %d sessions already open", r.RemoteAddr, c.sessions.Cap())
+		http.Error(w, "too many sessions", http.StatusServiceUnavailable)
+		return
+	}
+
+	wire := codec.Negotiate(r.Header.Get(codec.HeaderAvailableProtocols), c.codecs)
+	w.Header().Set(codec.HeaderProtocol, codec.FormatList(wire.Name()))
+	var compressor *compress.Compressor
+	if algorithm := compress.Negotiate(r.Header.Get(compress.HeaderAccept), c.compression); algorithm != "" {
+		compressor, _ = compress.New(algorithm, c.threshold)
+		w.Header().Set(compress.HeaderSelected, codec.FormatList(algorithm))
+	}
+
 	conn, err := server.Upgrade(w, r)
 	if err != nil {
+		c.sessions.Release()
 		log.Printf("[Controller] ❌ Failed to upgrade to WebTransport: %v", err)
 		log.Printf("[Controller]   Error details: %T", err)
 		http.Error(w, "Failed to upgrade", http.StatusInternalServerError)
@@ -45,95 +166,466 @@ func (c *commonController) HandleWebTransport(server *webtransport.Server, w htt
 
 	log.Printf("[Controller] ✅ WebTransport connection established successfully")
 	log.Printf("[Controller]   Connection ID: %p", conn)
-	log.Printf("[Controller]   Target URL for echo: %s", targetURL)
+	log.Printf("[Controller]   Codec: %s, compression: %s", wire.Name(), compressor.Name())
+	log.Printf("[Controller]   Target URLs for echo: %v", targetURLs)
 
-	go c.handleConnection(conn, targetURL)
+	go c.handleConnection(conn, &session{peer: peer, remote: remoteHost(r.RemoteAddr), addr: r.RemoteAddr, codec: wire, compressor: compressor}, targetURLs)
 }
 
-// HandlePlain handles plaintext POST /plain requests by reading a JSON message,
-// generating the next message via repository, replying with JSON, and echoing
-// to the target using plaintext or WebTransport depending on target URL scheme.
-func (c *commonController) HandlePlain(w http.ResponseWriter, r *http.Request, targetURL string) {
+// HandlePlain handles plaintext POST /plain requests by reading a request envelope in
+// the codec of its Content-Type, generating the next message via repository, replying
+// with a response envelope in the codec of the Accept header (or the request's), and
+// echoing to the target using plaintext or WebTransport depending on target URL scheme.
+// Rejected requests get a failed response envelope with an error code.
+func (c *commonController) HandlePlain(w http.ResponseWriter, r *http.Request, targetURLs []string) {
 	log.Printf("[Controller] (plain) ============================================")
 	log.Printf("[Controller] (plain) New plaintext request")
 	log.Printf("[Controller] (plain)   Remote Address: %s", r.RemoteAddr)
 	log.Printf("[Controller] (plain)   Method: %s", r.Method)
-	log.Printf("[Controller] (plain)   URL: %s", r.URL.String())
+	log.Printf("[Controller] (plain)   URL: %s", auth.RedactURL(r.URL))
+	peer := model.PeerFromTLS(r.TLS)
+	log.Printf("[Controller] (plain)   Peer identity: %s", peer)
+
+	replyCodec, replyAccepted := codec.FromAccept(r.Header.Get("Accept"), c.codecs)
+	if !replyAccepted {
+		replyCodec = codec.JSON
+	}
+	var msg *model.Message // Set once decoded, so that rejections are journaled with it
+	reject := func(status int, code string, reason string) {
+		resp := response.NewErrorResponse(code, reason)
+		c.writePlainResponse(w, r, replyCodec, status, resp)
+		if msg != nil {
+			c.rejected("plain", msg, resp, eventDetails{remote: r.RemoteAddr})
+		}
+	}
 
-	body, err := io.ReadAll(r.Body)
+	if ok, retry := c.perClient.Allow(remoteHost(r.RemoteAddr)); !ok {
+		log.Printf("[Controller] (plain) ❌ Rejecting request from %s: client rate limit exceeded", r.RemoteAddr)
+		c.rateLimitedPlain(w, r, replyCodec, nil, retry)
+		return
+	}
+
+	wire, ok := codec.ByContentType(r.Header.Get("Content-Type"))
+	if ok {
+		_, ok = codec.Accepted(wire.Name(), c.codecs)
+	}
+	if !ok {
+		log.Printf("[Controller] (plain) ❌ Rejecting request from %s: unsupported Content-Type %q", r.RemoteAddr, r.Header.Get("Content-Type"))
+		reject(http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, fmt.Sprintf("unsupported Content-Type %q", r.Header.Get("Content-Type")))
+		return
+	}
+	if !replyAccepted {
+		replyCodec = wire
+	}
+	encoding := r.Header.Get("Content-Encoding")
+	if encoding != "" && compress.Negotiate(encoding, c.compression) == "" {
+		log.Printf("[Controller] (plain) ❌ Rejecting request from %s: unsupported Content-Encoding %q", r.RemoteAddr, encoding)
+		reject(http.StatusUnsupportedMediaType, response.CodeUnsupportedMedia, fmt.Sprintf("unsupported Content-Encoding %q", encoding))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, c.maxBody))
 	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			log.Printf("[Controller] (plain) ❌ Rejecting request from %s: body exceeds %d bytes", r.RemoteAddr, tooLarge.Limit)
+			reject(http.StatusRequestEntityTooLarge, response.CodeTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit))
+			return
+		}
 		log.Printf("[Controller] (plain) ❌ Failed to read body: %v", err)
-		http.Error(w, "failed to read body", http.StatusBadRequest)
+		reject(http.StatusBadRequest, response.CodeInvalidMessage, "failed to read body")
 		return
 	}
 	defer r.Body.Close()
 
-	msg, err := model.FromJSON(body)
+	if err := c.auth.Verify(r, body); err != nil {
+		log.Printf("[Controller] (plain) ❌ Rejecting request from %s: %v", r.RemoteAddr, err)
+		reject(http.StatusUnauthorized, response.CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	received := eventDetails{codec: wire.Name(), bytes: len(body), remote: r.RemoteAddr}
+	if encoding != "" {
+		wireBytes := len(body)
+		if body, err = compress.Decompress(encoding, body, int(c.maxBody)); err != nil {
+			log.Printf("[Controller] (plain) ❌ Failed to decompress %s body: %v", encoding, err)
+			if errors.Is(err, compress.ErrTooLarge) {
+				reject(http.StatusRequestEntityTooLarge, response.CodeTooLarge, err.Error())
+			} else {
+				reject(http.StatusBadRequest, response.CodeInvalidMessage, err.Error())
+			}
+			return
+		}
+		c.health.RecordCompression(encoding, len(body), wireBytes)
+		received = eventDetails{codec: wire.Name(), bytes: len(body), compression: encoding, wireBytes: wireBytes, remote: r.RemoteAddr}
+	}
+
+	req, err := wire.UnmarshalRequest(body)
+	if err != nil {
+		log.Printf("[Controller] (plain) ❌ Failed to parse %s request: %v", wire.Name(), err)
+		reject(http.StatusBadRequest, decodeErrorCode(err), err.Error())
+		return
+	}
+	msg = req.Message
+
+	if err := c.checkSender(peer, msg.From); err != nil {
+		log.Printf("[Controller] (plain) ❌ Rejecting message: %v", err)
+		reject(http.StatusForbidden, response.CodeForbidden, "sender not authorized")
+		return
+	}
+	signature, err := c.verifySignature(msg)
+	if err != nil {
+		log.Printf("[Controller] (plain) ❌ Rejecting message: %v", err)
+		reject(http.StatusForbidden, response.CodeBadSignature, "invalid message signature")
+		return
+	}
+	if _, err := c.handlers.Lookup(msg.Type); err != nil {
+		log.Printf("[Controller] (plain) ❌ Rejecting message: %v", err)
+		reject(http.StatusBadRequest, response.CodeUnsupportedType, err.Error())
+		return
+	}
+	if msg.Type == model.AttachmentMessage {
+		log.Printf("[Controller] (plain) ❌ Rejecting attachment: attachments are streamed over WebTransport only")
+		reject(http.StatusBadRequest, response.CodeInvalidMessage, "attachments need a WebTransport stream")
+		return
+	}
+	if ok, retry := c.perChain.Allow(msg.ChainKey()); !ok {
+		log.Printf("[Controller] (plain) ❌ Rejecting message: chain %s rate limit exceeded", msg.ChainKey())
+		c.rateLimitedPlain(w, r, replyCodec, msg, retry)
+		return
+	}
+	duplicate, original, err := c.dedupe.Begin(msg)
+	var full *repository.FullError
+	if errors.As(err, &full) {
+		log.Printf("[Controller] (plain) ❌ Rejecting message: %v", err)
+		c.rateLimitedPlain(w, r, replyCodec, msg, full.RetryAfter)
+		return
+	}
 	if err != nil {
-		log.Printf("[Controller] (plain) ❌ Failed to parse JSON: %v", err)
-		http.Error(w, "invalid json", http.StatusBadRequest)
+		log.Printf("[Controller] (plain) ❌ Rejecting message: %v", err)
+		reject(dedupeStatus(err), response.CodeReplay, err.Error())
+		return
+	}
+	if duplicate {
+		log.Printf("[Controller] (plain) ⚠ Duplicate message %s from %s, acknowledging without processing", msg.ID, msg.From)
+		received.signature = signature
+		c.publish(model.EventDuplicate, "plain", msg.From+" -> "+c.name, msg, 0, nil, received)
+		w.Header().Set(headerDuplicate, "true")
+		ack := response.NewPingResponse(original)
+		ack.Duplicate = true
+		status := http.StatusOK
+		if original == nil {
+			// The original is still being processed; its response goes to the first sender
+			status = http.StatusAccepted
+		}
+		c.writePlainResponse(w, r, replyCodec, status, ack)
 		return
 	}
 
 	log.Printf("[Controller] (plain)[RAW] %s", msg.Content)
+	receivedAt := time.Now()
+	received.signature = signature
+	c.publish(model.EventReceived, "plain", msg.From+" -> "+c.name, msg, receivedAt.Sub(msg.Timestamp), nil, received)
 
-	var resp *model.Message
-	if msg.Type == model.PingMessage {
-		log.Printf("[Controller] (plain) Routing to HandlePing...")
-		resp, err = c.HandlePing(msg)
-	} else {
-		log.Printf("[Controller] (plain) Routing to HandlePong...")
-		resp, err = c.HandlePong(msg)
-	}
+	log.Printf("[Controller] (plain) Routing %s message to its handler...", msg.Type)
+	result, err := c.HandleMessage(msg)
 	if err != nil {
+		c.dedupe.Abort(msg)
 		log.Printf("[Controller] (plain) ❌ Handler failed: %v", err)
-		http.Error(w, "handler error", http.StatusInternalServerError)
+		if errors.Is(err, model.ErrInvalidMessage) {
+			reject(http.StatusBadRequest, response.CodeInvalidMessage, err.Error())
+			return
+		}
+		reject(http.StatusInternalServerError, response.CodeInternal, "handler error")
 		return
 	}
+	resp := result.Reply
+	c.dedupe.Complete(msg, resp)
 
-	data, err := resp.ToJSON()
+	log.Printf("[Controller] (plain)[RAW] %s", resp.Content)
+	responded, err := c.writePlainResponse(w, r, replyCodec, http.StatusOK, response.NewPingResponse(resp))
+	if err != nil {
+		return
+	}
+	c.publish(model.EventResponded, "plain", c.name+" -> "+msg.From, resp, time.Since(receivedAt), nil, responded)
+
+	if !result.Forward {
+		log.Printf("[Controller] (plain) %s reply is not forwarded, skipping echo", resp.Type)
+		return
+	}
+	for _, targetURL := range targetURLs {
+		log.Printf("[Controller] (plain) Triggering echo to target: %s", targetURL)
+		go c.echoToTarget(targetURL, resp, nil, "(plain) ")
+	}
+}
+
+// echoToTarget forwards the message to the target using plaintext or WebTransport
+// depending on the target URL, followed by the attachment payload if it is not nil,
+// and publishes the outcome with its round-trip time
+func (c *commonController) echoToTarget(targetURL string, message *model.Message, attachment io.Reader, logPrefix string) {
+	transport := config.TargetTransport(targetURL)
+	plain := transport == config.TransportPlain
+	hop := c.name + " -> " + targetURL
+
+	if !c.echoes.TryAcquire() {
+		err := fmt.Errorf("dropped: %d echoes already in flight", c.echoes.Cap())
+		log.Printf("[Controller] %s❌ Echo to target %s %v", logPrefix, targetURL, err)
+		c.publish(model.EventEchoFailed, transport, hop, message, 0, err, eventDetails{remote: targetURL})
+		return
+	}
+	defer c.echoes.Release()
+	c.health.EchoStarted()
+	defer c.health.EchoFinished()
+
+	started := time.Now()
+	var result response.EchoResult
+	var echoErr error
+	switch {
+	case attachment != nil:
+		result, echoErr = c.repo.SendAttachmentToTarget(targetURL, message, attachment)
+	case plain:
+		result, echoErr = c.repo.SendPlainEchoToTarget(targetURL, message)
+	default:
+		result, echoErr = c.repo.SendEchoToTarget(targetURL, message)
+	}
+	details := eventDetails{codec: result.Codec, bytes: result.Bytes, compression: result.Compression, wireBytes: result.WireBytes, remote: targetURL}
+	if result.Compression != "" && result.WireBytes > 0 {
+		c.health.RecordCompression(result.Compression, result.Bytes, result.WireBytes)
+	}
+	if echoErr != nil {
+		log.Printf("[Controller] %s❌ Echo to target %s failed: %v", logPrefix, targetURL, echoErr)
+		c.publish(model.EventEchoFailed, transport, hop, message, time.Since(started), echoErr, details)
+		return
+	}
+	if result.Compression != "" {
+		log.Printf("[Controller] %s✅ Echo to target %s completed successfully (%s, %d bytes, %s %d bytes on the wire)", logPrefix, targetURL, result.Codec, result.Bytes, result.Compression, result.WireBytes)
+	} else {
+		log.Printf("[Controller] %s✅ Echo to target %s completed successfully (%s, %d bytes)", logPrefix, targetURL, result.Codec, result.Bytes)
+	}
+	c.publish(model.EventEchoSent, transport, hop, message, time.Since(started), nil, details)
+}
+
+// writePlainResponse writes a response envelope as the /plain response body. It only
+// fails (after answering 500) when the envelope cannot be encoded.
+func (c *commonController) writePlainResponse(w http.ResponseWriter, r *http.Request, wire codec.Codec, status int, resp *response.PingResponse) (eventDetails, error) {
+	data, err := wire.MarshalResponse(resp)
 	if err != nil {
 		log.Printf("[Controller] (plain) ❌ Failed to marshal response: %v", err)
 		http.Error(w, "marshal error", http.StatusInternalServerError)
-		return
+		return eventDetails{}, err
 	}
-	log.Printf("[Controller] (plain)[RAW] %s", resp.Content)
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	return c.writePlain(w, r, wire, status, data), nil
+}
+
+// rateLimitedPlain answers a rate-limited /plain request with 429, a Retry-After
+// header and the delay in the response envelope, journaling the message if it was decoded
+func (c *commonController) rateLimitedPlain(w http.ResponseWriter, r *http.Request, wire codec.Codec, message *model.Message, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(retry)))
+	resp := rateLimited(retry)
+	c.writePlainResponse(w, r, wire, http.StatusTooManyRequests, resp)
+	if message != nil {
+		c.rejected("plain", message, resp, eventDetails{remote: r.RemoteAddr})
+	}
+}
+
+// writePlain writes a /plain response body in the codec, compressed with the first
+// accepted algorithm of the Accept-Encoding header when it is worthwhile
+func (c *commonController) writePlain(w http.ResponseWriter, r *http.Request, wire codec.Codec, status int, data []byte) eventDetails {
+	details := eventDetails{codec: wire.Name(), bytes: len(data), remote: r.RemoteAddr}
+	w.Header().Set("Content-Type", wire.ContentType())
+	if len(c.compression) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if algorithm := compress.Negotiate(r.Header.Get("Accept-Encoding"), c.compression); algorithm != "" {
+		compressor, _ := compress.New(algorithm, c.threshold)
+		compressed, err := compressor.Compress(data)
+		if err != nil {
+			log.Printf("[Controller] (plain) ⚠ Failed to compress response, sending it uncompressed: %v", err)
+		}
+		if compressed != nil {
+			w.Header().Set("Content-Encoding", algorithm)
+			data = compressed
+		}
+		c.health.RecordCompression(algorithm, details.bytes, len(data))
+		details.compression, details.wireBytes = algorithm, len(data)
+	}
+	w.WriteHeader(status)
 	if _, err := w.Write(data); err != nil {
 		log.Printf("[Controller] (plain) ❌ Failed to write response: %v", err)
 	}
+	return details
+}
 
-	if targetURL != "" {
-		log.Printf("[Controller] (plain) Triggering echo to target: %s", targetURL)
-		go func() {
-			var echoErr error
-			if strings.HasPrefix(targetURL, "http://") || strings.HasPrefix(targetURL, "https://") {
-				echoErr = c.repo.SendPlainEchoToTarget(targetURL, resp)
-			} else {
-				echoErr = c.repo.SendEchoToTarget(targetURL, resp)
-			}
-			if echoErr != nil {
-				log.Printf("[Controller] (plain) ❌ Echo to target %s failed: %v", targetURL, echoErr)
-			} else {
-				log.Printf("[Controller] (plain) ✅ Echo to target %s completed successfully", targetURL)
-			}
-		}()
+// encodeFrame encodes a response envelope for a stream of the session, compressed when negotiated
+func (c *commonController) encodeFrame(sess *session, resp *response.PingResponse) ([]byte, eventDetails, error) {
+	data, err := sess.codec.MarshalResponse(resp)
+	if err != nil {
+		return nil, eventDetails{}, fmt.Errorf("failed to marshal response: %w", err)
+	}
+	details := eventDetails{codec: sess.codec.Name(), bytes: len(data)}
+	frame, err := sess.compressor.EncodeFrame(data)
+	if err != nil {
+		return nil, details, fmt.Errorf("failed to compress response: %w", err)
+	}
+	if sess.compressor != nil {
+		c.health.RecordCompression(sess.compressor.Name(), len(data), len(frame))
+		details.compression, details.wireBytes = sess.compressor.Name(), len(frame)
+	}
+	return frame, details, nil
+}
+
+// writeStream writes a response envelope to a stream of the session as one frame
+func (c *commonController) writeStream(stream *webtransport.Stream, sess *session, resp *response.PingResponse) (eventDetails, error) {
+	frame, details, err := c.encodeFrame(sess, resp)
+	details.remote, details.streamID = sess.addr, streamID(stream)
+	if err != nil {
+		return details, err
+	}
+	return details, transport.WriteFrame(stream, frame)
+}
+
+// rejectStream answers a stream with a failed response envelope and stops reading
+// it with the stream error code; the caller closes the stream. The message, nil
+// when the frame did not decode, is journaled as rejected.
+func (c *commonController) rejectStream(stream *webtransport.Stream, sess *session, code webtransport.StreamErrorCode, message *model.Message, resp *response.PingResponse) {
+	if _, err := c.writeStream(stream, sess, resp); err != nil {
+		log.Printf("[Controller] ⚠ Failed to send %s error on stream %d: %v", resp.Code, stream.StreamID(), err)
+	}
+	stream.CancelRead(code)
+	if message != nil {
+		c.rejected("webtransport", message, resp, eventDetails{remote: sess.addr, streamID: streamID(stream)})
+	}
+}
+
+// rejected publishes a message that was answered with a failed response envelope
+func (c *commonController) rejected(transport string, message *model.Message, resp *response.PingResponse, details eventDetails) {
+	details.code = resp.Code
+	c.publish(model.EventRejected, transport, message.From+" -> "+c.name, message, 0, errors.New(resp.Error), details)
+}
+
+// streamID returns the ID of a stream as recorded in the journal
+func streamID(stream *webtransport.Stream) *int64 {
+	id := int64(stream.StreamID())
+	return &id
+}
+
+// checkSender verifies that the message sender is the peer proven by the client certificate
+// (its CN or a DNS SAN) and, if configured, an allowed peer. Senders without a certificate
+// are only accepted when no allowed peers are configured.
+func (c *commonController) checkSender(peer *model.Peer, from string) error {
+	if peer == nil {
+		if len(c.allowedPeers) > 0 {
+			return fmt.Errorf("sender %q presented no verified client certificate", from)
+		}
+		return nil
+	}
+	if !peer.Matches(from) {
+		return fmt.Errorf("sender %q does not match client certificate (%s)", from, peer)
+	}
+	if len(c.allowedPeers) > 0 && !slices.Contains(c.allowedPeers, from) {
+		return fmt.Errorf("sender %q is not an allowed peer", from)
+	}
+	return nil
+}
+
+// verifySignature checks the signature of a received message against the sender's key.
+// It returns the status recorded on the received event, and an error when the
+// message must be rejected; under the flag policy problems are only logged.
+func (c *commonController) verifySignature(message *model.Message) (string, error) {
+	if c.verifier == nil {
+		return "", nil
+	}
+	err := c.verifier.Verify(message)
+	if c.verifier.Rejects(err) {
+		return "", fmt.Errorf("signature check failed for sender %q: %w", message.From, err)
+	}
+	if err != nil {
+		log.Printf("[Controller] ⚠ Flagging %s message seq %d from %s: %v", message.Type, message.Sequence, message.From, err)
+	}
+	return signing.Status(err), nil
+}
+
+// remoteHost returns the IP of a remote address, the key of the per-client rate limit
+func remoteHost(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// dedupeStatus maps a dedupe rejection to an HTTP status
+func dedupeStatus(err error) int {
+	if errors.Is(err, repository.ErrMissingID) {
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
+}
+
+// tooManyRequests replies 429 with a Retry-After header in whole seconds
+func tooManyRequests(w http.ResponseWriter, retry time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(retrySeconds(retry)))
+	http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+}
+
+// retrySeconds rounds a retry delay up to whole seconds
+func retrySeconds(retry time.Duration) int {
+	return int(math.Ceil(retry.Seconds()))
+}
+
+// rateLimited returns the failed response envelope of a rate-limited message
+func rateLimited(retry time.Duration) *response.PingResponse {
+	resp := response.NewErrorResponse(response.CodeRateLimited, "rate limit exceeded")
+	resp.RetryAfter = retrySeconds(retry)
+	return resp
+}
+
+// decodeErrorCode maps a request decoding error to a response error code
+func decodeErrorCode(err error) string {
+	if errors.Is(err, model.ErrUnsupportedVersion) {
+		return response.CodeUnsupportedVersion
+	}
+	return response.CodeInvalidMessage
+}
+
+// publish sends an event to the live event feed and the journal when they are configured
+func (c *commonController) publish(kind model.EventKind, transport, hop string, message *model.Message, latency time.Duration, err error, details eventDetails) {
+	if c.events == nil && c.journal == nil {
+		return
+	}
+	event := model.NewEvent(kind, c.name, transport, hop, message, latency)
+	if err != nil {
+		event.Error = err.Error()
+	}
+	event.Signature = details.signature
+	event.Codec = details.codec
+	event.Bytes = details.bytes
+	event.Compression = details.compression
+	event.WireBytes = details.wireBytes
+	if c.events != nil {
+		c.events.Publish(event)
+	}
+	if c.journal != nil {
+		c.journal.Record(model.NewJournalEntry(event, details.remote, details.streamID, details.code))
 	}
 }
 
 // handleConnection manages the lifecycle of a WebTransport connection
-func (c *commonController) handleConnection(conn *webtransport.Session, targetURL string) {
+func (c *commonController) handleConnection(conn *webtransport.Session, sess *session, targetURLs []string) {
 	log.Printf("[Controller] Starting connection handler goroutine")
 	log.Printf("[Controller]   Connection: %p", conn)
 
+	c.health.SessionOpened()
 	defer func() {
+		c.sessions.Release()
+		c.health.SessionClosed()
 		log.Printf("[Controller] Closing connection: %p", conn)
 		conn.CloseWithError(0, "connection closed")
 		log.Printf("[Controller] Connection closed successfully")
 	}()
 
 	log.Printf("[Controller] Waiting for incoming streams...")
+	streams := limit.NewSemaphore(c.maxStreams)
 
 	for {
 		stream, err := conn.AcceptStream(context.Background())
@@ -143,33 +635,78 @@ func (c *commonController) handleConnection(conn *webtransport.Session, targetUR
 			return
 		}
 
+		if !streams.TryAcquire() {
+			log.Printf("[Controller] ❌ Rejecting stream %d: %d streams already open in this session", stream.StreamID(), streams.Cap())
+			reason := fmt.Sprintf("%d streams already open in this session", streams.Cap())
+			go func() {
+				defer stream.Close()
+				c.rejectStream(stream, sess, transport.StreamErrorTooManyStreams, nil, response.NewErrorResponse(response.CodeTooManyStreams, reason))
+			}()
+			continue
+		}
+
 		log.Printf("[Controller] ✅ Stream accepted successfully: %d", stream.StreamID())
-		go c.handleStream(stream, targetURL)
+		go func() {
+			defer streams.Release()
+			c.handleStream(stream, sess, targetURLs)
+		}()
 	}
 }
 
-// handleStream processes an individual stream within a WebTransport connection
-func (c *commonController) handleStream(stream *webtransport.Stream, targetURL string) {
+// handleStream processes an individual stream within a WebTransport connection.
+// Rejected messages are answered with a failed response envelope.
+func (c *commonController) handleStream(stream *webtransport.Stream, sess *session, targetURLs []string) {
+	c.health.StreamOpened()
+	defer c.health.StreamClosed()
 	defer stream.Close()
 
 	log.Printf("[Controller] ==========================================")
 	log.Printf("[Controller] Processing new stream: %d", stream.StreamID())
 
-	buffer := make([]byte, 4096)
-	n, err := stream.Read(buffer)
-	if err != nil && err != io.EOF {
+	if ok, retry := c.perClient.Allow(sess.remote); !ok {
+		log.Printf("[Controller] ❌ Rejecting stream %d from %s: client rate limit exceeded", stream.StreamID(), sess.remote)
+		c.rejectStream(stream, sess, transport.StreamErrorRateLimited, nil, rateLimited(retry))
+		return
+	}
+
+	frame, err := transport.ReadFrame(stream, c.maxFrame)
+	if err != nil {
 		log.Printf("[Controller] ❌ Failed to read from stream %d: %v", stream.StreamID(), err)
+		if errors.Is(err, transport.ErrFrameTooLarge) {
+			c.rejectStream(stream, sess, transport.StreamErrorFrameTooLarge, nil, response.NewErrorResponse(response.CodeTooLarge, err.Error()))
+		} else {
+			// Truncated frame, bad length prefix, empty stream or reset by the peer
+			c.rejectStream(stream, sess, transport.StreamErrorInvalidMessage, nil, response.NewErrorResponse(response.CodeInvalidMessage, "failed to read frame: "+err.Error()))
+		}
 		return
 	}
 
-	log.Printf("[Controller] Read %d bytes from stream %d", n, stream.StreamID())
+	log.Printf("[Controller] Read %d bytes from stream %d", len(frame), stream.StreamID())
+
+	payload, err := sess.compressor.DecodeFrame(frame, c.maxFrame)
+	if err != nil {
+		log.Printf("[Controller] ❌ Failed to decompress frame from stream %d: %v", stream.StreamID(), err)
+		if errors.Is(err, compress.ErrTooLarge) {
+			c.rejectStream(stream, sess, transport.StreamErrorFrameTooLarge, nil, response.NewErrorResponse(response.CodeTooLarge, err.Error()))
+		} else {
+			c.rejectStream(stream, sess, transport.StreamErrorInvalidMessage, nil, response.NewErrorResponse(response.CodeInvalidMessage, err.Error()))
+		}
+		return
+	}
+	received := eventDetails{codec: sess.codec.Name(), bytes: len(payload), remote: sess.addr, streamID: streamID(stream)}
+	if sess.compressor != nil {
+		c.health.RecordCompression(sess.compressor.Name(), len(payload), len(frame))
+		received.compression, received.wireBytes = sess.compressor.Name(), len(frame)
+	}
 
-	message, err := model.FromJSON(buffer[:n])
+	req, err := sess.codec.UnmarshalRequest(payload)
 	if err != nil {
-		log.Printf("[Controller] ❌ Failed to parse message from stream %d: %v", stream.StreamID(), err)
-		log.Printf("[Controller]   Raw data: %s", string(buffer[:n]))
+		log.Printf("[Controller] ❌ Failed to parse %s request from stream %d: %v", sess.codec.Name(), stream.StreamID(), err)
+		log.Printf("[Controller]   Raw data: %q", payload)
+		c.rejectStream(stream, sess, transport.StreamErrorInvalidMessage, nil, response.NewErrorResponse(decodeErrorCode(err), err.Error()))
 		return
 	}
+	message := req.Message
 
 	log.Printf("[Controller] ✅ Received %s message on stream %d", message.Type, stream.StreamID())
 	log.Printf("[Controller]   Content: %s", message.Content)
@@ -178,57 +715,128 @@ func (c *commonController) handleStream(stream *webtransport.Stream, targetURL s
 	log.Printf("[Controller]   To: %s", message.To)
 	log.Printf("[Controller][RAW] %s", message.Content)
 
-	var response *model.Message
-	if message.Type == model.PingMessage {
-		log.Printf("[Controller] Routing to HandlePing...")
-		response, err = c.HandlePing(message)
-	} else {
-		log.Printf("[Controller] Routing to HandlePong...")
-		response, err = c.HandlePong(message)
+	if err := c.checkSender(sess.peer, message.From); err != nil {
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: %v", stream.StreamID(), err)
+		c.rejectStream(stream, sess, transport.StreamErrorUnauthorized, message, response.NewErrorResponse(response.CodeForbidden, "sender not authorized"))
+		return
 	}
-
+	signature, err := c.verifySignature(message)
 	if err != nil {
-		log.Printf("[Controller] ❌ Failed to handle message: %v", err)
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: %v", stream.StreamID(), err)
+		c.rejectStream(stream, sess, transport.StreamErrorBadSignature, message, response.NewErrorResponse(response.CodeBadSignature, "invalid message signature"))
+		return
+	}
+	if _, err := c.handlers.Lookup(message.Type); err != nil {
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: %v", stream.StreamID(), err)
+		c.rejectStream(stream, sess, transport.StreamErrorUnsupportedType, message, response.NewErrorResponse(response.CodeUnsupportedType, err.Error()))
+		return
+	}
+	var attachment *model.Attachment
+	if message.Type == model.AttachmentMessage {
+		if attachment, err = c.checkAttachment(message); err != nil {
+			log.Printf("[Controller] ❌ Rejecting attachment on stream %d: %v", stream.StreamID(), err)
+			if errors.Is(err, transport.ErrFrameTooLarge) {
+				c.rejectStream(stream, sess, transport.StreamErrorFrameTooLarge, message, response.NewErrorResponse(response.CodeTooLarge, err.Error()))
+			} else {
+				c.rejectStream(stream, sess, transport.StreamErrorInvalidMessage, message, response.NewErrorResponse(response.CodeInvalidMessage, err.Error()))
+			}
+			return
+		}
+	}
+	if ok, retry := c.perChain.Allow(message.ChainKey()); !ok {
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: chain %s rate limit exceeded", stream.StreamID(), message.ChainKey())
+		c.rejectStream(stream, sess, transport.StreamErrorRateLimited, message, rateLimited(retry))
+		return
+	}
+	duplicate, original, err := c.dedupe.Begin(message)
+	var full *repository.FullError
+	if errors.As(err, &full) {
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: %v", stream.StreamID(), err)
+		c.rejectStream(stream, sess, transport.StreamErrorRateLimited, message, rateLimited(full.RetryAfter))
+		return
+	}
+	if err != nil {
+		log.Printf("[Controller] ❌ Rejecting message on stream %d: %v", stream.StreamID(), err)
+		c.rejectStream(stream, sess, transport.StreamErrorReplay, message, response.NewErrorResponse(response.CodeReplay, err.Error()))
 		return
 	}
+	if duplicate {
+		log.Printf("[Controller] ⚠ Duplicate message %s from %s on stream %d, acknowledging without processing", message.ID, message.From, stream.StreamID())
+		received.signature = signature
+		c.publish(model.EventDuplicate, "webtransport", message.From+" -> "+c.name, message, 0, nil, received)
+		ack := response.NewPingResponse(original)
+		ack.Duplicate = true
+		if _, err := c.writeStream(stream, sess, ack); err != nil {
+			log.Printf("[Controller] ❌ Failed to acknowledge duplicate on stream %d: %v", stream.StreamID(), err)
+		}
+		if attachment != nil {
+			stream.CancelRead(transport.StreamErrorAttachment)
+		}
+		return
+	}
+	receivedAt := time.Now()
+	received.signature = signature
+	c.publish(model.EventReceived, "webtransport", message.From+" -> "+c.name, message, receivedAt.Sub(message.Timestamp), nil, received)
 
-	responseData, err := response.ToJSON()
+	log.Printf("[Controller] Routing %s message to its handler...", message.Type)
+	result, err := c.HandleMessage(message)
 	if err != nil {
-		log.Printf("[Controller] ❌ Failed to marshal response: %v", err)
+		c.dedupe.Abort(message)
+		log.Printf("[Controller] ❌ Failed to handle message: %v", err)
+		if errors.Is(err, model.ErrInvalidMessage) {
+			c.rejectStream(stream, sess, transport.StreamErrorInvalidMessage, message, response.NewErrorResponse(response.CodeInvalidMessage, err.Error()))
+			return
+		}
+		resp := response.NewErrorResponse(response.CodeInternal, "handler error")
+		if _, err := c.writeStream(stream, sess, resp); err != nil {
+			log.Printf("[Controller] ❌ Failed to write error response to stream %d: %v", stream.StreamID(), err)
+		}
+		c.rejected("webtransport", message, resp, eventDetails{remote: sess.addr, streamID: streamID(stream)})
 		return
 	}
+	reply := result.Reply
+	if attachment != nil {
+		relayTo := targetURLs
+		if !result.Forward {
+			relayTo = nil
+		}
+		if err := c.relayAttachment(stream, attachment, reply, relayTo); err != nil {
+			c.dedupe.Abort(message)
+			log.Printf("[Controller] ❌ Failed to receive attachment on stream %d: %v", stream.StreamID(), err)
+			c.rejectStream(stream, sess, transport.StreamErrorAttachment, message, response.NewErrorResponse(response.CodeInvalidMessage, err.Error()))
+			return
+		}
+		result.Forward = false // Already streamed to the targets
+	}
+	c.dedupe.Complete(message, reply)
 
-	_, err = stream.Write(responseData)
+	responded, err := c.writeStream(stream, sess, response.NewPingResponse(reply))
 	if err != nil {
 		log.Printf("[Controller] ❌ Failed to write response to stream %d: %v", stream.StreamID(), err)
 		return
 	}
 
-	log.Printf("[Controller] ✅ Sent %s message on stream %d", response.Type, stream.StreamID())
-	log.Printf("[Controller]   Content: %s", response.Content)
-	log.Printf("[Controller]   Sequence: %d", response.Sequence)
-	log.Printf("[Controller]   From: %s", response.From)
-	log.Printf("[Controller]   To: %s", response.To)
-	log.Printf("[Controller][RAW] %s", response.Content)
-
-	// Echo message to target server if targetURL is provided
-	if targetURL != "" {
+	log.Printf("[Controller] ✅ Sent %s message on stream %d", reply.Type, stream.StreamID())
+	log.Printf("[Controller]   Content: %s", reply.Content)
+	log.Printf("[Controller]   Sequence: %d", reply.Sequence)
+	log.Printf("[Controller]   From: %s", reply.From)
+	log.Printf("[Controller]   To: %s", reply.To)
+	log.Printf("[Controller][RAW] %s", reply.Content)
+	c.publish(model.EventResponded, "webtransport", c.name+" -> "+message.From, reply, time.Since(receivedAt), nil, responded)
+
+	// Echo message to each target server if any are configured
+	if !result.Forward {
+		if attachment == nil {
+			log.Printf("[Controller] %s reply is not forwarded, skipping echo", reply.Type)
+		}
+		targetURLs = nil
+	}
+	for _, targetURL := range targetURLs {
 		log.Printf("[Controller] Triggering echo to target: %s", targetURL)
 		log.Printf("[Controller] Note: Echo will create a NEW connection to target")
-		go func() {
-			var echoErr error
-			if strings.HasPrefix(targetURL, "http://") || strings.HasPrefix(targetURL, "https://") {
-				echoErr = c.repo.SendPlainEchoToTarget(targetURL, response)
-			} else {
-				echoErr = c.repo.SendEchoToTarget(targetURL, response)
-			}
-			if echoErr != nil {
-				log.Printf("[Controller] ❌ Echo to target %s failed: %v", targetURL, echoErr)
-			} else {
-				log.Printf("[Controller] ✅ Echo to target %s completed successfully", targetURL)
-			}
-		}()
-	} else {
+		go c.echoToTarget(targetURL, reply, nil, "")
+	}
+	if len(targetURLs) == 0 {
 		log.Printf("[Controller] No target URL configured, skipping echo")
 	}
 
@@ -236,26 +844,19 @@ func (c *commonController) handleStream(stream *webtransport.Stream, targetURL s
 	log.Printf("[Controller] ==========================================")
 }
 
-// HandlePing processes a ping message
-func (c *commonController) HandlePing(message *model.Message) (*model.Message, error) {
-	log.Printf("[Controller] HandlePing called for message seq: %d", message.Sequence)
-	response, err := c.repo.ProcessPing(message)
+// HandleMessage dispatches a message to the handler registered for its type
+func (c *commonController) HandleMessage(message *model.Message) (handler.Result, error) {
+	log.Printf("[Controller] HandleMessage called for %s message seq: %d", message.Type, message.Sequence)
+	h, err := c.handlers.Lookup(message.Type)
 	if err != nil {
-		log.Printf("[Controller] ❌ ProcessPing failed: %v", err)
-		return nil, fmt.Errorf("failed to process ping: %w", err)
+		return handler.Result{}, err
 	}
-	log.Printf("[Controller] ✅ ProcessPing successful, generated pong seq: %d", response.Sequence)
-	return response, nil
-}
-
-// HandlePong processes a pong message
-func (c *commonController) HandlePong(message *model.Message) (*model.Message, error) {
-	log.Printf("[Controller] HandlePong called for message seq: %d", message.Sequence)
-	response, err := c.repo.ProcessPong(message)
+	result, err := h.Handle(message)
 	if err != nil {
-		log.Printf("[Controller] ❌ ProcessPong failed: %v", err)
-		return nil, fmt.Errorf("failed to process pong: %w", err)
+		log.Printf("[Controller] ❌ %s handler failed: %v", message.Type, err)
+		return handler.Result{}, fmt.Errorf("failed to process %s: %w", message.Type, err)
 	}
-	log.Printf("[Controller] ✅ ProcessPong successful, generated ping seq: %d", response.Sequence)
-	return response, nil
+	log.Printf("[Controller] ✅ %s handler successful, generated %s seq: %d (forward: %t)", message.Type, result.Reply.Type, result.Reply.Sequence, result.Forward)
+	c.recordChain(message, result)
+	return result, nil
 }
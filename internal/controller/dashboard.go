@@ -0,0 +1,116 @@
+package controller
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/repository"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// dashboardPage is index.html, rendered with the bearer token of the request so that
+// the page's asset requests carry it too (browsers cannot add headers to them)
+var dashboardPage = template.Must(template.ParseFS(staticFiles, "static/index.html"))
+
+// eventKeepAlive is the interval between SSE comments keeping idle connections open
+const eventKeepAlive = 15 * time.Second
+
+// dashboardController implements the DashboardController interface
+type dashboardController struct {
+	events repository.EventRepository
+	assets http.Handler
+}
+
+// NewDashboardController creates a new dashboard controller serving the embedded page
+func NewDashboardController(events repository.EventRepository) DashboardController {
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// The directory is embedded at build time, so this only fails on a broken build
+		log.Fatalf("[Dashboard] ❌ Failed to open embedded assets: %v", err)
+	}
+	return &dashboardController{
+		events: events,
+		assets: http.StripPrefix("/dashboard/", http.FileServer(http.FS(static))),
+	}
+}
+
+// HandleDashboard serves the embedded dashboard page and its assets
+func (c *dashboardController) HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/dashboard" {
+		target := "/dashboard/"
+		if r.URL.RawQuery != "" {
+			target += "?" + r.URL.RawQuery
+		}
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+		return
+	}
+	log.Printf("[Dashboard] Serving %s to %s", r.URL.Path, r.RemoteAddr)
+	if r.URL.Path == "/dashboard/" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		data := struct{ Token string }{r.URL.Query().Get(auth.QueryAccessToken)}
+		if err := dashboardPage.Execute(w, data); err != nil {
+			log.Printf("[Dashboard] ❌ Failed to render the dashboard page: %v", err)
+		}
+		return
+	}
+	c.assets.ServeHTTP(w, r)
+}
+
+// HandleEvents streams the live event feed as Server-Sent Events
+func (c *dashboardController) HandleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("[Dashboard] Event feed subscriber connected: %s", r.RemoteAddr)
+	events, cancel := c.events.Subscribe()
+	defer func() {
+		cancel()
+		log.Printf("[Dashboard] Event feed subscriber disconnected: %s", r.RemoteAddr)
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(eventKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := w.Write([]byte(": keep-alive\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := event.ToJSON()
+			if err != nil {
+				log.Printf("[Dashboard] ❌ Failed to marshal event: %v", err)
+				continue
+			}
+			if _, err := w.Write([]byte("data: " + string(data) + "\n\n")); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package controller
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/ryo-arima/magic-cylinder/internal/limit"
+	"github.com/ryo-arima/magic-cylinder/internal/repository"
+)
+
+// Health status values reported in the response body
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+)
+
+// healthController implements the HealthController interface
+type healthController struct {
+	health    repository.HealthRepository
+	name      string         // Server name reported in responses
+	perClient *limit.Limiter // /readyz requests per remote address (nil for unlimited)
+	probeTTL  time.Duration  // How long a target probe result is reused
+
+	probesMu sync.Mutex
+	probes   map[string]*probe // Latest probe per target URL
+}
+
+// probe is a target probe, running until done is closed
+type probe struct {
+	done   chan struct{}
+	status response.TargetStatus
+}
+
+// NewHealthController creates a new health controller
+func NewHealthController(health repository.HealthRepository, cfg *config.ServerConfig) HealthController {
+	return &healthController{
+		health:    health,
+		name:      cfg.Name,
+		perClient: limit.NewLimiter(cfg.Limits.ClientRate, cfg.Limits.ClientBurst),
+		probeTTL:  cfg.Transport.ProbeCacheTTL.Std(),
+		probes:    make(map[string]*probe),
+	}
+}
+
+// HandleLivez reports whether the process and its listeners are alive.
+// Peers are not probed so a broken neighbour never restarts this server.
+func (c *healthController) HandleLivez(w http.ResponseWriter, r *http.Request) {
+	resp := c.baseResponse()
+	if !c.listenersUp(resp) {
+		resp.Status = healthStatusUnavailable
+	}
+	c.writeResponse(w, resp)
+}
+
+// HandleReadyz reports whether the server and all configured targets are ready.
+// Each target is probed via both WebTransport and /plain; the target counts as
+// reachable when the transport selected by its URL answers. Probe results are
+// reused for the cache TTL, so requests never cost more than one probe per target
+// per TTL, and requests are subject to the per-client rate limit.
+func (c *healthController) HandleReadyz(w http.ResponseWriter, r *http.Request, targetURLs []string) {
+	if ok, retry := c.perClient.Allow(remoteHost(r.RemoteAddr)); !ok {
+		log.Printf("[Health] ❌ Rejecting readiness check from %s: client rate limit exceeded", r.RemoteAddr)
+		tooManyRequests(w, retry)
+		return
+	}
+	resp := c.baseResponse()
+	ready := c.listenersUp(resp)
+	if resp.Certificate == nil || !resp.Certificate.Valid {
+		ready = false
+	}
+
+	resp.Targets = make([]response.TargetStatus, len(targetURLs))
+	var wg sync.WaitGroup
+	for i, targetURL := range targetURLs {
+		wg.Add(1)
+		go func(i int, targetURL string) {
+			defer wg.Done()
+			resp.Targets[i] = c.cachedProbe(targetURL)
+		}(i, targetURL)
+	}
+	wg.Wait()
+
+	for _, target := range resp.Targets {
+		if !target.Reachable {
+			log.Printf("[Health] ⚠ Target %s is not reachable via %s", target.URL, target.Transport)
+			ready = false
+		}
+	}
+	if !ready {
+		resp.Status = healthStatusUnavailable
+	}
+	c.writeResponse(w, resp)
+}
+
+// baseResponse collects the local (non-peer) status
+func (c *healthController) baseResponse() *response.HealthResponse {
+	return &response.HealthResponse{
+		Status:         healthStatusOK,
+		Server:         c.name,
+		Listeners:      c.health.Listeners(),
+		Certificate:    c.health.Certificate(),
+		ActiveSessions: c.health.ActiveSessions(),
+		Time:           time.Now(),
+	}
+}
+
+// listenersUp reports whether at least one listener is registered and all are serving
+func (c *healthController) listenersUp(resp *response.HealthResponse) bool {
+	if len(resp.Listeners) == 0 {
+		return false
+	}
+	for _, listener := range resp.Listeners {
+		if !listener.Up {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedProbe returns the latest probe of a target if it is younger than the TTL,
+// waits for one already running, or probes the target
+func (c *healthController) cachedProbe(targetURL string) response.TargetStatus {
+	c.probesMu.Lock()
+	p, ok := c.probes[targetURL]
+	if ok {
+		select {
+		case <-p.done:
+			ok = time.Since(p.status.CheckedAt) < c.probeTTL
+		default: // Running
+		}
+	}
+	if !ok {
+		p = &probe{done: make(chan struct{})}
+		c.probes[targetURL] = p
+		c.probesMu.Unlock()
+		p.status = c.probeTarget(targetURL)
+		close(p.done)
+		return p.status
+	}
+	c.probesMu.Unlock()
+	<-p.done
+	return p.status
+}
+
+// probeTarget probes the WebTransport and /plain endpoints on the target's host
+func (c *healthController) probeTarget(targetURL string) response.TargetStatus {
+	status := response.TargetStatus{URL: targetURL, Transport: config.TargetTransport(targetURL), CheckedAt: time.Now()}
+	u, err := neturl.Parse(targetURL)
+	if err != nil {
+		status.WebTransport.Error = err.Error()
+		status.Plain.Error = err.Error()
+		return status
+	}
+	wtURL := *u
+	wtURL.Scheme = "https"
+	wtURL.Path = "/webtransport"
+	plainURL := *u
+	if plainURL.Scheme == "http" {
+		plainURL.Scheme = "https"
+	}
+	plainURL.Path = "/plain"
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		status.WebTransport = c.health.ProbeWebTransport(wtURL.String())
+	}()
+	go func() {
+		defer wg.Done()
+		status.Plain = c.health.ProbePlain(plainURL.String())
+	}()
+	wg.Wait()
+
+	if status.Transport == "plain" {
+		status.Reachable = status.Plain.Reachable
+	} else {
+		status.Reachable = status.WebTransport.Reachable
+	}
+	return status
+}
+
+// writeResponse writes the health response as JSON with 200 or 503
+func (c *healthController) writeResponse(w http.ResponseWriter, resp *response.HealthResponse) {
+	code := http.StatusOK
+	if resp.Status != healthStatusOK {
+		code = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("[Health] ❌ Failed to write response: %v", err)
+	}
+}
@@ -5,13 +5,40 @@ import (
 
 	"github.com/quic-go/webtransport-go"
 	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/handler"
 )
 
 // CommonController defines the interface for controller operations
 type CommonController interface {
-	HandleWebTransport(server *webtransport.Server, w http.ResponseWriter, r *http.Request, targetURL string)
+	HandleWebTransport(server *webtransport.Server, w http.ResponseWriter, r *http.Request, targetURLs []string)
 	// HandlePlain handles a plaintext (HTTP POST) message exchange at /plain
-	HandlePlain(w http.ResponseWriter, r *http.Request, targetURL string)
-	HandlePing(message *model.Message) (*model.Message, error)
-	HandlePong(message *model.Message) (*model.Message, error)
+	HandlePlain(w http.ResponseWriter, r *http.Request, targetURLs []string)
+	// HandleMessage dispatches a message to the handler registered for its type
+	HandleMessage(message *model.Message) (handler.Result, error)
+	// ResumeChains continues the chains saved before a restart by echoing their next step to the targets
+	ResumeChains(targetURLs []string)
+}
+
+// DashboardController defines the interface for the built-in browser dashboard
+type DashboardController interface {
+	// HandleDashboard serves the embedded dashboard page and its assets
+	HandleDashboard(w http.ResponseWriter, r *http.Request)
+	// HandleEvents streams the live event feed as Server-Sent Events
+	HandleEvents(w http.ResponseWriter, r *http.Request)
+}
+
+// HealthController defines the interface for liveness and readiness checks
+type HealthController interface {
+	// HandleLivez reports whether the process and its listeners are alive
+	HandleLivez(w http.ResponseWriter, r *http.Request)
+	// HandleReadyz reports whether the server and all configured targets are ready
+	HandleReadyz(w http.ResponseWriter, r *http.Request, targetURLs []string)
+}
+
+// AdminController defines the interface for runtime diagnostics on the admin listener
+type AdminController interface {
+	// HandleRuntime reports runtime and application counters as JSON
+	HandleRuntime(w http.ResponseWriter, r *http.Request)
+	// HandleGoroutines writes a full goroutine dump with stack traces
+	HandleGoroutines(w http.ResponseWriter, r *http.Request)
 }
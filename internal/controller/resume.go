@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/handler"
+	"github.com/ryo-arima/magic-cylinder/internal/repository"
+)
+
+// recordChain saves the step a handled message took on its chain, so a restarted
+// server knows which chains passed through it and where they were
+func (c *commonController) recordChain(message *model.Message, result handler.Result) {
+	if !c.state.Persistent() {
+		return
+	}
+	key := message.ChainKey()
+	var err error
+	switch {
+	case message.Type == model.StopMessage:
+		err = c.state.StopChain(key)
+	case message.Type == model.AttachmentMessage:
+		return // The payload is gone after a restart
+	case result.Forward:
+		err = c.state.SaveChain(model.ChainState{Key: key, Last: message, Sequence: result.Reply.Sequence, Updated: time.Now()})
+	case message.Type == model.PingMessage || message.Type == model.PongMessage:
+		err = c.state.EndChain(key)
+	}
+	if err != nil {
+		log.Printf("[Controller] ⚠ Failed to save chain %s: %v", key, err)
+	}
+}
+
+// ResumeChains continues the chains that were active when the server stopped: the
+// last message of each is handled again and the reply, with a new sequence number,
+// is echoed to the targets. It first waits resumeDelay, and chains that received a
+// message since the server started are skipped: a peer's delayed echo already
+// continued them, and resuming as well would fork the chain. Like received
+// messages, resumed ones go through the per-chain limiter and the dedupe window, so
+// a peer resending the same message after the restart does not run the chain twice.
+func (c *commonController) ResumeChains(targetURLs []string) {
+	if !c.state.Persistent() || !c.resume {
+		return
+	}
+	if c.resumeDelay > 0 {
+		log.Printf("[Controller] ⏳ Resuming saved chains in %s", c.resumeDelay)
+		time.Sleep(c.resumeDelay)
+	}
+	chains, err := c.state.Chains()
+	if err != nil {
+		log.Printf("[Controller] ❌ Failed to load saved chains: %v", err)
+		return
+	}
+	for _, chain := range chains {
+		if chain.Stopped || chain.Last == nil {
+			continue
+		}
+		if chain.Updated.After(c.started) {
+			log.Printf("[Controller] ⚠ Not resuming chain %s: it received a message since the restart", chain.Key)
+			continue
+		}
+		log.Printf("[Controller] ⏳ Resuming chain %s after %s (last %s seq %d from %s)", chain.Key, time.Since(chain.Updated).Round(time.Second), chain.Last.Type, chain.Last.Sequence, chain.Last.From)
+		if ok, _ := c.perChain.Allow(chain.Key); !ok {
+			log.Printf("[Controller] ⚠ Not resuming chain %s: chain rate limit exceeded", chain.Key)
+			continue
+		}
+		// A message older than the window is refused to live senders as well, so it
+		// cannot race with a copy arriving now and is resumed without an entry
+		duplicate, _, err := c.dedupe.Begin(chain.Last)
+		if err != nil && !errors.Is(err, repository.ErrStale) {
+			log.Printf("[Controller] ⚠ Not resuming chain %s: %v", chain.Key, err)
+			continue
+		}
+		if duplicate {
+			log.Printf("[Controller] ⚠ Not resuming chain %s: message %s was already received again", chain.Key, chain.Last.ID)
+			continue
+		}
+		deduped := err == nil
+		result, err := c.HandleMessage(chain.Last)
+		if err != nil {
+			if deduped {
+				c.dedupe.Abort(chain.Last)
+			}
+			log.Printf("[Controller] ❌ Failed to resume chain %s: %v", chain.Key, err)
+			continue
+		}
+		if deduped {
+			c.dedupe.Complete(chain.Last, result.Reply)
+		}
+		if !result.Forward {
+			continue
+		}
+		for _, targetURL := range targetURLs {
+			go c.echoToTarget(targetURL, result.Reply, nil, "[resume] ")
+		}
+	}
+}
@@ -0,0 +1,291 @@
+// Magic Cylinder dashboard: browser WebTransport client and live event feed viewer.
+'use strict';
+
+const MAX_ROWS = 200;
+const MAX_POINTS = 60;
+// PROTOCOL_VERSION is the envelope header version (model.ProtocolVersion)
+const PROTOCOL_VERSION = 1;
+const COLORS = ['#3182ce', '#dd6b20', '#38a169', '#805ad5', '#d53f8c', '#319795', '#b7791f'];
+
+const $ = (id) => document.getElementById(id);
+let transport = null;
+
+// ---- WebTransport client ----
+
+function setStatus(text, cls) {
+  const el = $('status');
+  el.textContent = text;
+  el.className = 'status ' + cls;
+}
+
+// parseHash accepts a SHA-256 fingerprint as hex (with optional colons) or base64
+function parseHash(value) {
+  const text = value.trim();
+  if (!text) {
+    return null;
+  }
+  const hex = text.replace(/:/g, '');
+  if (/^[0-9a-fA-F]{64}$/.test(hex)) {
+    return new Uint8Array(hex.match(/../g).map((b) => parseInt(b, 16)));
+  }
+  const raw = atob(text);
+  if (raw.length !== 32) {
+    throw new Error('certificate hash must be 32 bytes');
+  }
+  return Uint8Array.from(raw, (c) => c.charCodeAt(0));
+}
+
+async function connect() {
+  if (typeof WebTransport === 'undefined') {
+    setStatus('WebTransport not supported by this browser', 'error');
+    return;
+  }
+  const options = {};
+  try {
+    const hash = parseHash($('certHash').value);
+    if (hash) {
+      options.serverCertificateHashes = [{ algorithm: 'sha-256', value: hash }];
+    }
+  } catch (err) {
+    setStatus('invalid certificate hash: ' + err.message, 'error');
+    return;
+  }
+
+  // Browsers cannot set headers on WebTransport sessions, so the token travels as a query parameter
+  const url = new URL($('url').value);
+  const token = $('token').value.trim();
+  if (token) {
+    url.searchParams.set('access_token', token);
+  }
+
+  setStatus('connecting…', 'idle');
+  try {
+    transport = new WebTransport(url.toString(), options);
+    await transport.ready;
+  } catch (err) {
+    transport = null;
+    setStatus('connect failed: ' + err, 'error');
+    return;
+  }
+  setStatus('connected', 'ok');
+  $('connect').disabled = true;
+  $('disconnect').disabled = false;
+  $('start').disabled = false;
+
+  transport.closed
+    .then(() => setStatus('disconnected', 'idle'))
+    .catch((err) => setStatus('closed: ' + err, 'error'))
+    .finally(() => {
+      transport = null;
+      $('connect').disabled = false;
+      $('disconnect').disabled = true;
+      $('start').disabled = true;
+    });
+}
+
+function disconnect() {
+  if (transport) {
+    transport.close({ closeCode: 0, reason: 'dashboard disconnect' });
+  }
+}
+
+async function readAll(readable) {
+  const reader = readable.getReader();
+  const chunks = [];
+  let size = 0;
+  for (;;) {
+    const { value, done } = await reader.read();
+    if (done) {
+      break;
+    }
+    chunks.push(value);
+    size += value.length;
+  }
+  const out = new Uint8Array(size);
+  let offset = 0;
+  for (const chunk of chunks) {
+    out.set(chunk, offset);
+    offset += chunk.length;
+  }
+  return out;
+}
+
+// Messages on streams are framed with a 4-byte big-endian length prefix
+function encodeFrame(payload) {
+  const frame = new Uint8Array(4 + payload.length);
+  new DataView(frame.buffer).setUint32(0, payload.length);
+  frame.set(payload, 4);
+  return frame;
+}
+
+function decodeFrame(data) {
+  if (data.length < 4) {
+    throw new Error('stream closed without a response');
+  }
+  const size = new DataView(data.buffer, data.byteOffset).getUint32(0);
+  if (data.length < 4 + size) {
+    throw new Error('truncated frame: ' + (data.length - 4) + ' of ' + size + ' bytes');
+  }
+  return data.subarray(4, 4 + size);
+}
+
+function randomHex(bytes) {
+  return Array.from(crypto.getRandomValues(new Uint8Array(bytes)), (b) => b.toString(16).padStart(2, '0')).join('');
+}
+
+// startChain sends the initial ping in a request envelope on a new bidirectional stream and shows the reply
+async function startChain() {
+  if (!transport) {
+    return;
+  }
+  const message = {
+    id: randomHex(16),
+    nonce: randomHex(12),
+    type: 'ping',
+    content: $('content').value,
+    timestamp: new Date().toISOString(),
+    sequence: parseInt($('sequence').value, 10) || 1,
+    from: 'browser',
+    to: 'server',
+    chain: randomHex(8),
+  };
+  try {
+    const stream = await transport.createBidirectionalStream();
+    const writer = stream.writable.getWriter();
+    const request = { header: { version: PROTOCOL_VERSION }, message };
+    await writer.write(encodeFrame(new TextEncoder().encode(JSON.stringify(request))));
+    await writer.close();
+    const reply = JSON.parse(new TextDecoder().decode(decodeFrame(await readAll(stream.readable))));
+    $('reply').textContent = reply.success
+      ? JSON.stringify(reply.message, null, 2)
+      : 'rejected: ' + reply.code + ': ' + reply.error;
+  } catch (err) {
+    $('reply').textContent = 'stream failed: ' + err;
+  }
+}
+
+// ---- Event feed ----
+
+const series = new Map();
+
+function colorFor(hop) {
+  if (!series.has(hop)) {
+    series.set(hop, { color: COLORS[series.size % COLORS.length], points: [] });
+  }
+  return series.get(hop).color;
+}
+
+function addRow(event) {
+  const msg = event.message || {};
+  const row = document.createElement('tr');
+  row.className = event.kind;
+  const cells = [
+    new Date(event.time).toLocaleTimeString(),
+    event.server,
+    event.kind + (event.error ? ' (' + event.error + ')' : '') +
+      (event.signature && event.signature !== 'verified' ? ' [signature ' + event.signature + ']' : ''),
+    event.transport + (event.codec ? ' / ' + event.codec : ''),
+    event.hop,
+    msg.type || '',
+    msg.sequence != null ? msg.sequence : '',
+    event.latency_ms.toFixed(2) + ' ms',
+    event.bytes ? event.bytes + ' B' + (event.compression ? ' (' + event.compression + ' ' + event.wire_bytes + ' B)' : '') : '',
+    msg.content || '',
+  ];
+  cells.forEach((text, i) => {
+    const td = document.createElement('td');
+    td.textContent = text;
+    if (i === cells.length - 1) {
+      td.className = 'content';
+      td.title = text;
+    }
+    row.appendChild(td);
+  });
+  const body = $('events');
+  body.insertBefore(row, body.firstChild);
+  while (body.children.length > MAX_ROWS) {
+    body.removeChild(body.lastChild);
+  }
+}
+
+function addPoint(event) {
+  // Only inbound hops and echo round trips carry per-hop latency
+  if (event.kind !== 'received' && event.kind !== 'echo_sent') {
+    return;
+  }
+  const label = (event.kind === 'echo_sent' ? 'echo ' : '') + event.hop;
+  colorFor(label);
+  const points = series.get(label).points;
+  points.push(event.latency_ms);
+  if (points.length > MAX_POINTS) {
+    points.shift();
+  }
+  drawChart();
+}
+
+function drawChart() {
+  const canvas = $('chart');
+  const ctx = canvas.getContext('2d');
+  const w = canvas.width;
+  const h = canvas.height;
+  const pad = 36;
+  ctx.clearRect(0, 0, w, h);
+
+  let max = 1;
+  series.forEach((s) => s.points.forEach((p) => { max = Math.max(max, p); }));
+
+  ctx.strokeStyle = '#cbd2d9';
+  ctx.fillStyle = '#52606d';
+  ctx.font = '11px system-ui';
+  for (let i = 0; i <= 4; i++) {
+    const y = pad / 2 + ((h - pad) * i) / 4;
+    ctx.beginPath();
+    ctx.moveTo(pad, y);
+    ctx.lineTo(w - 8, y);
+    ctx.stroke();
+    ctx.fillText((max * (1 - i / 4)).toFixed(1), 2, y + 4);
+  }
+
+  const legend = $('legend');
+  legend.innerHTML = '';
+  series.forEach((s, label) => {
+    ctx.strokeStyle = s.color;
+    ctx.beginPath();
+    s.points.forEach((p, i) => {
+      const x = pad + ((w - pad - 8) * i) / (MAX_POINTS - 1);
+      const y = pad / 2 + (h - pad) * (1 - p / max);
+      if (i === 0) {
+        ctx.moveTo(x, y);
+      } else {
+        ctx.lineTo(x, y);
+      }
+    });
+    ctx.stroke();
+
+    const item = document.createElement('span');
+    const swatch = document.createElement('i');
+    swatch.style.background = s.color;
+    item.appendChild(swatch);
+    item.appendChild(document.createTextNode(label));
+    legend.appendChild(item);
+  });
+}
+
+// The feed needs the same credentials as the page; EventSource cannot set headers either
+function subscribe() {
+  const token = new URLSearchParams(location.search).get('access_token');
+  const source = new EventSource(token ? '/events?access_token=' + encodeURIComponent(token) : '/events');
+  source.onmessage = (e) => {
+    const event = JSON.parse(e.data);
+    addRow(event);
+    addPoint(event);
+  };
+}
+
+$('url').value = 'https://' + location.host + '/webtransport';
+$('token').value = new URLSearchParams(location.search).get('access_token') || '';
+$('connect').addEventListener('click', connect);
+$('disconnect').addEventListener('click', disconnect);
+$('start').addEventListener('click', startChain);
+subscribe();
+drawChart();
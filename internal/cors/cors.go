@@ -0,0 +1,133 @@
+// Package cors decides which browser origins may open WebTransport sessions
+// and call /plain.
+//
+// Requests without an Origin header (servers echoing, the CLI client) and
+// same-origin requests (the dashboard served by this server: same scheme and
+// host) are always allowed. Other origins must be listed in
+// cors.allowed_origins; "*" allows any origin and is meant for local
+// development only.
+package cors
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+)
+
+// AnyOrigin allows every origin
+const AnyOrigin = "*"
+
+// allowedHeaders are the request headers a browser may send to /plain
+var allowedHeaders = []string{"Content-Type", "Authorization", auth.HeaderTimestamp, auth.HeaderNonce, auth.HeaderSignature}
+
+// Policy holds the allowed origins. They can be replaced on config reload.
+type Policy struct {
+	origins atomic.Pointer[[]string]
+	maxAge  time.Duration
+}
+
+// New creates a policy for the allowed origins (normalized as scheme://host[:port]).
+// MaxAge is how long browsers may cache a preflight response.
+func New(allowedOrigins []string, maxAge time.Duration) *Policy {
+	p := &Policy{maxAge: maxAge}
+	p.SetOrigins(allowedOrigins)
+	return p
+}
+
+// SetOrigins replaces the allowed origins
+func (p *Policy) SetOrigins(allowedOrigins []string) {
+	origins := make([]string, 0, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		origins = append(origins, Normalize(origin))
+	}
+	p.origins.Store(&origins)
+}
+
+// Origins returns the allowed origins
+func (p *Policy) Origins() []string {
+	return *p.origins.Load()
+}
+
+// CheckOrigin reports whether the request origin is allowed.
+// It implements webtransport.Server.CheckOrigin.
+func (p *Policy) CheckOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Scheme, listenerScheme(r)) && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origins := p.Origins()
+	return slices.Contains(origins, AnyOrigin) || slices.Contains(origins, Normalize(origin))
+}
+
+// listenerScheme returns the scheme the request arrived on; a same-origin
+// page must have been loaded with it
+func listenerScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// Wrap adds CORS handling to a handler: requests from other origins are
+// rejected with 403, allowed cross-origin requests get Access-Control-Allow-*
+// headers and preflight (OPTIONS) requests are answered without calling next
+func (p *Policy) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if !p.CheckOrigin(r) {
+			log.Printf("[CORS] ❌ Rejecting %s %s from origin %s (%s)", r.Method, r.URL.Path, origin, r.RemoteAddr)
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		if origin != "" {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", http.MethodPost)
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(allowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Normalize lower-cases an origin and strips a trailing slash
+func Normalize(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// ValidateOrigin checks an allowed_origins entry: "*" or scheme://host[:port] without a path
+func ValidateOrigin(origin string) error {
+	if origin == AnyOrigin {
+		return nil
+	}
+	u, err := url.Parse(Normalize(origin))
+	if err != nil {
+		return fmt.Errorf("invalid origin %q: %v", origin, err)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("origin %q must start with https:// or http://", origin)
+	}
+	if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("origin %q must be scheme://host[:port] without a path", origin)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cors
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		plain   bool // Request received without TLS
+		origin  string
+		want    bool
+	}{
+		{name: "no origin", origin: "", want: true},
+		{name: "same origin", origin: "https://localhost:8443", want: true},
+		{name: "same origin in another case", origin: "https://LOCALHOST:8443", want: true},
+		{name: "same host over http", origin: "http://localhost:8443", want: false},
+		{name: "same host over http on a plain listener", plain: true, origin: "http://localhost:8443", want: true},
+		{name: "same host over https on a plain listener", plain: true, origin: "https://localhost:8443", want: false},
+		{name: "same host with another scheme", origin: "ftp://localhost:8443", want: false},
+		{name: "same host on another port", origin: "https://localhost:8444", want: false},
+		{name: "other origin", origin: "https://evil.example.com", want: false},
+		{name: "listed origin", allowed: []string{"https://dash.example.com"}, origin: "https://dash.example.com", want: true},
+		{name: "listed origin with a trailing slash", allowed: []string{"https://Dash.example.com/"}, origin: "https://dash.example.com", want: true},
+		{name: "listed origin with another scheme", allowed: []string{"https://dash.example.com"}, origin: "http://dash.example.com", want: false},
+		{name: "listed http origin", allowed: []string{"http://localhost:3000"}, origin: "http://localhost:3000", want: true},
+		{name: "any origin", allowed: []string{AnyOrigin}, origin: "http://evil.example.com", want: true},
+		{name: "null origin", origin: "null", want: false},
+		{name: "unparsable origin", origin: "https://%zz", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New(tt.allowed, time.Minute)
+			r := httptest.NewRequest(http.MethodPost, "https://localhost:8443/plain", nil)
+			if tt.plain {
+				r.TLS = nil
+			} else if r.TLS == nil {
+				r.TLS = &tls.ConnectionState{}
+			}
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := p.CheckOrigin(r); got != tt.want {
+				t.Errorf("CheckOrigin() with origin %q = %t, want %t", tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		origin     string
+		preflight  bool
+		wantStatus int
+		wantAllow  string // Access-Control-Allow-Origin
+	}{
+		{name: "no origin", method: http.MethodPost, wantStatus: http.StatusOK},
+		{name: "allowed origin", method: http.MethodPost, origin: "https://dash.example.com", wantStatus: http.StatusOK, wantAllow: "https://dash.example.com"},
+		{name: "preflight", method: http.MethodOptions, origin: "https://dash.example.com", preflight: true, wantStatus: http.StatusNoContent, wantAllow: "https://dash.example.com"},
+		{name: "rejected origin", method: http.MethodPost, origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{name: "same host over http", method: http.MethodPost, origin: "http://localhost:8443", wantStatus: http.StatusForbidden},
+	}
+	p := New([]string{"https://dash.example.com"}, time.Minute)
+	h := p.Wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "https://localhost:8443/plain", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+			if tt.preflight && w.Header().Get("Access-Control-Max-Age") != "60" {
+				t.Errorf("Access-Control-Max-Age = %q, want 60", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
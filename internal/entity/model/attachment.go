@@ -0,0 +1,52 @@
+package model
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Attachment describes the binary payload streamed after an attachment message.
+// It is the message content, so the signature covers the checksum.
+type Attachment struct {
+	Name   string `json:"name,omitempty"` // File name or a description of generated data
+	Size   int64  `json:"size"`           // Payload size in bytes
+	Chunk  int    `json:"chunk"`          // Largest chunk in bytes
+	SHA256 string `json:"sha256"`         // Hex SHA-256 of the whole payload
+}
+
+// ParseAttachment decodes and validates the content of an attachment message
+func ParseAttachment(content string) (*Attachment, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.DisallowUnknownFields()
+	var a Attachment
+	if err := dec.Decode(&a); err != nil {
+		return nil, fmt.Errorf("%w: attachment content is not a descriptor: %v", ErrInvalidMessage, err)
+	}
+	var problems []string
+	if a.Size <= 0 {
+		problems = append(problems, fmt.Sprintf("size must be positive (got %d)", a.Size))
+	}
+	if a.Chunk <= 0 {
+		problems = append(problems, fmt.Sprintf("chunk must be positive (got %d)", a.Chunk))
+	}
+	if sum, err := hex.DecodeString(a.SHA256); err != nil || len(sum) != 32 {
+		problems = append(problems, fmt.Sprintf("sha256 must be 64 hex digits (got %q)", a.SHA256))
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("%w: attachment %s", ErrInvalidMessage, strings.Join(problems, "; "))
+	}
+	return &a, nil
+}
+
+// Chunks returns the number of chunks the payload is split into
+func (a *Attachment) Chunks() int64 {
+	return (a.Size + int64(a.Chunk) - 1) / int64(a.Chunk)
+}
+
+// Content returns the descriptor as message content
+func (a *Attachment) Content() string {
+	data, _ := json.Marshal(a) // Cannot fail for these field types
+	return string(data)
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Capabilities is what a server advertises in a hello exchange
+type Capabilities struct {
+	Server      string   `json:"server"`      // Name of the advertising server
+	MinVersion  int      `json:"min_version"` // Oldest envelope version it accepts
+	MaxVersion  int      `json:"max_version"` // Newest envelope version it speaks
+	Codecs      []string `json:"codecs"`      // Codecs it accepts (JSON is always accepted)
+	Compression []string `json:"compression"` // Compression algorithms it accepts
+	Types       []string `json:"types"`       // Message types it handles ("custom:*" for a family)
+}
+
+// PeerCapabilities is the outcome of a hello exchange, cached per peer
+type PeerCapabilities struct {
+	Capabilities
+	Version int       `json:"version"`          // Negotiated envelope version (0 when refused)
+	Legacy  bool      `json:"legacy,omitempty"` // Peer without hello support, assumed to speak the base protocol
+	Error   string    `json:"error,omitempty"`  // Why the peer was refused
+	Updated time.Time `json:"updated"`          // When the exchange took place
+}
+
+// LegacyCapabilities returns the capabilities assumed for a peer that does not handle
+// hello messages: the current envelope version, JSON only and ping/pong only
+func LegacyCapabilities(server string) Capabilities {
+	return Capabilities{
+		Server:     server,
+		MinVersion: ProtocolVersion,
+		MaxVersion: ProtocolVersion,
+		Codecs:     []string{"json"},
+		Types:      []string{string(PingMessage), string(PongMessage)},
+	}
+}
+
+// Negotiate picks the newest envelope version both sides speak. The result is
+// refused (Version 0, Error set, error returned) when their version ranges do not overlap.
+func Negotiate(local, remote Capabilities) (PeerCapabilities, error) {
+	peer := PeerCapabilities{Capabilities: remote, Updated: time.Now()}
+	version := min(local.MaxVersion, remote.MaxVersion)
+	if version < max(local.MinVersion, remote.MinVersion) {
+		err := fmt.Errorf("%w: no common version (local %d-%d, %s %d-%d)", ErrUnsupportedVersion, local.MinVersion, local.MaxVersion, remote.Server, remote.MinVersion, remote.MaxVersion)
+		peer.Error = err.Error()
+		return peer, err
+	}
+	peer.Version = version
+	return peer, nil
+}
+
+// Err returns why the peer was refused (nil for a usable peer)
+func (p *PeerCapabilities) Err() error {
+	if p.Version == 0 {
+		return fmt.Errorf("%w: %s", ErrUnsupportedVersion, p.Error)
+	}
+	return nil
+}
+
+// Handles reports whether the peer handles messages of the type
+func (p *PeerCapabilities) Handles(kind MessageType) bool {
+	for _, pattern := range p.Types {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasPrefix(string(kind), prefix) {
+			return true
+		}
+		if pattern == string(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsCodec reports whether the peer accepts a codec (JSON is always accepted)
+func (p *PeerCapabilities) AcceptsCodec(name string) bool {
+	return name == "json" || slices.Contains(p.Codecs, name)
+}
+
+// AcceptsCompression reports whether the peer accepts a compression algorithm
+func (p *PeerCapabilities) AcceptsCompression(name string) bool {
+	return slices.Contains(p.Compression, name)
+}
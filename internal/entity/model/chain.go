@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// ChainState is the last step of a chain on this server, kept so a restarted
+// server can continue the chain
+type ChainState struct {
+	Key      string    `json:"key"`               // Chain key (see Message.ChainKey)
+	Last     *Message  `json:"last"`              // Last message of the chain received here
+	Sequence int       `json:"sequence"`          // Sequence of the reply sent for it
+	Stopped  bool      `json:"stopped,omitempty"` // A stop message ended the chain
+	Updated  time.Time `json:"updated"`
+}
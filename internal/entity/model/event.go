@@ -0,0 +1,60 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// EventKind defines what happened to a message on this server
+type EventKind string
+
+const (
+	// EventReceived is published when a message is read from a stream or /plain request
+	EventReceived EventKind = "received"
+	// EventResponded is published when the generated response is written back to the sender
+	EventResponded EventKind = "responded"
+	// EventEchoSent is published when an echo to the target completed
+	EventEchoSent EventKind = "echo_sent"
+	// EventEchoFailed is published when an echo to the target failed
+	EventEchoFailed EventKind = "echo_failed"
+	// EventDuplicate is published when a repeated message is acknowledged without processing it again
+	EventDuplicate EventKind = "duplicate"
+	// EventRejected is published when a request is answered with a failed response envelope
+	EventRejected EventKind = "rejected"
+)
+
+// Event represents a single entry in the live event feed
+type Event struct {
+	Kind        EventKind `json:"kind"`
+	Server      string    `json:"server"`
+	Transport   string    `json:"transport"`
+	Hop         string    `json:"hop"`
+	LatencyMs   float64   `json:"latency_ms"`
+	Error       string    `json:"error,omitempty"`
+	Signature   string    `json:"signature,omitempty"`   // Signature status of a received message (verified, unsigned, unknown_peer, invalid)
+	Codec       string    `json:"codec,omitempty"`       // Wire codec of the message (json, cbor, msgpack, protobuf)
+	Bytes       int       `json:"bytes,omitempty"`       // Encoded size of the message
+	Compression string    `json:"compression,omitempty"` // Compression negotiated for the payload (zstd, gzip)
+	WireBytes   int       `json:"wire_bytes,omitempty"`  // Size on the wire when a compression was negotiated
+	Message     *Message  `json:"message,omitempty"`
+	Time        time.Time `json:"time"`
+}
+
+// NewEvent creates a new event for the given message.
+// Hop identifies the edge of the chain the latency belongs to (e.g. "server2 -> server1").
+func NewEvent(kind EventKind, server, transport, hop string, message *Message, latency time.Duration) *Event {
+	return &Event{
+		Kind:      kind,
+		Server:    server,
+		Transport: transport,
+		Hop:       hop,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		Message:   message,
+		Time:      time.Now(),
+	}
+}
+
+// ToJSON converts event to JSON bytes
+func (e *Event) ToJSON() ([]byte, error) {
+	return json.Marshal(e)
+}
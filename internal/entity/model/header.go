@@ -0,0 +1,33 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ProtocolVersion is the newest envelope format written and accepted by this build
+const ProtocolVersion = 1
+
+// MinProtocolVersion is the oldest envelope format still accepted (and used for hello messages)
+const MinProtocolVersion = 1
+
+// ErrUnsupportedVersion is returned (wrapped) for envelopes of another protocol version
+var ErrUnsupportedVersion = errors.New("unsupported protocol version")
+
+// Header is the versioned header of every request and response envelope
+type Header struct {
+	Version int `json:"version"` // Protocol version of the envelope
+}
+
+// NewHeader returns the header of an envelope written by this build
+func NewHeader() Header {
+	return Header{Version: ProtocolVersion}
+}
+
+// Check returns ErrUnsupportedVersion (wrapped) unless the envelope has a supported version
+func (h Header) Check() error {
+	if h.Version < MinProtocolVersion || h.Version > ProtocolVersion {
+		return fmt.Errorf("%w %d (this server speaks versions %d-%d)", ErrUnsupportedVersion, h.Version, MinProtocolVersion, ProtocolVersion)
+	}
+	return nil
+}
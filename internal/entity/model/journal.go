@@ -0,0 +1,42 @@
+package model
+
+// Journal entry directions
+const (
+	DirectionIn  = "in"  // Message received from a client or peer
+	DirectionOut = "out" // Message sent back to the sender or echoed to a target
+)
+
+// Journal entry outcomes
+const (
+	OutcomeOK        = "ok"
+	OutcomeDuplicate = "duplicate"
+	OutcomeRejected  = "rejected"
+	OutcomeFailed    = "failed"
+)
+
+// JournalEntry is one line of the message journal: an event with the metadata
+// needed to reconstruct chains after a run
+type JournalEntry struct {
+	Event
+	Direction string `json:"direction"`           // in or out
+	Outcome   string `json:"outcome"`             // ok, duplicate, rejected or failed
+	Code      string `json:"code,omitempty"`      // Response code of a rejection
+	Remote    string `json:"remote,omitempty"`    // Remote address of the sender, or the target URL
+	StreamID  *int64 `json:"stream_id,omitempty"` // WebTransport stream the message was received or answered on
+}
+
+// NewJournalEntry creates the journal entry of an event
+func NewJournalEntry(event *Event, remote string, streamID *int64, code string) *JournalEntry {
+	entry := &JournalEntry{Event: *event, Direction: DirectionIn, Outcome: OutcomeOK, Code: code, Remote: remote, StreamID: streamID}
+	switch event.Kind {
+	case EventResponded, EventEchoSent:
+		entry.Direction = DirectionOut
+	case EventEchoFailed:
+		entry.Direction, entry.Outcome = DirectionOut, OutcomeFailed
+	case EventDuplicate:
+		entry.Outcome = OutcomeDuplicate
+	case EventRejected:
+		entry.Outcome = OutcomeRejected
+	}
+	return entry
+}
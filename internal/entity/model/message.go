@@ -1,7 +1,16 @@
 package model
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -13,22 +22,49 @@ const (
 	PingMessage MessageType = "ping"
 	// PongMessage represents a pong message
 	PongMessage MessageType = "pong"
+	// HelloMessage carries the sender's capabilities (JSON) and is answered with the receiver's
+	HelloMessage MessageType = "hello"
+	// EchoMessage is answered with its own content and not forwarded
+	EchoMessage MessageType = "echo"
+	// StopMessage ends the chain it belongs to on every server it reaches
+	StopMessage MessageType = "stop"
+	// StatsMessage is answered with the receiving server's counters
+	StatsMessage MessageType = "stats"
+	// AttachmentMessage describes a binary attachment (JSON) streamed in chunks after it
+	AttachmentMessage MessageType = "attachment"
+	// CustomPrefix starts application-defined types such as "custom:trace"
+	CustomPrefix = "custom:"
 )
 
+// SequenceBlock is how many sequence numbers a server reserves with one state
+// write. Blocks end at multiples of it, so a server restarting after a crash
+// continues right after one.
+const SequenceBlock = 100
+
+// messageTypePattern is the syntax of a type: a lowercase name with an optional ":"-separated suffix
+var messageTypePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*(:[a-z0-9_.-]+)?$`)
+
 // Message represents a ping-pong message exchanged between servers
 type Message struct {
+	ID        string      `json:"id"`    // Unique message ID, the key of the receiver's dedupe window
+	Nonce     string      `json:"nonce"` // Random value making every message (and its signature) unique
 	Type      MessageType `json:"type"`
 	Content   string      `json:"content"`
 	Timestamp time.Time   `json:"timestamp"`
 	Sequence  int         `json:"sequence"`
 	From      string      `json:"from"`
 	To        string      `json:"to"`
+	Chain     string      `json:"chain,omitempty"`     // ID of the ping-pong chain, kept by every response
+	Hop       int         `json:"hop,omitempty"`       // Hops since the chain started (the client's ping is hop 0)
+	Signature string      `json:"signature,omitempty"` // Base64 Ed25519 signature of SigningBytes by the sender
 }
 
-// NewPingMessage creates a new ping message
-func NewPingMessage(content string, sequence int, from, to string) *Message {
+// NewMessage creates a new message of the given type with a fresh ID and nonce
+func NewMessage(kind MessageType, content string, sequence int, from, to string) *Message {
 	return &Message{
-		Type:      PingMessage,
+		ID:        randomHex(16),
+		Nonce:     randomHex(12),
+		Type:      kind,
 		Content:   content,
 		Timestamp: time.Now(),
 		Sequence:  sequence,
@@ -37,16 +73,35 @@ func NewPingMessage(content string, sequence int, from, to string) *Message {
 	}
 }
 
+// NewPingMessage creates a new ping message
+func NewPingMessage(content string, sequence int, from, to string) *Message {
+	return NewMessage(PingMessage, content, sequence, from, to)
+}
+
 // NewPongMessage creates a new pong message
 func NewPongMessage(content string, sequence int, from, to string) *Message {
-	return &Message{
-		Type:      PongMessage,
-		Content:   content,
-		Timestamp: time.Now(),
-		Sequence:  sequence,
-		From:      from,
-		To:        to,
+	return NewMessage(PongMessage, content, sequence, from, to)
+}
+
+// NewChainID returns a random ID for a new ping-pong chain
+func NewChainID() string {
+	return randomHex(8)
+}
+
+// randomHex returns n random bytes hex-encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ChainKey identifies the chain for rate limiting; messages without a chain
+// ID are grouped by sender
+func (m *Message) ChainKey() string {
+	if m.Chain != "" {
+		return m.Chain
 	}
+	return "from:" + m.From
 }
 
 // ToJSON converts message to JSON bytes
@@ -54,11 +109,77 @@ func (m *Message) ToJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
-// FromJSON creates message from JSON bytes
+// ErrInvalidMessage is returned (wrapped) for messages that do not decode or fail validation
+var ErrInvalidMessage = errors.New("invalid message")
+
+// FromJSON decodes and validates a message. Unknown fields, trailing data and
+// messages failing Validate are rejected.
 func FromJSON(data []byte) (*Message, error) {
 	var msg Message
-	err := json.Unmarshal(data, &msg)
-	return &msg, err
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	if decoder.More() {
+		return nil, fmt.Errorf("%w: unexpected data after the JSON object", ErrInvalidMessage)
+	}
+	if err := msg.Validate(); err != nil {
+		return nil, err
+	}
+	return &msg, nil
+}
+
+// Validate checks the required fields and value ranges
+func (m *Message) Validate() error {
+	var problems []string
+	switch {
+	case m.Type == "":
+		problems = append(problems, "type is required")
+	case len(m.Type) > 64 || !messageTypePattern.MatchString(string(m.Type)):
+		problems = append(problems, fmt.Sprintf("type must be a lowercase name such as %q or %q (got %q)", PingMessage, CustomPrefix+"trace", m.Type))
+	}
+	if m.Sequence < 0 {
+		problems = append(problems, fmt.Sprintf("sequence must not be negative (got %d)", m.Sequence))
+	}
+	if m.Hop < 0 {
+		problems = append(problems, fmt.Sprintf("hop must not be negative (got %d)", m.Hop))
+	}
+	if m.From == "" {
+		problems = append(problems, "from is required")
+	}
+	if m.Timestamp.IsZero() {
+		problems = append(problems, "timestamp is required")
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidMessage, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// SigningBytes returns the canonical encoding covered by the signature: every
+// field except the signature, each prefixed with its length, with the
+// timestamp in Unix nanoseconds so the result does not depend on the wire format
+func (m *Message) SigningBytes() []byte {
+	fields := []string{
+		"magic-cylinder/message/v2",
+		m.ID,
+		m.Nonce,
+		string(m.Type),
+		m.Content,
+		strconv.FormatInt(m.Timestamp.UnixNano(), 10),
+		strconv.Itoa(m.Sequence),
+		m.From,
+		m.To,
+		m.Chain,
+		strconv.Itoa(m.Hop),
+	}
+	var buf []byte
+	for _, field := range fields {
+		buf = binary.AppendUvarint(buf, uint64(len(field)))
+		buf = append(buf, field...)
+	}
+	return buf
 }
 
 // String returns a string representation of the message
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"crypto/tls"
+	"slices"
+	"strings"
+)
+
+// Peer is the identity of a sender proven by a verified client certificate
+type Peer struct {
+	CommonName string   `json:"common_name"`
+	DNSNames   []string `json:"dns_names,omitempty"`
+}
+
+// PeerFromTLS returns the verified client identity of a connection, or nil
+// when no client certificate was presented or it was not verified
+func PeerFromTLS(state *tls.ConnectionState) *Peer {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	leaf := state.VerifiedChains[0][0]
+	return &Peer{
+		CommonName: leaf.Subject.CommonName,
+		DNSNames:   leaf.DNSNames,
+	}
+}
+
+// Names returns the names the peer may use as a sender (CN and DNS SANs)
+func (p *Peer) Names() []string {
+	names := make([]string, 0, len(p.DNSNames)+1)
+	if p.CommonName != "" {
+		names = append(names, p.CommonName)
+	}
+	return append(names, p.DNSNames...)
+}
+
+// Matches reports whether the name is the certificate CN or one of its DNS SANs
+func (p *Peer) Matches(name string) bool {
+	return slices.Contains(p.Names(), name)
+}
+
+// String returns the names for log output
+func (p *Peer) String() string {
+	if p == nil {
+		return "anonymous"
+	}
+	return strings.Join(p.Names(), ",")
+}
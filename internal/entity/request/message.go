@@ -1,13 +1,30 @@
 package request
 
-import "github.com/ryo-arima/magic-cylinder/internal/entity/model"
+import (
+	"fmt"
 
-// PingRequest represents a ping request
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// PingRequest is the envelope of every message sent to a server (ping, pong and
+// the other registered types), on WebTransport streams and /plain bodies
 type PingRequest struct {
+	Header  model.Header   `json:"header"`
 	Message *model.Message `json:"message"`
 }
 
-// PongRequest represents a pong request
-type PongRequest struct {
-	Message *model.Message `json:"message"`
+// NewPingRequest wraps a message in a request envelope of the current protocol version
+func NewPingRequest(message *model.Message) *PingRequest {
+	return &PingRequest{Header: model.NewHeader(), Message: message}
+}
+
+// Validate checks the header version and the enclosed message
+func (r *PingRequest) Validate() error {
+	if err := r.Header.Check(); err != nil {
+		return err
+	}
+	if r.Message == nil {
+		return fmt.Errorf("%w: message is required", model.ErrInvalidMessage)
+	}
+	return r.Message.Validate()
 }
@@ -0,0 +1,50 @@
+package response
+
+import "time"
+
+// HealthResponse represents the body returned by /livez and /readyz
+type HealthResponse struct {
+	Status         string             `json:"status"`
+	Server         string             `json:"server"`
+	Listeners      []ListenerStatus   `json:"listeners"`
+	Certificate    *CertificateStatus `json:"certificate,omitempty"`
+	ActiveSessions int                `json:"active_sessions"`
+	Targets        []TargetStatus     `json:"targets,omitempty"`
+	Time           time.Time          `json:"time"`
+}
+
+// ListenerStatus represents the state of a TCP or UDP listener
+type ListenerStatus struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Up      bool   `json:"up"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CertificateStatus represents the serving certificate and its expiry
+type CertificateStatus struct {
+	Subject          string    `json:"subject"`
+	NotAfter         time.Time `json:"not_after"`
+	ExpiresInSeconds int64     `json:"expires_in_seconds"`
+	Valid            bool      `json:"valid"`
+	SHA256           string    `json:"sha256"`          // Hex hash for WebTransport serverCertificateHashes
+	HashCompatible   bool      `json:"hash_compatible"` // Usable with serverCertificateHashes (ECDSA, <= 14 days)
+}
+
+// TargetStatus represents the reachability of a configured echo target
+type TargetStatus struct {
+	URL          string      `json:"url"`
+	Transport    string      `json:"transport"`
+	Reachable    bool        `json:"reachable"`
+	WebTransport ProbeResult `json:"webtransport"`
+	Plain        ProbeResult `json:"plain"`
+	CheckedAt    time.Time   `json:"checked_at"` // When the probes ran (results are cached for transport.probe_cache_ttl)
+}
+
+// ProbeResult represents the outcome of a single reachability probe
+type ProbeResult struct {
+	URL       string  `json:"url"`
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
@@ -1,17 +1,84 @@
 package response
 
-import "github.com/ryo-arima/magic-cylinder/internal/entity/model"
+import (
+	"fmt"
 
-// PingResponse represents a ping response
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Error codes of a failed PingResponse
+const (
+	CodeInvalidMessage     = "invalid_message"     // Malformed envelope or message failing validation
+	CodeUnsupportedVersion = "unsupported_version" // Envelope header of another protocol version
+	CodeUnsupportedType    = "unsupported_type"    // Message type without a registered handler
+	CodeUnsupportedMedia   = "unsupported_media"   // /plain Content-Type or Content-Encoding not accepted
+	CodeTooLarge           = "too_large"           // Frame or body over the configured limit
+	CodeUnauthorized       = "unauthorized"        // Missing or invalid credentials
+	CodeForbidden          = "forbidden"           // Sender does not match its client certificate or is not allowed
+	CodeBadSignature       = "bad_signature"       // Unsigned or tampered message (signing policy reject)
+	CodeRateLimited        = "rate_limited"        // Per-client or per-chain rate limit exceeded
+	CodeTooManyStreams     = "too_many_streams"    // Concurrent streams of the session exceeded
+	CodeReplay             = "replay"              // Missing or reused message ID, or stale timestamp
+	CodeInternal           = "internal"            // Handler or encoding failure on the server
+)
+
+// PingResponse is the envelope of every server reply: the reply message on
+// success, an error code and reason otherwise
 type PingResponse struct {
-	Message *model.Message `json:"message"`
+	Header  model.Header   `json:"header"`
+	Message *model.Message `json:"message,omitempty"`
 	Success bool           `json:"success"`
 	Error   string         `json:"error,omitempty"`
+
+	Code       string `json:"code,omitempty"`        // Error code (see Code* constants)
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds to wait before retrying a rate-limited message
+	Duplicate  bool   `json:"duplicate,omitempty"`   // The message was already processed; Message is the original reply (nil while pending)
 }
 
-// PongResponse represents a pong response
-type PongResponse struct {
-	Message *model.Message `json:"message"`
-	Success bool           `json:"success"`
-	Error   string         `json:"error,omitempty"`
+// NewPingResponse wraps a reply message in a successful response envelope
+func NewPingResponse(message *model.Message) *PingResponse {
+	return &PingResponse{Header: model.NewHeader(), Message: message, Success: true}
+}
+
+// NewErrorResponse creates a failed response envelope with an error code and reason
+func NewErrorResponse(code, reason string) *PingResponse {
+	return &PingResponse{Header: model.NewHeader(), Code: code, Error: reason}
+}
+
+// Validate checks the header version and, on success, the enclosed message
+func (r *PingResponse) Validate() error {
+	if err := r.Header.Check(); err != nil {
+		return err
+	}
+	if !r.Success {
+		if r.Code == "" {
+			return fmt.Errorf("%w: failed response without an error code", model.ErrInvalidMessage)
+		}
+		return nil
+	}
+	if r.Message == nil {
+		// A duplicate still being processed has no reply yet
+		if r.Duplicate {
+			return nil
+		}
+		return fmt.Errorf("%w: message is required", model.ErrInvalidMessage)
+	}
+	return r.Message.Validate()
+}
+
+// Err returns the error reported by a failed response (nil on success)
+func (r *PingResponse) Err() error {
+	if r.Success {
+		return nil
+	}
+	return fmt.Errorf("%s: %s", r.Code, r.Error)
+}
+
+// EchoResult represents an echo delivered to a target
+type EchoResult struct {
+	Codec string `json:"codec"` // Codec the echoed message was encoded with
+	Bytes int    `json:"bytes"` // Encoded size of the echoed message
+
+	Compression string `json:"compression,omitempty"` // Compression negotiated with the target (empty for none)
+	WireBytes   int    `json:"wire_bytes,omitempty"`  // Size of the echoed message on the wire when compression was negotiated
 }
@@ -0,0 +1,57 @@
+package response
+
+import (
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// RuntimeStats represents the body returned by the admin /debug/runtime endpoint
+type RuntimeStats struct {
+	Server         string                            `json:"server"`
+	StartedAt      time.Time                         `json:"started_at"`
+	UptimeSeconds  float64                           `json:"uptime_seconds"`
+	GoVersion      string                            `json:"go_version"`
+	NumCPU         int                               `json:"num_cpu"`
+	GOMAXPROCS     int                               `json:"gomaxprocs"`
+	Goroutines     int                               `json:"goroutines"`
+	ActiveSessions int                               `json:"active_sessions"`
+	ActiveStreams  int                               `json:"active_streams"`
+	InFlightEchoes int                               `json:"in_flight_echoes"`
+	Compression    map[string]CompressionStats       `json:"compression"` // Keyed by algorithm
+	Peers          map[string]model.PeerCapabilities `json:"peers"`       // Hellos sent, keyed by target URL
+	Senders        map[string]model.PeerCapabilities `json:"senders"`     // Hellos answered, keyed by sender name
+	Memory         MemoryStats                       `json:"memory"`
+	GC             GCStats                           `json:"gc"`
+	Time           time.Time                         `json:"time"`
+}
+
+// MemoryStats represents a subset of runtime.MemStats
+type MemoryStats struct {
+	HeapAllocBytes  uint64 `json:"heap_alloc_bytes"`
+	HeapInuseBytes  uint64 `json:"heap_inuse_bytes"`
+	HeapObjects     uint64 `json:"heap_objects"`
+	StackInuseBytes uint64 `json:"stack_inuse_bytes"`
+	SysBytes        uint64 `json:"sys_bytes"`
+	TotalAllocBytes uint64 `json:"total_alloc_bytes"`
+	Mallocs         uint64 `json:"mallocs"`
+	Frees           uint64 `json:"frees"`
+}
+
+// GCStats represents garbage collector statistics
+type GCStats struct {
+	NumGC        uint32    `json:"num_gc"`
+	LastGC       time.Time `json:"last_gc"`
+	PauseTotalMs float64   `json:"pause_total_ms"`
+	NextGCBytes  uint64    `json:"next_gc_bytes"`
+	CPUFraction  float64   `json:"cpu_fraction"`
+}
+
+// CompressionStats represents the payloads sent and received with one compression algorithm
+type CompressionStats struct {
+	Payloads   int64   `json:"payloads"`   // Payloads of sessions/requests using the algorithm
+	Compressed int64   `json:"compressed"` // Payloads that were compressed (the rest were below the threshold)
+	RawBytes   int64   `json:"raw_bytes"`  // Encoded message size before compression
+	WireBytes  int64   `json:"wire_bytes"` // Size on the wire
+	Ratio      float64 `json:"ratio"`      // raw_bytes / wire_bytes
+}
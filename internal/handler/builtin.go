@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/repository"
+)
+
+// stats is the content of the reply to a stats message
+type stats struct {
+	Server         string   `json:"server"`
+	Sequence       int      `json:"sequence"`
+	Sessions       int      `json:"sessions"`
+	Streams        int      `json:"streams"`
+	InFlightEchoes int      `json:"in_flight_echoes"`
+	DedupeEntries  int      `json:"dedupe_entries"`
+	StoppedChains  int      `json:"stopped_chains"`
+	Types          []string `json:"types"`
+}
+
+// builtins holds the dependencies of the built-in handlers
+type builtins struct {
+	name          string
+	repo          repository.CommonRepository
+	health        repository.HealthRepository
+	dedupe        repository.DedupeRepository
+	peers         repository.PeerRepository
+	registry      *Registry
+	stopped       *chainSet
+	forwardCustom bool
+	maxHops       int // Hops after which attachments are no longer forwarded
+}
+
+// NewBuiltinRegistry creates a registry with the ping, pong and hello handlers and
+// the built-in handlers enabled by cfg.Handlers.Enabled
+func NewBuiltinRegistry(cfg *config.ServerConfig, repo repository.CommonRepository, health repository.HealthRepository, dedupe repository.DedupeRepository, peers repository.PeerRepository) (*Registry, error) {
+	registry := NewRegistry()
+	b := &builtins{
+		name:          cfg.Name,
+		repo:          repo,
+		health:        health,
+		dedupe:        dedupe,
+		peers:         peers,
+		registry:      registry,
+		stopped:       newChainSet(cfg.Dedupe.Window.Std()),
+		forwardCustom: cfg.Handlers.ForwardCustom,
+		maxHops:       cfg.Attachments.MaxHops,
+	}
+
+	handlers := map[string]Handler{
+		string(model.PingMessage):       Func(b.ping),
+		string(model.PongMessage):       Func(b.pong),
+		string(model.HelloMessage):      Func(b.hello),
+		string(model.EchoMessage):       Func(b.echo),
+		string(model.StopMessage):       Func(b.stop),
+		string(model.StatsMessage):      Func(b.stats),
+		string(model.AttachmentMessage): Func(b.attachment),
+		model.CustomPrefix + "*":        Func(b.custom),
+	}
+	for _, pattern := range cfg.Handlers.Types() {
+		h, ok := handlers[pattern]
+		if !ok {
+			return nil, fmt.Errorf("unknown built-in handler %q (use one of %s)", pattern, strings.Join(config.Handlers, ", "))
+		}
+		if err := registry.Register(pattern, h); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// ping answers with the next pong and forwards it unless the chain was stopped
+func (b *builtins) ping(message *model.Message) (Result, error) {
+	reply, err := b.repo.ProcessPing(message)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to process ping: %w", err)
+	}
+	return Result{Reply: reply, Forward: !b.isStopped(message)}, nil
+}
+
+// pong answers with the next ping and forwards it unless the chain was stopped
+func (b *builtins) pong(message *model.Message) (Result, error) {
+	reply, err := b.repo.ProcessPong(message)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to process pong: %w", err)
+	}
+	return Result{Reply: reply, Forward: !b.isStopped(message)}, nil
+}
+
+// hello records the capabilities advertised by the sender and answers with this
+// server's, so both sides of the exchange know what the other speaks. The sender
+// name is unverified without client certificates, so the result is kept apart
+// from the target cache the echoes use.
+func (b *builtins) hello(message *model.Message) (Result, error) {
+	var remote model.Capabilities
+	if err := json.Unmarshal([]byte(message.Content), &remote); err != nil {
+		return Result{}, fmt.Errorf("%w: hello content is not a capabilities object: %v", model.ErrInvalidMessage, err)
+	}
+	local := b.peers.Local()
+	peer, err := model.Negotiate(local, remote)
+	if err != nil {
+		log.Printf("[Handler] ⚠ Hello from %s refused: %v", message.From, err)
+	} else {
+		log.Printf("[Handler] ✅ Hello from %s: version %d, codecs %v, compression %v", message.From, peer.Version, remote.Codecs, remote.Compression)
+	}
+	b.peers.PutSender(message.From, &peer)
+	data, err := json.Marshal(local)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode capabilities: %w", err)
+	}
+	return Result{Reply: b.repo.NewReply(model.HelloMessage, message, string(data))}, nil
+}
+
+// echo answers with the received content and ends there
+func (b *builtins) echo(message *model.Message) (Result, error) {
+	return Result{Reply: b.repo.NewReply(model.EchoMessage, message, message.Content)}, nil
+}
+
+// stop marks the chain stopped and passes the stop on to the targets the first
+// time it is seen, so a stop travels the loop once and then dies out
+func (b *builtins) stop(message *model.Message) (Result, error) {
+	first := b.stopped.Add(message.ChainKey())
+	if first {
+		log.Printf("[Handler] ⏳ Chain %s stopped by %s", message.ChainKey(), message.From)
+	}
+	content := fmt.Sprintf("chain %s stopped on %s", message.ChainKey(), b.name)
+	return Result{Reply: b.repo.NewReply(model.StopMessage, message, content), Forward: first}, nil
+}
+
+// stats answers with the server counters as JSON
+func (b *builtins) stats(message *model.Message) (Result, error) {
+	data, err := json.Marshal(stats{
+		Server:         b.name,
+		Sequence:       b.repo.GetSequence(),
+		Sessions:       b.health.ActiveSessions(),
+		Streams:        b.health.ActiveStreams(),
+		InFlightEchoes: b.health.InFlightEchoes(),
+		DedupeEntries:  b.dedupe.Size(),
+		StoppedChains:  b.stopped.Len(),
+		Types:          b.registry.Types(),
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to encode stats: %w", err)
+	}
+	return Result{Reply: b.repo.NewReply(model.StatsMessage, message, string(data))}, nil
+}
+
+// attachment answers with the same descriptor once the attachment arrived intact (the
+// controller streams the payload) and forwards it until attachments.max_hops is reached
+func (b *builtins) attachment(message *model.Message) (Result, error) {
+	if _, err := model.ParseAttachment(message.Content); err != nil {
+		return Result{}, err
+	}
+	reply := b.repo.NewReply(model.AttachmentMessage, message, message.Content)
+	forward := reply.Hop < b.maxHops
+	if !forward {
+		log.Printf("[Handler] ⏳ Attachment on chain %s reached %d hops, not forwarding", message.ChainKey(), reply.Hop)
+	}
+	return Result{Reply: reply, Forward: forward && !b.isStopped(message)}, nil
+}
+
+// custom acknowledges an application-defined message with a reply of the same
+// type, forwarded when handlers.forward_custom is set and the chain is running
+func (b *builtins) custom(message *model.Message) (Result, error) {
+	reply := b.repo.NewReply(message.Type, message, message.Content)
+	return Result{Reply: reply, Forward: b.forwardCustom && !b.isStopped(message)}, nil
+}
+
+// isStopped reports whether a stop was received for the message's chain
+func (b *builtins) isStopped(message *model.Message) bool {
+	if b.stopped.Contains(message.ChainKey()) {
+		log.Printf("[Handler] ⚠ Chain %s is stopped, not forwarding %s seq %d", message.ChainKey(), message.Type, message.Sequence)
+		return true
+	}
+	return false
+}
+
+// chainSet remembers stopped chains for a limited time
+type chainSet struct {
+	ttl    time.Duration
+	mu     sync.Mutex
+	chains map[string]time.Time // Chain key -> expiry
+}
+
+// newChainSet creates a set whose entries expire after ttl
+func newChainSet(ttl time.Duration) *chainSet {
+	return &chainSet{ttl: ttl, chains: make(map[string]time.Time)}
+}
+
+// Add records a chain and reports whether it was not already present
+func (s *chainSet) Add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	_, exists := s.chains[key]
+	s.chains[key] = now.Add(s.ttl)
+	return !exists
+}
+
+// Contains reports whether a chain is present
+func (s *chainSet) Contains(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.chains[key]
+	return ok && time.Now().Before(expiry)
+}
+
+// Len returns the number of chains present
+func (s *chainSet) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(time.Now())
+	return len(s.chains)
+}
+
+// sweep drops expired chains; the caller holds s.mu
+func (s *chainSet) sweep(now time.Time) {
+	for key, expiry := range s.chains {
+		if !now.Before(expiry) {
+			delete(s.chains, key)
+		}
+	}
+}
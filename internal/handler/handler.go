@@ -0,0 +1,112 @@
+// Package handler dispatches received messages to the handler registered for
+// their type. Each handler decides the reply sent back to the sender and
+// whether that reply is echoed to the configured targets.
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// ErrUnknownType is returned (wrapped) by Lookup for a type without a handler
+var ErrUnknownType = errors.New("unsupported message type")
+
+// Result is the outcome of handling a message
+type Result struct {
+	Reply   *model.Message // Message sent back to the sender
+	Forward bool           // Echo Reply to the configured targets
+}
+
+// Handler processes messages of one type (or one family of types)
+type Handler interface {
+	// Handle processes a verified, deduplicated message
+	Handle(message *model.Message) (Result, error)
+}
+
+// Func adapts a function to the Handler interface
+type Func func(message *model.Message) (Result, error)
+
+// Handle calls f(message)
+func (f Func) Handle(message *model.Message) (Result, error) {
+	return f(message)
+}
+
+// Registry maps message types to handlers. A pattern is either an exact type
+// such as "ping" or a prefix followed by "*" such as "custom:*".
+type Registry struct {
+	mu       sync.RWMutex
+	exact    map[model.MessageType]Handler
+	prefixes map[string]Handler
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		exact:    make(map[model.MessageType]Handler),
+		prefixes: make(map[string]Handler),
+	}
+}
+
+// Register adds the handler of a pattern; registering a pattern twice is an error
+func (r *Registry) Register(pattern string, h Handler) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		if prefix == "" || strings.Contains(prefix, "*") {
+			return fmt.Errorf("invalid handler pattern %q", pattern)
+		}
+		if _, exists := r.prefixes[prefix]; exists {
+			return fmt.Errorf("handler for %q already registered", pattern)
+		}
+		r.prefixes[prefix] = h
+		return nil
+	}
+	if pattern == "" || strings.Contains(pattern, "*") {
+		return fmt.Errorf("invalid handler pattern %q", pattern)
+	}
+	if _, exists := r.exact[model.MessageType(pattern)]; exists {
+		return fmt.Errorf("handler for %q already registered", pattern)
+	}
+	r.exact[model.MessageType(pattern)] = h
+	return nil
+}
+
+// Lookup returns the handler of a type: the exact match, else the longest matching prefix
+func (r *Registry) Lookup(kind model.MessageType) (Handler, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if h, ok := r.exact[kind]; ok {
+		return h, nil
+	}
+	var match Handler
+	longest := -1
+	for prefix, h := range r.prefixes {
+		if strings.HasPrefix(string(kind), prefix) && len(prefix) > longest {
+			match, longest = h, len(prefix)
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, kind)
+	}
+	return match, nil
+}
+
+// Types returns the registered patterns in sorted order
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	types := make([]string, 0, len(r.exact)+len(r.prefixes))
+	for kind := range r.exact {
+		types = append(types, string(kind))
+	}
+	for prefix := range r.prefixes {
+		types = append(types, prefix+"*")
+	}
+	sort.Strings(types)
+	return types
+}
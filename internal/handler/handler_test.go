@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// named returns a handler replying with its name as content
+func named(name string) Handler {
+	return Func(func(*model.Message) (Result, error) {
+		return Result{Reply: &model.Message{Content: name}}, nil
+	})
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewRegistry()
+	for _, pattern := range []string{"ping", "custom:*", "custom:trace*", "custom:trace", "x*"} {
+		if err := r.Register(pattern, named(pattern)); err != nil {
+			t.Fatalf("Register(%q) = %v", pattern, err)
+		}
+	}
+	tests := []struct {
+		kind    model.MessageType
+		want    string
+		wantErr error
+	}{
+		{kind: "ping", want: "ping"},
+		{kind: "custom:metrics", want: "custom:*"},
+		{kind: "custom:trace", want: "custom:trace"}, // Exact match before the longer prefix
+		{kind: "custom:trace.v2", want: "custom:trace*"},
+		{kind: "custom:", want: "custom:*"},
+		{kind: "xyz", want: "x*"},
+		{kind: "pong", wantErr: ErrUnknownType},
+		{kind: "custom", wantErr: ErrUnknownType},
+		{kind: "", wantErr: ErrUnknownType},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.kind), func(t *testing.T) {
+			h, err := r.Lookup(tt.kind)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Lookup() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			result, _ := h.Handle(&model.Message{Type: tt.kind})
+			if result.Reply.Content != tt.want {
+				t.Errorf("Lookup(%q) returned the %q handler, want %q", tt.kind, result.Reply.Content, tt.want)
+			}
+		})
+	}
+	if want := []string{"custom:*", "custom:trace", "custom:trace*", "ping", "x*"}; !reflect.DeepEqual(r.Types(), want) {
+		t.Errorf("Types() = %v, want %v", r.Types(), want)
+	}
+}
+
+func TestRegistryRegisterErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		pattern  string
+		wantErr  string
+	}{
+		{name: "empty pattern", pattern: "", wantErr: "invalid handler pattern"},
+		{name: "lone wildcard", pattern: "*", wantErr: "invalid handler pattern"},
+		{name: "wildcard inside an exact type", pattern: "cus*tom", wantErr: "invalid handler pattern"},
+		{name: "two wildcards", pattern: "custom:**", wantErr: "invalid handler pattern"},
+		{name: "exact type twice", existing: []string{"ping"}, pattern: "ping", wantErr: "already registered"},
+		{name: "prefix twice", existing: []string{"custom:*"}, pattern: "custom:*", wantErr: "already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewRegistry()
+			for _, pattern := range tt.existing {
+				if err := r.Register(pattern, named(pattern)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := r.Register(tt.pattern, named(tt.pattern))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Register(%q) = %v, want an error containing %q", tt.pattern, err, tt.wantErr)
+			}
+			if len(r.Types()) != len(tt.existing) {
+				t.Errorf("Types() = %v after the failed registration", r.Types())
+			}
+		})
+	}
+}
+
+func TestNewBuiltinRegistry(t *testing.T) {
+	tests := []struct {
+		name      string
+		enabled   []string
+		wantTypes []string
+		wantErr   string
+	}{
+		{name: "base types only", wantTypes: []string{"hello", "ping", "pong"}},
+		{name: "every built-in", enabled: config.Handlers, wantTypes: []string{"attachment", "custom:*", "echo", "hello", "ping", "pong", "stats", "stop"}},
+		{name: "unknown handler", enabled: []string{"echo", "shout"}, wantErr: `unknown built-in handler "shout"`},
+		{name: "enabled twice", enabled: []string{"stop", "stop"}, wantErr: "already registered"},
+		{name: "base type enabled again", enabled: []string{"ping"}, wantErr: "already registered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.NewServerConfig()
+			cfg.Handlers.Enabled = tt.enabled
+			r, err := NewBuiltinRegistry(cfg, nil, nil, nil, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("NewBuiltinRegistry() = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(r.Types(), tt.wantTypes) {
+				t.Errorf("Types() = %v, want %v", r.Types(), tt.wantTypes)
+			}
+		})
+	}
+}
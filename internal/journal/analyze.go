@@ -0,0 +1,341 @@
+// Package journal reads the JSONL message journals written by the servers and
+// reports on the chains they recorded.
+package journal
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Latency kinds of a hop report
+const (
+	LatencyTransit    = "transit"    // Message timestamp to receipt (depends on clock sync between servers)
+	LatencyProcessing = "processing" // Receipt to reply written back, on the receiving server
+	LatencyRoundTrip  = "round_trip" // Echo sent to its reply received, on the sending server
+)
+
+// Report is the analysis of one or more merged journals
+type Report struct {
+	Files      []string         `json:"files"`
+	Entries    int              `json:"entries"`
+	Skipped    int              `json:"skipped"` // Lines that are not journal entries
+	Servers    []string         `json:"servers"` // Servers that wrote the journals
+	From       time.Time        `json:"from"`
+	To         time.Time        `json:"to"`
+	Totals     Totals           `json:"totals"`
+	Chains     []ChainReport    `json:"chains"`
+	Hops       []HopReport      `json:"hops"`
+	Sequences  []SequenceReport `json:"sequences"`
+	Failures   []FailureReport  `json:"failures"`
+	Bucket     string           `json:"bucket"` // Width of the throughput buckets
+	Throughput []Bucket         `json:"throughput"`
+}
+
+// Totals counts the entries and problems over all journals
+type Totals struct {
+	Messages     int `json:"messages"`      // Distinct message IDs
+	Received     int `json:"received"`      // Messages received and processed
+	Sent         int `json:"sent"`          // Replies and echoes sent
+	Duplicates   int `json:"duplicates"`    // Messages acknowledged as duplicates
+	Rejected     int `json:"rejected"`      // Messages answered with a failed response
+	Failed       int `json:"failed"`        // Echoes that failed
+	MissingHops  int `json:"missing_hops"`  // Hops absent from their chain
+	SequenceGaps int `json:"sequence_gaps"` // Sequence numbers absent from their sender's range
+}
+
+// ChainReport describes one reconstructed chain
+type ChainReport struct {
+	Chain       string    `json:"chain"`
+	Messages    int       `json:"messages"` // Distinct message IDs
+	FirstHop    int       `json:"first_hop"`
+	LastHop     int       `json:"last_hop"`
+	Servers     []string  `json:"servers"` // Servers that journaled the chain
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	DurationMs  float64   `json:"duration_ms"`
+	MissingHops []int     `json:"missing_hops,omitempty"` // Hops between the first and last one never journaled
+	Duplicates  int       `json:"duplicates"`
+	Rejected    int       `json:"rejected"`
+	Failed      int       `json:"failed"`
+	Stopped     bool      `json:"stopped"` // A stop message went through the chain
+}
+
+// Problems returns the number of missing hops, duplicates, rejections and failures
+func (c *ChainReport) Problems() int {
+	return len(c.MissingHops) + c.Duplicates + c.Rejected + c.Failed
+}
+
+// HopReport holds the latency percentiles of one edge (e.g. "server1 -> server2")
+type HopReport struct {
+	Hop   string  `json:"hop"`
+	Kind  string  `json:"kind"` // transit, processing or round_trip
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P90   float64 `json:"p90_ms"`
+	P99   float64 `json:"p99_ms"`
+	Max   float64 `json:"max_ms"`
+}
+
+// SequenceReport describes the sequence numbers seen from one sender. Hello
+// messages only fill gaps: a hello reuses the current number, so it would widen
+// the range with a number of the previous run.
+type SequenceReport struct {
+	Sender   string   `json:"sender"`
+	First    int      `json:"first"`
+	Last     int      `json:"last"`
+	Seen     int      `json:"seen"`    // Distinct sequence numbers
+	Missing  int      `json:"missing"` // Numbers between first and last never seen
+	Gaps     [][2]int `json:"gaps,omitempty"`
+	Restarts [][2]int `json:"restarts,omitempty"` // Numbers reserved before a crash and skipped after the restart, not missing
+}
+
+// FailureReport groups rejections and failed echoes with the same cause
+type FailureReport struct {
+	Server  string `json:"server"`
+	Outcome string `json:"outcome"` // rejected or failed
+	Hop     string `json:"hop"`
+	Code    string `json:"code,omitempty"`
+	Error   string `json:"error"`
+	Count   int    `json:"count"`
+}
+
+// Bucket counts the messages of one throughput interval
+type Bucket struct {
+	Start    time.Time `json:"start"`
+	Received int       `json:"received"`
+	Sent     int       `json:"sent"`
+	Failed   int       `json:"failed"` // Rejections and failed echoes
+	Bytes    int       `json:"bytes"`  // Encoded size of the messages received
+	Rate     float64   `json:"rate"`   // Messages received per second
+}
+
+// maxBuckets is the most throughput buckets a report holds; a longer period gets
+// wider buckets
+const maxBuckets = 10000
+
+// chainState accumulates the entries of one chain
+type chainState struct {
+	report  ChainReport
+	ids     map[string]bool
+	hops    map[int]bool
+	servers map[string]bool
+}
+
+// Analyze builds the report of the merged, time-ordered entries with throughput
+// counted per bucket, widened to a multiple of it when the period would need more
+// than maxBuckets
+func Analyze(entries []*model.JournalEntry, bucket time.Duration) *Report {
+	report := &Report{Entries: len(entries), Bucket: bucket.String()}
+	if len(entries) == 0 {
+		return report
+	}
+	report.From, report.To = entries[0].Time, entries[len(entries)-1].Time
+	// The period spans at most two more buckets than it holds whole ones
+	if n := report.To.Sub(report.From) / bucket; n > maxBuckets-2 {
+		bucket *= n/(maxBuckets-2) + 1
+		report.Bucket = bucket.String()
+	}
+
+	ids := make(map[string]bool)
+	servers := make(map[string]bool)
+	chains := make(map[string]*chainState)
+	latencies := make(map[[2]string][]float64)
+	sequences := make(map[string]map[int]bool)
+	hellos := make(map[string]map[int]bool) // Numbers of hello replies, which take one
+	failures := make(map[FailureReport]int)
+	buckets := make(map[time.Time]*Bucket)
+
+	for _, entry := range entries {
+		message := entry.Message
+		ids[message.ID] = true
+		servers[entry.Server] = true
+		// A hello reuses the sender's current number, or takes the next one when it
+		// is a reply: it fills a gap but does not extend the range
+		numbers := sequences
+		if message.Type == model.HelloMessage {
+			numbers = hellos
+		}
+		if numbers[message.From] == nil {
+			numbers[message.From] = make(map[int]bool)
+		}
+		numbers[message.From][message.Sequence] = true
+
+		key := message.ChainKey()
+		chain := chains[key]
+		if chain == nil {
+			chain = &chainState{
+				report:  ChainReport{Chain: key, FirstHop: message.Hop, LastHop: message.Hop, Start: entry.Time},
+				ids:     make(map[string]bool),
+				hops:    make(map[int]bool),
+				servers: make(map[string]bool),
+			}
+			chains[key] = chain
+		}
+		chain.ids[message.ID] = true
+		chain.hops[message.Hop] = true
+		chain.servers[entry.Server] = true
+		chain.report.FirstHop = min(chain.report.FirstHop, message.Hop)
+		chain.report.LastHop = max(chain.report.LastHop, message.Hop)
+		chain.report.End = entry.Time
+		if message.Type == model.StopMessage {
+			chain.report.Stopped = true
+		}
+
+		start := entry.Time.Truncate(bucket)
+		b := buckets[start]
+		if b == nil {
+			b = &Bucket{Start: start}
+			buckets[start] = b
+		}
+
+		switch entry.Outcome {
+		case model.OutcomeOK:
+			if entry.Direction == model.DirectionIn {
+				report.Totals.Received++
+				b.Received++
+				b.Bytes += entry.Bytes
+			} else {
+				report.Totals.Sent++
+				b.Sent++
+			}
+		case model.OutcomeDuplicate:
+			report.Totals.Duplicates++
+			chain.report.Duplicates++
+		case model.OutcomeRejected, model.OutcomeFailed:
+			if entry.Outcome == model.OutcomeRejected {
+				report.Totals.Rejected++
+				chain.report.Rejected++
+			} else {
+				report.Totals.Failed++
+				chain.report.Failed++
+			}
+			b.Failed++
+			failures[FailureReport{Server: entry.Server, Outcome: entry.Outcome, Hop: entry.Hop, Code: entry.Code, Error: entry.Error}]++
+		}
+
+		if entry.Outcome == model.OutcomeOK {
+			switch entry.Kind {
+			case model.EventReceived:
+				latencies[[2]string{entry.Hop, LatencyTransit}] = append(latencies[[2]string{entry.Hop, LatencyTransit}], entry.LatencyMs)
+			case model.EventResponded:
+				latencies[[2]string{entry.Hop, LatencyProcessing}] = append(latencies[[2]string{entry.Hop, LatencyProcessing}], entry.LatencyMs)
+			case model.EventEchoSent:
+				latencies[[2]string{entry.Hop, LatencyRoundTrip}] = append(latencies[[2]string{entry.Hop, LatencyRoundTrip}], entry.LatencyMs)
+			}
+		}
+	}
+
+	report.Totals.Messages = len(ids)
+	report.Servers = sortedKeys(servers)
+
+	for _, chain := range chains {
+		c := chain.report
+		c.Messages = len(chain.ids)
+		c.Servers = sortedKeys(chain.servers)
+		c.DurationMs = float64(c.End.Sub(c.Start).Microseconds()) / 1000
+		for hop := c.FirstHop; hop <= c.LastHop; hop++ {
+			if !chain.hops[hop] {
+				c.MissingHops = append(c.MissingHops, hop)
+			}
+		}
+		report.Totals.MissingHops += len(c.MissingHops)
+		report.Chains = append(report.Chains, c)
+	}
+	sort.Slice(report.Chains, func(i, j int) bool {
+		return report.Chains[i].Start.Before(report.Chains[j].Start)
+	})
+
+	for key, values := range latencies {
+		slices.Sort(values)
+		report.Hops = append(report.Hops, HopReport{
+			Hop:   key[0],
+			Kind:  key[1],
+			Count: len(values),
+			P50:   percentile(values, 50),
+			P90:   percentile(values, 90),
+			P99:   percentile(values, 99),
+			Max:   values[len(values)-1],
+		})
+	}
+	sort.Slice(report.Hops, func(i, j int) bool {
+		if report.Hops[i].Hop != report.Hops[j].Hop {
+			return report.Hops[i].Hop < report.Hops[j].Hop
+		}
+		return report.Hops[i].Kind < report.Hops[j].Kind
+	})
+
+	for _, sender := range sortedKeys(sequences) {
+		seen := sequences[sender]
+		numbers := sortedKeys(seen)
+		s := SequenceReport{Sender: sender, First: numbers[0], Last: numbers[len(numbers)-1], Seen: len(numbers)}
+		for number := range hellos[sender] {
+			if number > s.First && number < s.Last && !seen[number] {
+				numbers = append(numbers, number)
+			}
+		}
+		slices.Sort(numbers)
+		for i := 1; i < len(numbers); i++ {
+			if numbers[i] <= numbers[i-1]+1 {
+				continue
+			}
+			gap := [2]int{numbers[i-1] + 1, numbers[i] - 1}
+			if restartGap(gap) {
+				s.Restarts = append(s.Restarts, gap)
+				continue
+			}
+			s.Gaps = append(s.Gaps, gap)
+			s.Missing += gap[1] - gap[0] + 1
+		}
+		report.Totals.SequenceGaps += s.Missing
+		report.Sequences = append(report.Sequences, s)
+	}
+
+	for failure, count := range failures {
+		failure.Count = count
+		report.Failures = append(report.Failures, failure)
+	}
+	sort.Slice(report.Failures, func(i, j int) bool {
+		if report.Failures[i].Count != report.Failures[j].Count {
+			return report.Failures[i].Count > report.Failures[j].Count
+		}
+		return report.Failures[i].Hop < report.Failures[j].Hop
+	})
+
+	// Every interval of the period gets a bucket, so stalls show up as empty rows
+	for start := report.From.Truncate(bucket); !start.After(report.To); start = start.Add(bucket) {
+		b := buckets[start]
+		if b == nil {
+			b = &Bucket{Start: start}
+		}
+		b.Rate = float64(b.Received) / bucket.Seconds()
+		report.Throughput = append(report.Throughput, *b)
+	}
+	return report
+}
+
+// restartGap reports whether the missing numbers are the rest of a reserved block:
+// a server restarting after a crash continues after the block, so the gap ends at
+// a multiple of model.SequenceBlock and is shorter than one
+func restartGap(gap [2]int) bool {
+	return gap[1]%model.SequenceBlock == 0 && gap[1]-gap[0]+1 < model.SequenceBlock
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	return sorted[max(rank, 1)-1]
+}
+
+// sortedKeys returns the keys of a map in ascending order
+func sortedKeys[K int | string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,194 @@
+package journal
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+var start = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+
+// received returns the journal entry of a message from sender received at offset
+func received(offset time.Duration, sender string, kind model.MessageType, sequence int) *model.JournalEntry {
+	message := &model.Message{ID: newID(), Type: kind, Sequence: sequence, From: sender, Chain: "c1", Timestamp: start.Add(offset)}
+	event := model.NewEvent(model.EventReceived, "server2", "webtransport", sender+" -> server2", message, time.Millisecond)
+	event.Time = start.Add(offset)
+	return model.NewJournalEntry(event, "", nil, "")
+}
+
+var lastID int
+
+// newID returns a distinct message ID
+func newID() string {
+	lastID++
+	return strconv.Itoa(lastID)
+}
+
+func TestAnalyzeSequences(t *testing.T) {
+	type seq struct {
+		kind     model.MessageType
+		sequence int
+	}
+	pings := func(numbers ...int) []seq {
+		var s []seq
+		for _, n := range numbers {
+			s = append(s, seq{model.PingMessage, n})
+		}
+		return s
+	}
+	tests := []struct {
+		name         string
+		messages     []seq
+		wantFirst    int
+		wantLast     int
+		wantGaps     [][2]int
+		wantRestarts [][2]int
+	}{
+		{name: "contiguous", messages: pings(1, 2, 3, 4), wantFirst: 1, wantLast: 4},
+		{name: "lost messages", messages: pings(1, 2, 5, 6, 8), wantFirst: 1, wantLast: 8, wantGaps: [][2]int{{3, 4}, {7, 7}}},
+		{name: "out of order", messages: pings(3, 1, 2), wantFirst: 1, wantLast: 3},
+		{
+			name:         "restart after a crash",
+			messages:     pings(98, 99, 157, 158, 201, 202),
+			wantFirst:    98,
+			wantLast:     202,
+			wantGaps:     [][2]int{{100, 156}},
+			wantRestarts: [][2]int{{159, 200}},
+		},
+		{name: "crash before the last number of a block", messages: pings(99, 101), wantFirst: 99, wantLast: 101, wantRestarts: [][2]int{{100, 100}}},
+		{name: "gap ending inside a block", messages: pings(99, 102), wantFirst: 99, wantLast: 102, wantGaps: [][2]int{{100, 101}}},
+		{name: "gap of a whole block", messages: pings(100, 201), wantFirst: 100, wantLast: 201, wantGaps: [][2]int{{101, 200}}},
+		{
+			name:      "hello reusing the number of the previous run",
+			messages:  append([]seq{{model.HelloMessage, 0}}, pings(1, 2)...),
+			wantFirst: 1,
+			wantLast:  2,
+		},
+		{
+			name:      "hello reply taking a number",
+			messages:  []seq{{model.PingMessage, 1}, {model.HelloMessage, 2}, {model.PingMessage, 3}, {model.HelloMessage, 9}},
+			wantFirst: 1,
+			wantLast:  3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []*model.JournalEntry
+			for i, m := range tt.messages {
+				entries = append(entries, received(time.Duration(i)*time.Second, "server1", m.kind, m.sequence))
+			}
+			report := Analyze(entries, time.Second)
+			if len(report.Sequences) != 1 {
+				t.Fatalf("got %d sequence reports, want 1", len(report.Sequences))
+			}
+			s := report.Sequences[0]
+			if s.First != tt.wantFirst || s.Last != tt.wantLast {
+				t.Errorf("range = %d-%d, want %d-%d", s.First, s.Last, tt.wantFirst, tt.wantLast)
+			}
+			if !reflect.DeepEqual(s.Gaps, tt.wantGaps) {
+				t.Errorf("Gaps = %v, want %v", s.Gaps, tt.wantGaps)
+			}
+			if !reflect.DeepEqual(s.Restarts, tt.wantRestarts) {
+				t.Errorf("Restarts = %v, want %v", s.Restarts, tt.wantRestarts)
+			}
+			missing := 0
+			for _, gap := range tt.wantGaps {
+				missing += gap[1] - gap[0] + 1
+			}
+			if s.Missing != missing || report.Totals.SequenceGaps != missing {
+				t.Errorf("Missing = %d, SequenceGaps = %d, want %d", s.Missing, report.Totals.SequenceGaps, missing)
+			}
+		})
+	}
+}
+
+func TestAnalyzeBuckets(t *testing.T) {
+	tests := []struct {
+		name       string
+		period     time.Duration
+		bucket     time.Duration
+		wantBucket time.Duration
+	}{
+		{name: "short period", period: 25 * time.Second, bucket: 10 * time.Second, wantBucket: 10 * time.Second},
+		{name: "just below the cap", period: (maxBuckets - 2) * time.Second, bucket: time.Second, wantBucket: time.Second},
+		{name: "widened at the cap", period: (maxBuckets - 1) * time.Second, bucket: time.Second, wantBucket: 2 * time.Second},
+		{name: "week in millisecond buckets", period: 7 * 24 * time.Hour, bucket: time.Millisecond, wantBucket: 60493 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := []*model.JournalEntry{
+				received(0, "server1", model.PingMessage, 1),
+				received(tt.period, "server1", model.PingMessage, 2),
+			}
+			report := Analyze(entries, tt.bucket)
+			if report.Bucket != tt.wantBucket.String() {
+				t.Fatalf("Bucket = %s, want %s", report.Bucket, tt.wantBucket)
+			}
+			if len(report.Throughput) > maxBuckets {
+				t.Fatalf("got %d buckets, above the cap of %d", len(report.Throughput), maxBuckets)
+			}
+			total := 0
+			for _, b := range report.Throughput {
+				total += b.Received
+			}
+			if total != 2 {
+				t.Errorf("buckets hold %d received messages, want 2", total)
+			}
+		})
+	}
+}
+
+func TestAnalyzeChains(t *testing.T) {
+	entry := func(offset time.Duration, kind model.EventKind, hop int, messageType model.MessageType) *model.JournalEntry {
+		message := &model.Message{ID: newID(), Type: messageType, Sequence: hop + 1, From: "server1", Chain: "c1", Hop: hop, Timestamp: start.Add(offset)}
+		event := model.NewEvent(kind, "server2", "webtransport", "server1 -> server2", message, time.Millisecond)
+		event.Time = start.Add(offset)
+		if kind == model.EventRejected {
+			event.Error = "chain rate limit exceeded"
+		}
+		return model.NewJournalEntry(event, "", nil, "")
+	}
+	entries := []*model.JournalEntry{
+		entry(0, model.EventReceived, 0, model.PingMessage),
+		entry(time.Second, model.EventDuplicate, 0, model.PingMessage),
+		entry(2*time.Second, model.EventReceived, 1, model.PongMessage),
+		entry(3*time.Second, model.EventRejected, 4, model.PingMessage),
+		entry(4*time.Second, model.EventReceived, 5, model.StopMessage),
+	}
+	report := Analyze(entries, time.Second)
+	if len(report.Chains) != 1 {
+		t.Fatalf("got %d chains, want 1", len(report.Chains))
+	}
+	c := report.Chains[0]
+	if c.FirstHop != 0 || c.LastHop != 5 || !reflect.DeepEqual(c.MissingHops, []int{2, 3}) {
+		t.Errorf("hops %d-%d missing %v, want 0-5 missing [2 3]", c.FirstHop, c.LastHop, c.MissingHops)
+	}
+	if c.Duplicates != 1 || c.Rejected != 1 || !c.Stopped {
+		t.Errorf("duplicates %d rejected %d stopped %t, want 1, 1 and true", c.Duplicates, c.Rejected, c.Stopped)
+	}
+	if c.DurationMs != 4000 {
+		t.Errorf("DurationMs = %v, want 4000", c.DurationMs)
+	}
+	if len(report.Failures) != 1 || report.Failures[0].Error != "chain rate limit exceeded" {
+		t.Errorf("Failures = %+v, want the rate limit rejection", report.Failures)
+	}
+	if report.Totals.Received != 3 || report.Totals.MissingHops != 2 {
+		t.Errorf("Totals = %+v, want 3 received and 2 missing hops", report.Totals)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	values := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		p    float64
+		want float64
+	}{{0, 1}, {50, 5}, {90, 9}, {99, 10}, {100, 10}}
+	for _, tt := range tests {
+		if got := percentile(values, tt.p); got != tt.want {
+			t.Errorf("percentile(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Files returns the journal files to read for the given paths. With rotated, the
+// rotated files of each path (<path>.N … <path>.1) are included before it, oldest first.
+func Files(paths []string, rotated bool) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if rotated {
+			var backups []string
+			for i := 1; ; i++ {
+				backup := fmt.Sprintf("%s.%d", path, i)
+				if _, err := os.Stat(backup); err != nil {
+					break
+				}
+				backups = append([]string{backup}, backups...)
+			}
+			files = append(files, backups...)
+		}
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		files = append(files, path)
+	}
+	return files, nil
+}
+
+// Read loads the entries of the journal files merged in time order. Lines that
+// are not journal entries (e.g. a line cut short by a crash) are counted and skipped.
+func Read(files []string) (entries []*model.JournalEntry, skipped int, err error) {
+	for _, file := range files {
+		n, err := readFile(file, &entries)
+		skipped += n
+		if err != nil {
+			return nil, skipped, fmt.Errorf("read %s: %w", file, err)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, skipped, nil
+}
+
+// readFile appends the entries of one journal file and returns the number of skipped lines
+func readFile(path string, entries *[]*model.JournalEntry) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	skipped := 0
+	reader := bufio.NewReader(file)
+	for {
+		// ReadBytes has no line length limit, unlike bufio.Scanner
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var entry model.JournalEntry
+			if json.Unmarshal(line, &entry) != nil || entry.Message == nil {
+				skipped++
+			} else {
+				*entries = append(*entries, &entry)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+	}
+}
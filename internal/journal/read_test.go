@@ -0,0 +1,63 @@
+package journal
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+func TestFilesAndRead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server1.jsonl")
+	line := func(offset time.Duration, sequence int) string {
+		data, err := json.Marshal(received(offset, "server1", model.PingMessage, sequence))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data) + "\n"
+	}
+	write := func(name, content string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("server1.jsonl.2", line(0, 1))
+	write("server1.jsonl.1", line(2*time.Second, 3)+"not json\n")
+	// The last line was cut short by a crash
+	write("server1.jsonl", line(time.Second, 2)+line(3*time.Second, 4)[:40])
+
+	files, err := Files([]string{path}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{path + ".2", path + ".1", path}
+	if !reflect.DeepEqual(files, want) {
+		t.Fatalf("Files() = %v, want %v", files, want)
+	}
+	if files, _ := Files([]string{path}, false); !reflect.DeepEqual(files, []string{path}) {
+		t.Fatalf("Files() without rotated = %v, want only %s", files, path)
+	}
+	if _, err := Files([]string{filepath.Join(dir, "missing.jsonl")}, true); err == nil {
+		t.Fatal("Files() accepted a missing journal")
+	}
+
+	entries, skipped, err := Read(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skipped != 2 {
+		t.Errorf("skipped %d lines, want 2", skipped)
+	}
+	var sequences []int
+	for _, entry := range entries {
+		sequences = append(sequences, entry.Message.Sequence)
+	}
+	if !reflect.DeepEqual(sequences, []int{1, 2, 3}) {
+		t.Errorf("entries in order %v, want [1 2 3] (merged by time)", sequences)
+	}
+}
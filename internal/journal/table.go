@@ -0,0 +1,102 @@
+package journal
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// WriteTable writes the report as plain-text tables. At most maxChains chains are
+// listed (0 for all), those with the most problems first.
+func (r *Report) WriteTable(w io.Writer, maxChains int) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "Journals:\t%s\n", strings.Join(r.Files, ", "))
+	fmt.Fprintf(tw, "Entries:\t%d (%d skipped lines)\n", r.Entries, r.Skipped)
+	if r.Entries == 0 {
+		return tw.Flush()
+	}
+	fmt.Fprintf(tw, "Servers:\t%s\n", strings.Join(r.Servers, ", "))
+	fmt.Fprintf(tw, "Period:\t%s to %s (%s)\n", r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), r.To.Sub(r.From).Round(time.Millisecond))
+	t := r.Totals
+	fmt.Fprintf(tw, "Totals:\t%d messages, %d received, %d sent, %d duplicates, %d rejected, %d failed, %d missing hops, %d sequence gaps\n",
+		t.Messages, t.Received, t.Sent, t.Duplicates, t.Rejected, t.Failed, t.MissingHops, t.SequenceGaps)
+
+	chains := append([]ChainReport(nil), r.Chains...)
+	sort.SliceStable(chains, func(i, j int) bool { return chains[i].Problems() > chains[j].Problems() })
+	if maxChains > 0 && len(chains) > maxChains {
+		fmt.Fprintf(tw, "\nChains (%d of %d)\n", maxChains, len(chains))
+		chains = chains[:maxChains]
+	} else {
+		fmt.Fprintf(tw, "\nChains (%d)\n", len(chains))
+	}
+	fmt.Fprintln(tw, "CHAIN\tMESSAGES\tHOPS\tSERVERS\tDURATION\tMISSING HOPS\tDUPLICATES\tREJECTED\tFAILED\tSTOPPED")
+	for _, c := range chains {
+		fmt.Fprintf(tw, "%s\t%d\t%d-%d\t%s\t%s\t%s\t%d\t%d\t%d\t%t\n", c.Chain, c.Messages, c.FirstHop, c.LastHop, strings.Join(c.Servers, ","),
+			time.Duration(c.DurationMs*float64(time.Millisecond)).Round(time.Millisecond), joinInts(c.MissingHops), c.Duplicates, c.Rejected, c.Failed, c.Stopped)
+	}
+
+	fmt.Fprintln(tw, "\nHop latency (ms)")
+	fmt.Fprintln(tw, "HOP\tKIND\tCOUNT\tP50\tP90\tP99\tMAX")
+	for _, h := range r.Hops {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%.2f\t%.2f\t%.2f\t%.2f\n", h.Hop, h.Kind, h.Count, h.P50, h.P90, h.P99, h.Max)
+	}
+
+	fmt.Fprintln(tw, "\nSequences")
+	fmt.Fprintln(tw, "SENDER\tFIRST\tLAST\tSEEN\tMISSING\tGAPS\tRESTARTS")
+	for _, s := range r.Sequences {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t%s\n", s.Sender, s.First, s.Last, s.Seen, s.Missing, joinRanges(s.Gaps), joinRanges(s.Restarts))
+	}
+
+	if len(r.Failures) > 0 {
+		fmt.Fprintln(tw, "\nFailures")
+		fmt.Fprintln(tw, "SERVER\tOUTCOME\tHOP\tCODE\tCOUNT\tERROR")
+		for _, f := range r.Failures {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\n", f.Server, f.Outcome, f.Hop, orDash(f.Code), f.Count, f.Error)
+		}
+	}
+
+	fmt.Fprintf(tw, "\nThroughput (%s buckets)\n", r.Bucket)
+	fmt.Fprintln(tw, "START\tRECEIVED\tSENT\tFAILED\tBYTES\tMSG/S")
+	for _, b := range r.Throughput {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%.2f\n", b.Start.Format(time.TimeOnly), b.Received, b.Sent, b.Failed, b.Bytes, b.Rate)
+	}
+	return tw.Flush()
+}
+
+// joinRanges formats at most 10 number ranges, "-" when empty
+func joinRanges(ranges [][2]int) string {
+	items := make([]string, 0, len(ranges))
+	for i, r := range ranges {
+		if i == 10 {
+			items = append(items, fmt.Sprintf("… %d more", len(ranges)-i))
+			break
+		}
+		if r[0] == r[1] {
+			items = append(items, strconv.Itoa(r[0]))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", r[0], r[1]))
+		}
+	}
+	return orDash(strings.Join(items, ","))
+}
+
+// joinInts formats a list of hops, "-" when empty
+func joinInts(values []int) string {
+	items := make([]string, len(values))
+	for i, value := range values {
+		items[i] = strconv.Itoa(value)
+	}
+	return orDash(strings.Join(items, ","))
+}
+
+// orDash returns "-" for an empty cell
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,127 @@
+// Package limit provides keyed token-bucket rate limiters and concurrency caps.
+//
+// Both types are nil-safe: a nil *Limiter allows everything and a nil
+// *Semaphore never blocks, so a zero limit in the configuration disables them.
+package limit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// idleTimeout is how long an unused bucket is kept before it is dropped
+const idleTimeout = 5 * time.Minute
+
+// Limiter keeps one token bucket per key (remote address, chain ID, ...)
+type Limiter struct {
+	rate    float64 // Tokens added per second
+	burst   float64 // Bucket capacity
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time // Last removal of idle buckets
+	now     func() time.Time
+}
+
+// bucket is the state of a single key
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a limiter allowing rate events per second per key with
+// bursts of up to burst events. It returns nil (unlimited) when rate is not positive.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// Allow takes a token from the key's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep drops buckets that have not been used for idleTimeout (they would be full again)
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < idleTimeout {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= idleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+	l.swept = now
+}
+
+// Semaphore caps the number of concurrent operations
+type Semaphore struct {
+	slots chan struct{}
+}
+
+// NewSemaphore creates a semaphore with n slots. It returns nil (unlimited) when n is not positive.
+func NewSemaphore(n int) *Semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return &Semaphore{slots: make(chan struct{}, n)}
+}
+
+// TryAcquire takes a slot without waiting and reports whether one was free
+func (s *Semaphore) TryAcquire() bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Release frees a slot taken by TryAcquire
+func (s *Semaphore) Release() {
+	if s == nil {
+		return
+	}
+	<-s.slots
+}
+
+// Cap returns the number of slots (0 for unlimited)
+func (s *Semaphore) Cap() int {
+	if s == nil {
+		return 0
+	}
+	return cap(s.slots)
+}
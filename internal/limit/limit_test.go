@@ -0,0 +1,132 @@
+package limit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	type step struct {
+		advance   time.Duration // Time passed before the call
+		key       string        // "a" unless set
+		wantOK    bool
+		wantRetry time.Duration
+	}
+	allowed := step{wantOK: true}
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		steps []step
+	}{
+		{
+			name: "burst then refused", rate: 1, burst: 3,
+			steps: []step{allowed, allowed, allowed, {wantRetry: time.Second}},
+		},
+		{
+			name: "refill over time", rate: 2, burst: 2,
+			steps: []step{allowed, allowed, {wantRetry: 500 * time.Millisecond}, {advance: 250 * time.Millisecond, wantRetry: 250 * time.Millisecond}, {advance: 250 * time.Millisecond, wantOK: true}},
+		},
+		{
+			name: "refill capped at the burst", rate: 1, burst: 2,
+			steps: []step{allowed, allowed, {advance: time.Hour, wantOK: true}, allowed, {wantRetry: time.Second}},
+		},
+		{
+			name: "burst defaults to the rate rounded up", rate: 2.5, burst: 0,
+			steps: []step{allowed, allowed, allowed, {wantRetry: 400 * time.Millisecond}},
+		},
+		{
+			name: "keys have separate buckets", rate: 1, burst: 1,
+			steps: []step{allowed, {wantRetry: time.Second}, {key: "b", wantOK: true}, {key: "b", wantRetry: time.Second}},
+		},
+		{
+			name: "fractional rate", rate: 0.5, burst: 1,
+			steps: []step{allowed, {advance: time.Second, wantRetry: time.Second}, {advance: time.Second, wantOK: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.rate, tt.burst)
+			now := time.Unix(1760000000, 0)
+			l.now = func() time.Time { return now }
+			for i, s := range tt.steps {
+				now = now.Add(s.advance)
+				key := s.key
+				if key == "" {
+					key = "a"
+				}
+				ok, retry := l.Allow(key)
+				if ok != s.wantOK || (retry-s.wantRetry).Abs() > time.Millisecond {
+					t.Fatalf("step %d: Allow(%q) = %t, %s, want %t, %s", i, key, ok, retry, s.wantOK, s.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterDisabledAndSweep(t *testing.T) {
+	for _, rate := range []float64{0, -1} {
+		if l := NewLimiter(rate, 5); l != nil {
+			t.Errorf("NewLimiter(%v) = %v, want nil", rate, l)
+		}
+	}
+	var l *Limiter
+	for range 100 {
+		if ok, _ := l.Allow("a"); !ok {
+			t.Fatal("nil limiter refused a call")
+		}
+	}
+
+	l = NewLimiter(1, 1)
+	now := time.Unix(1760000000, 0)
+	l.now = func() time.Time { return now }
+	l.Allow("a")
+	l.Allow("b")
+	now = now.Add(idleTimeout)
+	l.Allow("c")
+	if len(l.buckets) != 1 {
+		t.Errorf("%d buckets after the idle timeout, want 1 (the new key)", len(l.buckets))
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	tests := []struct {
+		name    string
+		n       int
+		wantCap int
+	}{
+		{name: "one slot", n: 1, wantCap: 1},
+		{name: "several slots", n: 3, wantCap: 3},
+		{name: "unlimited", n: 0},
+		{name: "negative is unlimited", n: -2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSemaphore(tt.n)
+			if s.Cap() != tt.wantCap {
+				t.Fatalf("Cap() = %d, want %d", s.Cap(), tt.wantCap)
+			}
+			if tt.wantCap == 0 {
+				for range 100 {
+					if !s.TryAcquire() {
+						t.Fatal("unlimited semaphore refused a slot")
+					}
+				}
+				s.Release()
+				return
+			}
+			for i := range tt.wantCap {
+				if !s.TryAcquire() {
+					t.Fatalf("TryAcquire() %d refused with free slots", i)
+				}
+			}
+			if s.TryAcquire() {
+				t.Fatal("TryAcquire() succeeded with every slot taken")
+			}
+			s.Release()
+			if !s.TryAcquire() {
+				t.Fatal("TryAcquire() refused after Release")
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package logging configures the standard logger used throughout the server.
+//
+// The code base logs with log.Printf and marks problems with "❌" (errors) and
+// "⚠" (warnings). The level filter classifies each line by these markers, so
+// the minimum level can change at runtime without touching call sites.
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is a minimum log level
+type Level int32
+
+const (
+	// LevelInfo logs everything
+	LevelInfo Level = iota
+	// LevelWarn logs warnings and errors
+	LevelWarn
+	// LevelError logs errors only
+	LevelError
+)
+
+// ParseLevel converts a config value ("info", "warn", "error") to a Level
+func ParseLevel(s string) (Level, error) {
+	switch s {
+	case "info", "":
+		return LevelInfo, nil
+	case "warn":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+// String returns the config name of the level
+func (l Level) String() string {
+	switch l {
+	case LevelWarn:
+		return "warn"
+	case LevelError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+var (
+	errorMarker = []byte("❌")
+	warnMarker  = []byte("⚠")
+)
+
+// filterWriter drops lines below the current level before writing them out
+type filterWriter struct {
+	level atomic.Int32
+	mu    sync.Mutex
+	out   io.Writer
+	file  *os.File // Non-nil when logging to a file (closed on replacement)
+}
+
+var std = &filterWriter{out: os.Stderr}
+
+func init() {
+	log.SetOutput(std)
+}
+
+// Write filters a single log line (the log package writes one line per call)
+func (w *filterWriter) Write(p []byte) (int, error) {
+	if lineLevel(p) < Level(w.level.Load()) {
+		return len(p), nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.out.Write(p)
+}
+
+// lineLevel classifies a log line by its marker
+func lineLevel(p []byte) Level {
+	switch {
+	case bytes.Contains(p, errorMarker):
+		return LevelError
+	case bytes.Contains(p, warnMarker):
+		return LevelWarn
+	default:
+		return LevelInfo
+	}
+}
+
+// Setup applies the level, output file and timestamp format to the standard logger.
+// An empty file logs to stderr. It may be called again to reconfigure at runtime.
+func Setup(level, file string, microseconds bool) error {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stderr
+	var f *os.File
+	if file != "" {
+		f, err = os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = f
+	}
+
+	std.mu.Lock()
+	previous := std.file
+	std.out = out
+	std.file = f
+	std.mu.Unlock()
+	if previous != nil {
+		previous.Close()
+	}
+
+	flags := log.LstdFlags
+	if microseconds {
+		flags |= log.Lmicroseconds
+	}
+	log.SetFlags(flags)
+	SetLevel(lvl)
+	return nil
+}
+
+// SetLevel changes the minimum level at runtime
+func SetLevel(level Level) {
+	std.level.Store(int32(level))
+}
+
+// CurrentLevel returns the minimum level
+func CurrentLevel() Level {
+	return Level(std.level.Load())
+}
+
+// Close closes the log file, if any, and falls back to stderr
+func Close() error {
+	std.mu.Lock()
+	defer std.mu.Unlock()
+	if std.file == nil {
+		return nil
+	}
+	err := std.file.Close()
+	std.file = nil
+	std.out = os.Stderr
+	return err
+}
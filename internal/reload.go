@@ -0,0 +1,194 @@
+package internal
+
+import (
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/logging"
+)
+
+// ConfigLoader returns a freshly loaded and validated configuration
+type ConfigLoader func() (*config.ServerConfig, error)
+
+// EnableReload makes SIGHUP (and, if reload.watch_interval is set, changes to
+// the config file or the TLS key pair) re-run the loader and apply the result.
+// Must be called before Start.
+func (s *Server) EnableReload(configFile string, loader ConfigLoader) {
+	s.configFile = configFile
+	s.loader = loader
+}
+
+// reload loads the configuration and applies the settings that can change at
+// runtime: TLS key pair, targets, delay, allowed origins and logging. Sessions are not dropped;
+// an invalid configuration or key pair is rejected and the current one is kept.
+func (s *Server) reload(reason string) {
+	log.Printf("[Server] Reloading configuration (%s)...", reason)
+	if s.loader == nil {
+		log.Printf("[Server] ⚠ Reload is not enabled, ignoring")
+		return
+	}
+
+	cfg, err := s.loader()
+	if err != nil {
+		log.Printf("[Server] ❌ Reload failed, keeping current configuration: %v", err)
+		return
+	}
+
+	leaf, err := s.certs.Load(cfg.TLS.CertFile, cfg.TLS.KeyFile)
+	if err != nil {
+		log.Printf("[Server] ❌ Reload failed, keeping current configuration: %v", err)
+		return
+	}
+	s.router.healthRepository.SetCertificate(leaf)
+	log.Printf("[Server] ✅ TLS certificate reloaded (subject: %s, expires: %s)", leaf.Subject, leaf.NotAfter.Format(time.RFC3339))
+	logCertificateHash(leaf)
+
+	if !slices.Equal(cfg.Targets, s.router.Targets()) {
+		log.Printf("[Server] Targets changed: %v -> %v", s.router.Targets(), cfg.Targets)
+		s.router.SetTargets(cfg.Targets)
+	}
+	if cfg.Delay != s.cfg.Delay {
+		log.Printf("[Server] Delay changed: %s -> %s", s.cfg.Delay, cfg.Delay)
+	}
+	s.router.commonRepository.SetDelay(cfg.Delay.Std())
+	if !slices.Equal(cfg.CORS.AllowedOrigins, s.cfg.CORS.AllowedOrigins) {
+		log.Printf("[Server] Allowed origins changed: %v -> %v", s.cfg.CORS.AllowedOrigins, cfg.CORS.AllowedOrigins)
+		s.router.SetOrigins(cfg.CORS.AllowedOrigins)
+	}
+
+	for _, field := range restartRequired(s.cfg, cfg) {
+		log.Printf("[Server] ⚠ %s changed; restart the server to apply it", field)
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	log.Printf("[Server] ✅ Configuration reloaded")
+
+	// Applied last so the summary above is still logged at the previous level
+	if err := logging.Setup(cfg.Logging.Level, cfg.Logging.File, cfg.Logging.Microseconds); err != nil {
+		log.Printf("[Server] ❌ Failed to apply logging configuration: %v", err)
+	}
+}
+
+// restartRequired lists the changed settings that only take effect after a restart
+func restartRequired(current, next *config.ServerConfig) []string {
+	var fields []string
+	if current.Name != next.Name {
+		fields = append(fields, "name")
+	}
+	if current.Listen != next.Listen {
+		fields = append(fields, "listen")
+	}
+	if current.TLS.CAFile != next.TLS.CAFile || current.TLS.Insecure != next.TLS.Insecure || !slices.Equal(current.TLS.Pins, next.TLS.Pins) {
+		fields = append(fields, "tls peer verification (ca_file, pins, insecure)")
+	}
+	if current.TLS.ClientAuth != next.TLS.ClientAuth || current.TLS.ClientCA() != next.TLS.ClientCA() || !slices.Equal(current.TLS.AllowedPeers, next.TLS.AllowedPeers) {
+		fields = append(fields, "tls client authentication (client_auth, client_ca_file, allowed_peers)")
+	}
+	if current.Auth.Mode != next.Auth.Mode || current.Auth.Token != next.Auth.Token || current.Auth.MaxSkew != next.Auth.MaxSkew || current.Auth.QueryToken != next.Auth.QueryToken || !slices.Equal(current.Auth.Tokens, next.Auth.Tokens) {
+		fields = append(fields, "auth")
+	}
+	if current.Signing.KeyFile != next.Signing.KeyFile || current.Signing.Policy != next.Signing.Policy || !maps.Equal(current.Signing.Peers, next.Signing.Peers) {
+		fields = append(fields, "signing")
+	}
+	if current.Transport != next.Transport {
+		fields = append(fields, "transport")
+	}
+	if current.Limits != next.Limits {
+		fields = append(fields, "limits")
+	}
+	if current.Dedupe != next.Dedupe {
+		fields = append(fields, "dedupe")
+	}
+	if current.Encoding.Echo != next.Encoding.Echo || !slices.Equal(current.Encoding.Accept, next.Encoding.Accept) {
+		fields = append(fields, "encoding")
+	}
+	if current.Compression.Echo != next.Compression.Echo || current.Compression.Threshold != next.Compression.Threshold || !slices.Equal(current.Compression.Accept, next.Compression.Accept) {
+		fields = append(fields, "compression")
+	}
+	if current.Content != next.Content {
+		fields = append(fields, "content")
+	}
+	if current.Handlers.ForwardCustom != next.Handlers.ForwardCustom || !slices.Equal(current.Handlers.Enabled, next.Handlers.Enabled) {
+		fields = append(fields, "handlers")
+	}
+	if current.Handshake != next.Handshake {
+		fields = append(fields, "handshake")
+	}
+	if current.Attachments != next.Attachments {
+		fields = append(fields, "attachments")
+	}
+	if current.State != next.State {
+		fields = append(fields, "state")
+	}
+	if current.Journal != next.Journal {
+		fields = append(fields, "journal")
+	}
+	if current.CORS.MaxAge != next.CORS.MaxAge {
+		fields = append(fields, "cors.max_age")
+	}
+	if current.Reload != next.Reload {
+		fields = append(fields, "reload")
+	}
+	return fields
+}
+
+// watchedFiles returns the config file and the current TLS key pair paths
+func (s *Server) watchedFiles() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []string{s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile}
+	if s.configFile != "" {
+		files = append(files, s.configFile)
+	}
+	return files
+}
+
+// fileStamp identifies a file version by modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchFiles polls the watched files and requests a reload when one changes.
+// Polling (rather than inotify) also catches editors and tools that replace files by rename.
+func (s *Server) watchFiles(interval time.Duration, stop <-chan struct{}) {
+	log.Printf("[Server] Watching config and certificate files every %s", interval)
+	stamps := make(map[string]fileStamp)
+	scan := func() (changed string) {
+		for _, file := range s.watchedFiles() {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+			if previous, seen := stamps[file]; seen && previous != stamp && changed == "" {
+				changed = file
+			}
+			stamps[file] = stamp
+		}
+		return changed
+	}
+	scan()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if file := scan(); file != "" {
+				select {
+				case s.reloadCh <- file + " changed":
+				default: // A reload is already pending
+				}
+			}
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,25 +13,91 @@ import (
 	neturl "net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/quic-go/quic-go"
 	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/codec"
+	"github.com/ryo-arima/magic-cylinder/internal/compress"
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/content"
 	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/request"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
 // commonRepository implements the CommonRepository interface
 type commonRepository struct {
-	sequence int           // Current message sequence number
-	mu       sync.Mutex    // Mutex for thread-safe sequence operations
-	delay    time.Duration // Optional artificial delay before echoing
+	name       string               // Server name used as the sender of generated messages
+	sequence   int                  // Current message sequence number
+	saved      int                  // Sequence number in the state file; the numbers up to it are reserved
+	mu         sync.Mutex           // Mutex for thread-safe sequence operations
+	delay      atomic.Int64         // Optional artificial delay before echoing (time.Duration, reloadable)
+	maxFrame   int                  // Largest echo response frame read from a target stream
+	maxBody    int                  // Largest /plain echo response body read from a target
+	quicConfig *quic.Config         // QUIC options for echo dialers
+	debug      *transport.Debug     // Optional TLS key log / qlog output for echo dialers
+	clientTLS  *tls.Config          // Peer verification for echo dialers (cloned per dial)
+	auth       *auth.Authenticator  // Credentials attached to echoes (nil sends none)
+	signer     *signing.Signer      // Signs generated messages (nil leaves them unsigned)
+	echoCodec  codec.Codec          // Codec offered first to targets (JSON is the fallback)
+	compressor *compress.Compressor // Compression offered to targets (nil for none)
+	content    *content.Generator   // Derives the content of generated messages
+	peers      PeerRepository       // Capabilities negotiated with targets
+	state      StateRepository      // Persists the sequence number across restarts
+	handshake  bool                 // Say hello to targets before the first echo
 }
 
 // NewCommonRepository creates a new repository instance
-func NewCommonRepository(delay time.Duration) CommonRepository {
-	return &commonRepository{
-		sequence: 0,
-		delay:    delay,
+func NewCommonRepository(cfg *config.ServerConfig, debug *transport.Debug, clientTLS *tls.Config, authn *auth.Authenticator, signer *signing.Signer, peers PeerRepository, state StateRepository) CommonRepository {
+	echoCodec, ok := codec.ByName(cfg.Encoding.Echo)
+	if !ok {
+		echoCodec = codec.JSON
 	}
+	compressor, err := compress.New(cfg.Compression.Echo, cfg.Compression.Threshold)
+	if err != nil {
+		log.Printf("[Repository] ⚠ %v, echoing uncompressed", err)
+	}
+	generator, err := content.New(cfg.Content.Strategy, cfg.Content.MaxLength, cfg.Content.Template)
+	if err != nil {
+		log.Printf("[Repository] ⚠ %v, using the %s strategy", err, content.Keep)
+		generator, _ = content.New(content.Keep, 0, "")
+	}
+	sequence, err := state.Sequence()
+	if err != nil {
+		log.Printf("[Repository] ⚠ Failed to load the saved sequence number, starting from 0: %v", err)
+	} else if sequence > 0 {
+		log.Printf("[Repository] Resuming from saved sequence number %d", sequence)
+	}
+	r := &commonRepository{
+		name:       cfg.Name,
+		sequence:   sequence,
+		saved:      sequence,
+		maxFrame:   cfg.Limits.MaxFrameBytes,
+		maxBody:    cfg.Limits.MaxBodyBytes,
+		quicConfig: transport.NewQUICConfig(cfg.Transport.MaxIdleTimeout.Std(), cfg.Transport.KeepAlivePeriod.Std()),
+		debug:      debug,
+		clientTLS:  clientTLS,
+		auth:       authn,
+		signer:     signer,
+		echoCodec:  echoCodec,
+		compressor: compressor,
+		content:    generator,
+		peers:      peers,
+		handshake:  cfg.Handshake.Enabled,
+		state:      state,
+	}
+	r.delay.Store(int64(cfg.Delay.Std()))
+	return r
+}
+
+// SetDelay changes the delay applied before each echo
+func (r *commonRepository) SetDelay(delay time.Duration) {
+	r.delay.Store(int64(delay))
 }
 
 // ProcessPing processes a ping message and generates a pong response
@@ -41,13 +109,11 @@ func (r *commonRepository) ProcessPing(message *model.Message) (*model.Message,
 	log.Printf("[Repository] ProcessPing started")
 	log.Printf("[Repository]   Input: %s (seq: %d, from: %s)", message.Content, message.Sequence, message.From)
 
-	r.sequence++
-	response := model.NewPongMessage(
-		fmt.Sprintf("Pong response to: %s", message.Content),
-		r.sequence,
-		"repository",
-		message.From,
-	)
+	response, err := r.reply(model.PongMessage, message)
+	if err != nil {
+		log.Printf("[Repository] ❌ %v", err)
+		return nil, err
+	}
 
 	log.Printf("[Repository] ✅ Pong generated successfully")
 	log.Printf("[Repository]   Output: %s (seq: %d, to: %s)", response.Content, response.Sequence, response.To)
@@ -65,13 +131,11 @@ func (r *commonRepository) ProcessPong(message *model.Message) (*model.Message,
 	log.Printf("[Repository] ProcessPong started")
 	log.Printf("[Repository]   Input: %s (seq: %d, from: %s)", message.Content, message.Sequence, message.From)
 
-	r.sequence++
-	response := model.NewPingMessage(
-		fmt.Sprintf("Ping response to: %s", message.Content),
-		r.sequence,
-		"repository",
-		message.From,
-	)
+	response, err := r.reply(model.PingMessage, message)
+	if err != nil {
+		log.Printf("[Repository] ❌ %v", err)
+		return nil, err
+	}
 
 	log.Printf("[Repository] ✅ Ping generated successfully")
 	log.Printf("[Repository]   Output: %s (seq: %d, to: %s)", response.Content, response.Sequence, response.To)
@@ -80,6 +144,44 @@ func (r *commonRepository) ProcessPong(message *model.Message) (*model.Message,
 	return response, nil
 }
 
+// reply builds and signs the next message of the chain; the caller holds r.mu
+func (r *commonRepository) reply(kind model.MessageType, message *model.Message) (*model.Message, error) {
+	sequence := r.sequence + 1
+	text, err := r.content.Next(content.Data{
+		Type:     kind,
+		Server:   r.name,
+		Sequence: sequence,
+		Hop:      message.Hop + 1,
+		Chain:    message.Chain,
+		From:     message.From,
+		Previous: message.Content,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generate %s content (%s strategy): %w", kind, r.content.Strategy(), err)
+	}
+	r.sequence = sequence
+	r.saveSequence()
+	return r.build(kind, message, text), nil
+}
+
+// NewReply builds and signs a message of the given type replying to message
+func (r *commonRepository) NewReply(kind model.MessageType, message *model.Message, text string) *model.Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sequence++
+	r.saveSequence()
+	return r.build(kind, message, text)
+}
+
+// build creates the signed reply with the current sequence; the caller holds r.mu
+func (r *commonRepository) build(kind model.MessageType, message *model.Message, text string) *model.Message {
+	response := model.NewMessage(kind, text, r.sequence, r.name, message.From)
+	response.Chain = message.Chain
+	response.Hop = message.Hop + 1
+	r.signer.Sign(response)
+	return response
+}
+
 // GetSequence returns the current sequence number
 func (r *commonRepository) GetSequence() int {
 	r.mu.Lock()
@@ -92,102 +194,282 @@ func (r *commonRepository) IncrementSequence() int {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.sequence++
+	r.saveSequence()
 	return r.sequence
 }
 
+// saveSequence keeps the sequence number increasing across restarts by saving the
+// end of the model.SequenceBlock the counter entered once it leaves the reserved
+// one, so a crash skips fewer than a block of numbers; the caller holds r.mu
+func (r *commonRepository) saveSequence() {
+	if r.sequence <= r.saved {
+		return
+	}
+	reserved := (r.sequence + model.SequenceBlock - 1) / model.SequenceBlock * model.SequenceBlock
+	if err := r.state.SaveSequence(reserved); err != nil {
+		log.Printf("[Repository] ⚠ Failed to reserve sequence numbers up to %d: %v", reserved, err)
+		return
+	}
+	r.saved = reserved
+}
+
+// FlushSequence saves the current sequence number, releasing the rest of the
+// reserved block so a clean restart continues without a gap
+func (r *commonRepository) FlushSequence() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sequence == r.saved {
+		return nil
+	}
+	if err := r.state.SaveSequence(r.sequence); err != nil {
+		return fmt.Errorf("save sequence number %d: %w", r.sequence, err)
+	}
+	r.saved = r.sequence
+	return nil
+}
+
 // SendEchoToTarget sends a message echo to the target server URL
-func (r *commonRepository) SendEchoToTarget(targetURL string, message *model.Message) error {
+func (r *commonRepository) SendEchoToTarget(targetURL string, message *model.Message) (response.EchoResult, error) {
 	log.Printf("[Repository] ==========================================")
 	log.Printf("[Repository] SendEchoToTarget started")
 	log.Printf("[Repository]   Target URL: %s", targetURL)
 	log.Printf("[Repository]   Message: %s (seq: %d)", message.Content, message.Sequence)
 	log.Printf("[Repository] Creating NEW connection to target server")
 
-	if r.delay > 0 {
-		log.Printf("[Repository] ⏳ Sleeping for %s before echo", r.delay)
-		time.Sleep(r.delay)
-	}
-
-	dialer := &webtransport.Dialer{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	if delay := time.Duration(r.delay.Load()); delay > 0 {
+		log.Printf("[Repository] ⏳ Sleeping for %s before echo", delay)
+		time.Sleep(delay)
 	}
 
 	log.Printf("[Repository] Dialing target server...")
-	_, conn, err := dialer.Dial(context.Background(), targetURL, nil)
+	conn, wire, compressor, err := r.dial(targetURL)
 	if err != nil {
 		log.Printf("[Repository] ❌ Failed to dial target: %v", err)
-		return fmt.Errorf("failed to dial target: %w", err)
+		return response.EchoResult{}, err
 	}
 	defer func() {
 		conn.CloseWithError(0, "echo complete")
 		log.Printf("[Repository] Connection to target closed")
 	}()
-	log.Printf("[Repository] ✅ Connected to target successfully")
+	log.Printf("[Repository] ✅ Connected to target successfully (codec: %s, compression: %s)", wire.Name(), compressor.Name())
+
+	peer, err := r.peerFor("[Repository]", targetURL, message, func(req *request.PingRequest) (*response.PingResponse, error) {
+		return r.streamRoundTrip(conn, wire, compressor, req)
+	})
+	if err != nil {
+		log.Printf("[Repository] ❌ Handshake with target failed: %v", err)
+		return response.EchoResult{}, err
+	}
 
 	log.Printf("[Repository] Opening stream to target...")
 	stream, err := conn.OpenStreamSync(context.Background())
 	if err != nil {
 		log.Printf("[Repository] ❌ Failed to open stream: %v", err)
-		return fmt.Errorf("failed to open stream: %w", err)
+		return response.EchoResult{}, fmt.Errorf("failed to open stream: %w", err)
 	}
 	defer stream.Close()
 	log.Printf("[Repository] ✅ Stream opened: %d", stream.StreamID())
 
-	log.Printf("[Repository] Marshalling message to JSON...")
-	data, err := message.ToJSON()
+	log.Printf("[Repository] Marshalling message to %s...", wire.Name())
+	data, err := wire.MarshalRequest(newRequest(message, peer))
 	if err != nil {
 		log.Printf("[Repository] ❌ Failed to marshal message: %v", err)
-		return fmt.Errorf("failed to marshal message: %w", err)
+		return response.EchoResult{}, fmt.Errorf("failed to marshal message: %w", err)
 	}
+	result := response.EchoResult{Codec: wire.Name(), Bytes: len(data)}
 	log.Printf("[Repository] ✅ Message marshalled, size: %d bytes", len(data))
+	payload, err := compressor.EncodeFrame(data)
+	if err != nil {
+		log.Printf("[Repository] ❌ Failed to compress message: %v", err)
+		return result, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if compressor != nil {
+		result.Compression = compressor.Name()
+		result.WireBytes = len(payload)
+		log.Printf("[Repository]   %s frame: %d bytes", compressor.Name(), len(payload))
+	}
 
 	log.Printf("[Repository] Writing message to target stream...")
-	_, err = stream.Write(data)
-	if err != nil {
+	if err := transport.WriteFrame(stream, payload); err != nil {
 		log.Printf("[Repository] ❌ Failed to write to stream: %v", err)
-		return fmt.Errorf("failed to write to stream: %w", err)
+		return result, fmt.Errorf("failed to write to stream: %w", err)
 	}
 	log.Printf("[Repository] ✅ Message written to target: %s (seq: %d)", message.Content, message.Sequence)
 
 	// Read response from target server
 	log.Printf("[Repository] Reading response from target...")
-	buffer := make([]byte, 4096)
-	n, err := stream.Read(buffer)
+	frame, err := transport.ReadFrame(stream, r.maxFrame)
 	if err != nil {
 		log.Printf("[Repository] ❌ Failed to read response: %v", err)
-		return fmt.Errorf("failed to read response: %w", err)
+		return result, fmt.Errorf("failed to read response: %w", err)
 	}
-	log.Printf("[Repository] ✅ Response received, size: %d bytes", n)
+	log.Printf("[Repository] ✅ Response received, size: %d bytes", len(frame))
 
-	response, err := model.FromJSON(buffer[:n])
+	if frame, err = compressor.DecodeFrame(frame, r.maxFrame); err != nil {
+		log.Printf("[Repository] ❌ Failed to decompress response: %v", err)
+		return result, fmt.Errorf("failed to decompress response: %w", err)
+	}
+	reply, err := wire.UnmarshalResponse(frame)
 	if err != nil {
 		log.Printf("[Repository] ❌ Failed to parse response: %v", err)
-		return fmt.Errorf("failed to parse response: %w", err)
+		return result, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if err := reply.Err(); err != nil {
+		r.forgetOnMismatch(targetURL, reply)
+		log.Printf("[Repository] ❌ Target rejected message: %v", err)
+		return result, fmt.Errorf("target rejected message: %w", err)
 	}
 
-	log.Printf("[Repository] ✅ Echo response received: %s (seq: %d)", response.Content, response.Sequence)
+	log.Printf("[Repository] ✅ Echo response received: %s", describeReply(reply))
 	log.Printf("[Repository] Connection will be closed after this function returns")
 
 	// Connection will be closed by defer statements
 	// The response is already logged, no need to process it further in this connection
 	log.Printf("[Repository] ==========================================")
 
-	return nil
+	return result, nil
+}
+
+// SendAttachmentToTarget sends an attachment message to the target followed by the
+// payload read from attachment, chunk by chunk as it becomes available
+func (r *commonRepository) SendAttachmentToTarget(targetURL string, message *model.Message, attachment io.Reader) (response.EchoResult, error) {
+	desc, err := model.ParseAttachment(message.Content)
+	if err != nil {
+		return response.EchoResult{}, err
+	}
+	log.Printf("[Repository] Sending %d-byte attachment %q to %s", desc.Size, desc.Name, targetURL)
+
+	conn, wire, compressor, err := r.dial(targetURL)
+	if err != nil {
+		return response.EchoResult{}, err
+	}
+	defer conn.CloseWithError(0, "attachment complete")
+	peer, err := r.peerFor("[Repository]", targetURL, message, func(req *request.PingRequest) (*response.PingResponse, error) {
+		return r.streamRoundTrip(conn, wire, compressor, req)
+	})
+	if err != nil {
+		return response.EchoResult{}, err
+	}
+
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return response.EchoResult{}, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+	data, err := wire.MarshalRequest(newRequest(message, peer))
+	if err != nil {
+		return response.EchoResult{}, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	result := response.EchoResult{Codec: wire.Name(), Bytes: len(data)}
+	payload, err := compressor.EncodeFrame(data)
+	if err != nil {
+		return result, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if compressor != nil {
+		result.Compression = compressor.Name()
+		result.WireBytes = len(payload)
+	}
+	if err := transport.WriteFrame(stream, payload); err != nil {
+		return result, fmt.Errorf("failed to write to stream: %w", err)
+	}
+
+	started := time.Now()
+	chunks := transport.NewChunkWriter(stream, desc.Chunk)
+	source := &sourceReader{r: attachment}
+	_, copyErr := io.CopyN(chunks, source, desc.Size)
+	if copyErr == nil {
+		copyErr = chunks.Close()
+	} else if errors.Is(copyErr, io.EOF) {
+		source.err = fmt.Errorf("attachment shorter than %d bytes: %w", desc.Size, io.ErrUnexpectedEOF)
+	}
+	if source.err != nil {
+		// The source failed (e.g. a checksum mismatch upstream): reset the stream so
+		// the target drops the attachment instead of waiting for the rest
+		stream.CancelWrite(transport.StreamErrorAttachment)
+		return result, fmt.Errorf("attachment source failed: %w", source.err)
+	}
+
+	frame, err := transport.ReadFrame(stream, r.maxFrame)
+	if err != nil {
+		if copyErr != nil {
+			return result, fmt.Errorf("failed to write attachment: %w", copyErr)
+		}
+		return result, fmt.Errorf("failed to read response: %w", err)
+	}
+	if frame, err = compressor.DecodeFrame(frame, r.maxFrame); err != nil {
+		return result, fmt.Errorf("failed to decompress response: %w", err)
+	}
+	reply, err := wire.UnmarshalResponse(frame)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if err := reply.Err(); err != nil {
+		r.forgetOnMismatch(targetURL, reply)
+		return result, fmt.Errorf("target rejected attachment: %w", err)
+	}
+	if copyErr != nil {
+		return result, fmt.Errorf("failed to write attachment: %w", copyErr)
+	}
+	elapsed := time.Since(started)
+	log.Printf("[Repository] ✅ Attachment delivered to %s: %d bytes in %s (%.1f MiB/s)", targetURL, desc.Size, elapsed.Round(time.Millisecond), float64(desc.Size)/(1<<20)/elapsed.Seconds())
+	return result, nil
+}
+
+// dial opens an echo session to a target, offering the echo codec and compression.
+// It returns the codec and compression (nil for none) the target selected.
+func (r *commonRepository) dial(targetURL string) (*webtransport.Session, codec.Codec, *compress.Compressor, error) {
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: r.debug.ApplyTLS(r.clientTLS.Clone()),
+		QUICConfig:      r.debug.ApplyQUIC(r.quicConfig),
+	}
+
+	headers := r.auth.Headers(http.MethodConnect, urlPath(targetURL), nil)
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set(codec.HeaderAvailableProtocols, codec.FormatList(r.echoCodec.Name(), codec.JSON.Name()))
+	if r.compressor != nil {
+		headers.Set(compress.HeaderAccept, codec.FormatList(r.compressor.Name()))
+	}
+
+	rsp, conn, err := dialer.Dial(context.Background(), targetURL, headers)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to dial target: %w", err)
+	}
+	wire := codec.Selected(rsp.Header.Get(codec.HeaderProtocol))
+	var compressor *compress.Compressor
+	if compress.Negotiate(rsp.Header.Get(compress.HeaderSelected), []string{r.compressor.Name()}) != "" {
+		compressor = r.compressor
+	}
+	return conn, wire, compressor, nil
+}
+
+// sourceReader remembers the error of the reader an attachment is copied from, to
+// tell a failed source from a failed stream
+type sourceReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		s.err = err
+	}
+	return n, err
 }
 
 // SendPlainEchoToTarget sends the message via a simple HTTP POST (plaintext mode)
 // Expected targetURL form: http://host:port/plain (the server must expose a handler)
-func (r *commonRepository) SendPlainEchoToTarget(targetURL string, message *model.Message) error {
+func (r *commonRepository) SendPlainEchoToTarget(targetURL string, message *model.Message) (response.EchoResult, error) {
 	log.Printf("[Repository] (plain) ==========================================")
 	log.Printf("[Repository] (plain) SendPlainEchoToTarget started")
 	log.Printf("[Repository] (plain)   Target URL: %s", targetURL)
 	log.Printf("[Repository] (plain)   Message: %s (seq: %d)", message.Content, message.Sequence)
 
-	if r.delay > 0 {
-		log.Printf("[Repository] (plain) ⏳ Sleeping for %s before echo", r.delay)
-		time.Sleep(r.delay)
+	if delay := time.Duration(r.delay.Load()); delay > 0 {
+		log.Printf("[Repository] (plain) ⏳ Sleeping for %s before echo", delay)
+		time.Sleep(delay)
 	}
 
 	// Ensure TLS endpoint for local servers (auto-upgrade http -> https)
@@ -197,33 +479,240 @@ func (r *commonRepository) SendPlainEchoToTarget(targetURL string, message *mode
 		targetURL = u.String()
 	}
 
-	data, err := message.ToJSON()
+	wire, compressor := r.echoCodec, r.compressor
+	peer, err := r.peerFor("[Repository] (plain)", targetURL, message, func(req *request.PingRequest) (*response.PingResponse, error) {
+		reply, _, _, err := r.postPlain(targetURL, codec.JSON, nil, req)
+		return reply, err
+	})
+	if err != nil {
+		return response.EchoResult{}, err
+	}
+	if peer != nil && !peer.AcceptsCodec(wire.Name()) {
+		log.Printf("[Repository] (plain) ⚠ Target does not accept %s, downgrading to %s", wire.Name(), codec.JSON.Name())
+		wire = codec.JSON
+	}
+	if peer != nil && compressor != nil && !peer.AcceptsCompression(compressor.Name()) {
+		log.Printf("[Repository] (plain) ⚠ Target does not accept %s, sending uncompressed", compressor.Name())
+		compressor = nil
+	}
+
+	reply, status, result, err := r.postPlain(targetURL, wire, compressor, newRequest(message, peer))
+	if err != nil {
+		return result, err
+	}
+	if err := reply.Err(); err != nil {
+		r.forgetOnMismatch(targetURL, reply)
+		log.Printf("[Repository] (plain) ==========================================")
+		return result, fmt.Errorf("plain echo rejected by target: %s: %w", status, err)
+	}
+	log.Printf("[Repository] (plain) Echo response received (%s): %s", result.Codec, describeReply(reply))
+	log.Printf("[Repository] (plain) ==========================================")
+	return result, nil
+}
+
+// postPlain sends a request envelope to a /plain endpoint and parses the response
+// envelope, which may be a rejection. It also returns the response status and the
+// codec, compression and sizes of the request.
+func (r *commonRepository) postPlain(targetURL string, wire codec.Codec, compressor *compress.Compressor, ping *request.PingRequest) (*response.PingResponse, string, response.EchoResult, error) {
+	data, err := wire.MarshalRequest(ping)
+	if err != nil {
+		return nil, "", response.EchoResult{}, fmt.Errorf("marshal message: %w", err)
+	}
+	result := response.EchoResult{Codec: wire.Name(), Bytes: len(data)}
+	compressed, err := compressor.Compress(data)
 	if err != nil {
-		return fmt.Errorf("marshal message: %w", err)
+		return nil, "", result, fmt.Errorf("compress message: %w", err)
+	}
+	if compressed != nil {
+		data = compressed
 	}
 	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("build request: %w", err)
+		return nil, "", result, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", wire.ContentType())
+	req.Header.Set("Accept", wire.ContentType())
+	if compressor != nil {
+		result.Compression = compressor.Name()
+		result.WireBytes = len(data)
+		req.Header.Set("Accept-Encoding", compressor.Name())
+		if compressed != nil {
+			req.Header.Set("Content-Encoding", compressor.Name())
+		}
+	}
+	for key, values := range r.auth.Headers(http.MethodPost, req.URL.Path, data) {
+		req.Header[key] = values
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// Allow both http and https (self-signed) for plaintext path
+	// Allow both http and https for plaintext path; https peers are verified like WebTransport ones
 	client := http.DefaultClient
 	if u, perr := neturl.Parse(targetURL); perr == nil && u.Scheme == "https" {
-		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: r.debug.ApplyTLS(r.clientTLS.Clone())}}
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("plain echo request failed: %w", err)
+		return nil, "", result, fmt.Errorf("plain echo request failed: %w", err)
 	}
 	defer resp.Body.Close()
-	body, _ := io.ReadAll(resp.Body)
-	log.Printf("[Repository] (plain) Response status: %s", resp.Status)
-	trimmed := strings.TrimSpace(string(body))
-	if trimmed != "" {
-		log.Printf("[Repository] (plain) Body: %s", trimmed)
+	body, err := io.ReadAll(io.LimitReader(resp.Body, int64(r.maxBody)+1))
+	if err != nil {
+		return nil, resp.Status, result, fmt.Errorf("read plain echo response: %w", err)
 	}
-	log.Printf("[Repository] (plain) ==========================================")
-	return nil
+	if len(body) > r.maxBody {
+		return nil, resp.Status, result, fmt.Errorf("plain echo response exceeds %d bytes", r.maxBody)
+	}
+	log.Printf("[Repository] (plain) Response status: %s (%d bytes)", resp.Status, len(body))
+	if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+		if body, err = compress.Decompress(encoding, body, r.maxBody); err != nil {
+			return nil, resp.Status, result, fmt.Errorf("decompress plain echo response: %w", err)
+		}
+	}
+	replyCodec, ok := codec.ByContentType(resp.Header.Get("Content-Type"))
+	if !ok {
+		return nil, resp.Status, result, fmt.Errorf("plain echo response from target: %s: unsupported Content-Type %q", resp.Status, resp.Header.Get("Content-Type"))
+	}
+	reply, err := replyCodec.UnmarshalResponse(body)
+	if err != nil {
+		if resp.StatusCode != http.StatusOK {
+			return nil, resp.Status, result, fmt.Errorf("plain echo rejected by target: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		}
+		return nil, resp.Status, result, fmt.Errorf("parse plain echo response: %w", err)
+	}
+	return reply, resp.Status, result, nil
+}
+
+// streamRoundTrip sends a request envelope on a new stream of an echo session and
+// parses the response envelope, which may be a rejection
+func (r *commonRepository) streamRoundTrip(conn *webtransport.Session, wire codec.Codec, compressor *compress.Compressor, req *request.PingRequest) (*response.PingResponse, error) {
+	stream, err := conn.OpenStreamSync(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open stream: %w", err)
+	}
+	defer stream.Close()
+	data, err := wire.MarshalRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	if data, err = compressor.EncodeFrame(data); err != nil {
+		return nil, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := transport.WriteFrame(stream, data); err != nil {
+		return nil, fmt.Errorf("failed to write to stream: %w", err)
+	}
+	frame, err := transport.ReadFrame(stream, r.maxFrame)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if frame, err = compressor.DecodeFrame(frame, r.maxFrame); err != nil {
+		return nil, fmt.Errorf("failed to decompress response: %w", err)
+	}
+	return wire.UnmarshalResponse(frame)
+}
+
+// peerFor returns the capabilities negotiated with a target, saying hello through
+// exchange when none are cached, and checks that the target handles the message.
+// It returns nil capabilities when the handshake is disabled.
+func (r *commonRepository) peerFor(prefix, targetURL string, message *model.Message, exchange func(*request.PingRequest) (*response.PingResponse, error)) (*model.PeerCapabilities, error) {
+	if !r.handshake {
+		return nil, nil
+	}
+	peer, ok := r.peers.Get(targetURL)
+	if !ok {
+		var err error
+		if peer, err = r.hello(prefix, targetURL, exchange); err != nil {
+			return nil, fmt.Errorf("hello to target failed: %w", err)
+		}
+		r.peers.Put(targetURL, peer)
+	}
+	if err := peer.Err(); err != nil {
+		return nil, fmt.Errorf("target refused: %w", err)
+	}
+	if !peer.Handles(message.Type) {
+		return nil, fmt.Errorf("target %s does not handle %s messages (handles %s)", peer.Server, message.Type, strings.Join(peer.Types, ", "))
+	}
+	return peer, nil
+}
+
+// hello advertises this server's capabilities to a target and negotiates with the
+// ones it answers with. A target answering unsupported_type predates the handshake
+// and is assumed to speak the base protocol.
+func (r *commonRepository) hello(prefix, targetURL string, exchange func(*request.PingRequest) (*response.PingResponse, error)) (*model.PeerCapabilities, error) {
+	local := r.peers.Local()
+	data, err := json.Marshal(local)
+	if err != nil {
+		return nil, fmt.Errorf("encode capabilities: %w", err)
+	}
+	message := model.NewMessage(model.HelloMessage, string(data), r.GetSequence(), r.name, "")
+	message.Chain = "hello:" + r.name
+	r.signer.Sign(message)
+	req := request.NewPingRequest(message)
+	req.Header.Version = model.MinProtocolVersion // Understood by every peer we could talk to
+
+	log.Printf("%s ⏳ Saying hello to %s", prefix, targetURL)
+	reply, err := exchange(req)
+	if err != nil {
+		return nil, err
+	}
+	if reply.Code == response.CodeUnsupportedType {
+		peer, _ := model.Negotiate(local, model.LegacyCapabilities(targetURL))
+		peer.Legacy = true
+		log.Printf("%s ⚠ %s does not support hello, downgrading to version %d with json and ping/pong only", prefix, targetURL, peer.Version)
+		return &peer, nil
+	}
+	if err := reply.Err(); err != nil {
+		return nil, err
+	}
+	if reply.Message == nil {
+		return nil, errors.New("hello answered without capabilities")
+	}
+	var remote model.Capabilities
+	if err := json.Unmarshal([]byte(reply.Message.Content), &remote); err != nil {
+		return nil, fmt.Errorf("parse capabilities: %w", err)
+	}
+	peer, err := model.Negotiate(local, remote)
+	if err != nil {
+		log.Printf("%s ❌ Refusing %s: %v", prefix, targetURL, err)
+	} else {
+		log.Printf("%s ✅ Negotiated with %s: version %d, codecs %v, compression %v, types %v", prefix, remote.Server, peer.Version, remote.Codecs, remote.Compression, remote.Types)
+	}
+	return &peer, nil
+}
+
+// forgetOnMismatch drops the cached capabilities of a target that rejected a message
+// for its version or type, so the next echo says hello again
+func (r *commonRepository) forgetOnMismatch(targetURL string, reply *response.PingResponse) {
+	if reply.Code == response.CodeUnsupportedVersion || reply.Code == response.CodeUnsupportedType {
+		r.peers.Forget(targetURL)
+	}
+}
+
+// newRequest wraps a message in an envelope of the version negotiated with the peer
+func newRequest(message *model.Message, peer *model.PeerCapabilities) *request.PingRequest {
+	req := request.NewPingRequest(message)
+	if peer != nil {
+		req.Header.Version = peer.Version
+	}
+	return req
+}
+
+// describeReply summarizes a successful response envelope for the log
+func describeReply(reply *response.PingResponse) string {
+	if reply.Message == nil {
+		return "duplicate, original still being processed"
+	}
+	text := fmt.Sprintf("%s (seq: %d)", reply.Message.Content, reply.Message.Sequence)
+	if reply.Duplicate {
+		text += " [duplicate]"
+	}
+	return text
+}
+
+// urlPath returns the path of a URL for request signing (empty if it does not parse)
+func urlPath(rawURL string) string {
+	u, err := neturl.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Path
 }
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Dedupe errors returned by Begin
+var (
+	// ErrMissingID is returned for messages without an ID or nonce
+	ErrMissingID = errors.New("message has no id or nonce")
+	// ErrReplay is returned when a message ID is reused with a different nonce
+	ErrReplay = errors.New("message id reused with a different nonce")
+	// ErrStale is returned for messages whose timestamp is outside the dedupe window;
+	// they could not be told apart from a replay of an expired entry
+	ErrStale = errors.New("message timestamp outside the dedupe window")
+	// ErrFull is matched by the *FullError returned while the window is full
+	ErrFull = errors.New("dedupe window full")
+)
+
+// FullError is returned by Begin while the window holds max_entries IDs that have
+// not expired. Evicting one would let its message be replayed, so new messages are
+// refused until the oldest entry expires.
+type FullError struct {
+	RetryAfter time.Duration // Until the oldest entry expires
+}
+
+func (e *FullError) Error() string {
+	return fmt.Sprintf("%s (retry in %s)", ErrFull, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *FullError) Unwrap() error { return ErrFull }
+
+// dedupeRepository implements the DedupeRepository interface with a bounded,
+// time-limited set of recently processed message IDs
+type dedupeRepository struct {
+	mu         sync.Mutex
+	window     time.Duration           // How long a message ID is remembered
+	maxEntries int                     // Upper bound on remembered IDs; new messages are refused beyond it
+	entries    map[string]*dedupeEntry // Keyed by sender and message ID
+	order      *list.List              // Keys in arrival order, for expiry and eviction
+	now        func() time.Time
+}
+
+// dedupeEntry is a remembered message
+type dedupeEntry struct {
+	nonce    string
+	seen     time.Time
+	response *model.Message // Response generated for the message (nil while it is processed)
+	element  *list.Element
+}
+
+// NewDedupeRepository creates a dedupe window remembering message IDs for window,
+// keeping at most maxEntries of them
+func NewDedupeRepository(window time.Duration, maxEntries int) DedupeRepository {
+	return &dedupeRepository{
+		window:     window,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*dedupeEntry),
+		order:      list.New(),
+		now:        time.Now,
+	}
+}
+
+// Begin records a message about to be processed
+func (r *dedupeRepository) Begin(message *model.Message) (bool, *model.Message, error) {
+	if message.ID == "" || message.Nonce == "" {
+		return false, nil, ErrMissingID
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	r.expire(now)
+	if age := now.Sub(message.Timestamp); age > r.window || age < -r.window {
+		return false, nil, fmt.Errorf("%w (%s old, window %s)", ErrStale, age.Round(time.Millisecond), r.window)
+	}
+
+	key := dedupeKey(message)
+	if entry, ok := r.entries[key]; ok {
+		if entry.nonce != message.Nonce {
+			return false, nil, fmt.Errorf("%w (id %s from %s)", ErrReplay, message.ID, message.From)
+		}
+		return true, entry.response, nil
+	}
+
+	if len(r.entries) >= r.maxEntries {
+		oldest := r.entries[r.order.Front().Value.(string)]
+		return false, nil, &FullError{RetryAfter: oldest.seen.Add(r.window).Sub(now) + time.Nanosecond}
+	}
+	entry := &dedupeEntry{nonce: message.Nonce, seen: now}
+	entry.element = r.order.PushBack(key)
+	r.entries[key] = entry
+	return false, nil, nil
+}
+
+// Complete stores the response generated for a message passed to Begin
+func (r *dedupeRepository) Complete(message, response *model.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[dedupeKey(message)]; ok && entry.nonce == message.Nonce {
+		entry.response = response
+	}
+}
+
+// Abort forgets a message whose processing failed so a retry is processed again
+func (r *dedupeRepository) Abort(message *model.Message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if entry, ok := r.entries[dedupeKey(message)]; ok && entry.nonce == message.Nonce {
+		r.remove(entry.element)
+	}
+}
+
+// Size returns the number of remembered message IDs
+func (r *dedupeRepository) Size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.entries)
+}
+
+// expire drops entries older than the window (the list is in arrival order)
+func (r *dedupeRepository) expire(now time.Time) {
+	for element := r.order.Front(); element != nil; element = r.order.Front() {
+		if now.Sub(r.entries[element.Value.(string)].seen) <= r.window {
+			return
+		}
+		r.remove(element)
+	}
+}
+
+// remove deletes the entry of a list element
+func (r *dedupeRepository) remove(element *list.Element) {
+	delete(r.entries, element.Value.(string))
+	r.order.Remove(element)
+}
+
+// dedupeKey identifies a message by sender and ID
+func dedupeKey(message *model.Message) string {
+	return message.From + "\x00" + message.ID
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+func TestDedupeBegin(t *testing.T) {
+	start := time.Unix(1760000000, 0)
+	message := func(from, id, nonce string) *model.Message {
+		return &model.Message{ID: id, Nonce: nonce, Type: model.PingMessage, From: from, Timestamp: start}
+	}
+	reply := &model.Message{ID: "reply", Type: model.PongMessage}
+
+	tests := []struct {
+		name         string
+		setup        func(r *dedupeRepository, advance func(time.Duration)) // Messages seen before
+		message      *model.Message
+		wantDup      bool
+		wantResponse *model.Message
+		wantErr      error
+	}{
+		{
+			name:    "first delivery",
+			message: message("server1", "a", "n1"),
+		},
+		{
+			name: "retry while the original is processed",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+			},
+			message: message("server1", "a", "n1"),
+			wantDup: true,
+		},
+		{
+			name: "retry after the original completed",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				r.Complete(message("server1", "a", "n1"), reply)
+			},
+			message:      message("server1", "a", "n1"),
+			wantDup:      true,
+			wantResponse: reply,
+		},
+		{
+			name: "retry after the original failed",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				r.Abort(message("server1", "a", "n1"))
+			},
+			message: message("server1", "a", "n1"),
+		},
+		{
+			name: "id reused with another nonce",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+			},
+			message: message("server1", "a", "n2"),
+			wantErr: ErrReplay,
+		},
+		{
+			name: "same id from another sender",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+			},
+			message: message("server2", "a", "n1"),
+		},
+		{
+			name: "replayed after the window",
+			setup: func(r *dedupeRepository, advance func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				advance(2 * time.Minute)
+			},
+			message: message("server1", "a", "n1"),
+			wantErr: ErrStale,
+		},
+		{
+			name:    "timestamp ahead of the window",
+			message: &model.Message{ID: "a", Nonce: "n1", From: "server1", Timestamp: start.Add(2 * time.Minute)},
+			wantErr: ErrStale,
+		},
+		{
+			name: "new message while the window is full",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				r.Begin(message("server1", "b", "n2"))
+			},
+			message: message("server1", "c", "n3"),
+			wantErr: ErrFull,
+		},
+		{
+			name: "replay after flooding the window",
+			setup: func(r *dedupeRepository, _ func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				r.Begin(message("server1", "b", "n2"))
+				r.Begin(message("server1", "c", "n3"))
+				r.Begin(message("server1", "d", "n4"))
+			},
+			message: message("server1", "a", "n1"),
+			wantDup: true,
+		},
+		{
+			name: "new message once the oldest entry expired",
+			setup: func(r *dedupeRepository, advance func(time.Duration)) {
+				r.Begin(message("server1", "a", "n1"))
+				advance(30 * time.Second)
+				r.Begin(message("server1", "b", "n2"))
+				advance(31 * time.Second)
+			},
+			message: &model.Message{ID: "c", Nonce: "n3", From: "server1", Timestamp: start.Add(61 * time.Second)},
+		},
+		{
+			name:    "missing id",
+			message: message("server1", "", "n1"),
+			wantErr: ErrMissingID,
+		},
+		{
+			name:    "missing nonce",
+			message: message("server1", "a", ""),
+			wantErr: ErrMissingID,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewDedupeRepository(time.Minute, 2).(*dedupeRepository)
+			now := start
+			r.now = func() time.Time { return now }
+			if tt.setup != nil {
+				tt.setup(r, func(d time.Duration) { now = now.Add(d) })
+			}
+
+			duplicate, response, err := r.Begin(tt.message)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Begin() error = %v, want %v", err, tt.wantErr)
+			}
+			if duplicate != tt.wantDup {
+				t.Errorf("Begin() duplicate = %t, want %t", duplicate, tt.wantDup)
+			}
+			if response != tt.wantResponse {
+				t.Errorf("Begin() response = %v, want %v", response, tt.wantResponse)
+			}
+			if r.Size() > 2 {
+				t.Errorf("Size() = %d, above the limit of 2", r.Size())
+			}
+		})
+	}
+}
+
+func TestDedupeFullRetryAfter(t *testing.T) {
+	start := time.Unix(1760000000, 0)
+	r := NewDedupeRepository(time.Minute, 1).(*dedupeRepository)
+	now := start
+	r.now = func() time.Time { return now }
+	r.Begin(&model.Message{ID: "a", Nonce: "n1", From: "server1", Timestamp: start})
+	now = now.Add(20 * time.Second)
+
+	_, _, err := r.Begin(&model.Message{ID: "b", Nonce: "n2", From: "server1", Timestamp: now})
+	var full *FullError
+	if !errors.As(err, &full) {
+		t.Fatalf("Begin() = %v, want *FullError", err)
+	}
+	if full.RetryAfter <= 40*time.Second-time.Millisecond || full.RetryAfter > 40*time.Second+time.Millisecond {
+		t.Errorf("RetryAfter = %s, want 40s (until the oldest entry expires)", full.RetryAfter)
+	}
+}
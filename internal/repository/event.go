@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"log"
+	"sync"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// eventRepository implements the EventRepository interface as an in-memory fan-out hub
+type eventRepository struct {
+	mu          sync.Mutex
+	history     []*model.Event                 // Ring of recent events replayed to new subscribers
+	historySize int                            // Maximum number of events kept in history
+	subscribers map[chan *model.Event]struct{} // Active subscriber channels
+}
+
+// subscriberBuffer is the per-subscriber channel capacity; slow subscribers drop events
+const subscriberBuffer = 64
+
+// NewEventRepository creates a new event repository keeping the last historySize events
+func NewEventRepository(historySize int) EventRepository {
+	if historySize < 0 {
+		historySize = 0
+	}
+	return &eventRepository{
+		historySize: historySize,
+		subscribers: make(map[chan *model.Event]struct{}),
+	}
+}
+
+// Publish records an event and fans it out to all subscribers
+func (r *eventRepository) Publish(event *model.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.historySize > 0 {
+		if len(r.history) >= r.historySize {
+			r.history = r.history[1:]
+		}
+		r.history = append(r.history, event)
+	}
+
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("[Repository] ⚠ Event subscriber is slow, dropping %s event", event.Kind)
+		}
+	}
+}
+
+// Subscribe returns a channel receiving recent and future events, and a cancel function
+func (r *eventRepository) Subscribe() (<-chan *model.Event, func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan *model.Event, subscriberBuffer+len(r.history))
+	for _, event := range r.history {
+		ch <- event
+	}
+	r.subscribers[ch] = struct{}{}
+
+	var once sync.Once
+	cancel := func() {
+		once.Do(func() {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+			delete(r.subscribers, ch)
+			close(ch)
+		})
+	}
+	return ch, cancel
+}
@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/certs"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
+)
+
+// healthRepository implements the HealthRepository interface
+type healthRepository struct {
+	mu           sync.Mutex
+	listeners    []response.ListenerStatus             // Listener states in registration order
+	certificate  *x509.Certificate                     // Serving certificate (leaf)
+	sessions     int                                   // Active WebTransport sessions
+	streams      int                                   // Streams currently being handled
+	echoes       int                                   // Echoes to targets currently in flight
+	compression  map[string]*response.CompressionStats // Compressed payload counters by algorithm
+	probeTimeout time.Duration                         // Timeout applied to each reachability probe
+	clientTLS    *tls.Config                           // Peer verification for probes (same as echo dialers)
+	auth         *auth.Authenticator                   // Credentials attached to WebTransport probes
+}
+
+// NewHealthRepository creates a new health repository
+func NewHealthRepository(probeTimeout time.Duration, clientTLS *tls.Config, authn *auth.Authenticator) HealthRepository {
+	return &healthRepository{
+		probeTimeout: probeTimeout,
+		clientTLS:    clientTLS,
+		auth:         authn,
+		compression:  make(map[string]*response.CompressionStats),
+	}
+}
+
+// SetListener records the state of a listener (err is nil when it is serving)
+func (r *healthRepository) SetListener(network, address string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	status := response.ListenerStatus{Network: network, Address: address, Up: err == nil}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	for i := range r.listeners {
+		if r.listeners[i].Network == network {
+			r.listeners[i] = status
+			return
+		}
+	}
+	r.listeners = append(r.listeners, status)
+}
+
+// Listeners returns the state of all registered listeners
+func (r *healthRepository) Listeners() []response.ListenerStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]response.ListenerStatus(nil), r.listeners...)
+}
+
+// SetCertificate records the serving certificate
+func (r *healthRepository) SetCertificate(cert *x509.Certificate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.certificate = cert
+}
+
+// Certificate returns the serving certificate status, or nil if none is loaded
+func (r *healthRepository) Certificate() *response.CertificateStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.certificate == nil {
+		return nil
+	}
+	now := time.Now()
+	return &response.CertificateStatus{
+		Subject:          r.certificate.Subject.String(),
+		NotAfter:         r.certificate.NotAfter,
+		ExpiresInSeconds: int64(r.certificate.NotAfter.Sub(now).Seconds()),
+		Valid:            now.After(r.certificate.NotBefore) && now.Before(r.certificate.NotAfter),
+		SHA256:           certs.FingerprintHex(r.certificate),
+		HashCompatible:   certs.HashCompatible(r.certificate, now) == nil,
+	}
+}
+
+// SessionOpened increments the active WebTransport session count
+func (r *healthRepository) SessionOpened() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions++
+}
+
+// SessionClosed decrements the active WebTransport session count
+func (r *healthRepository) SessionClosed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sessions > 0 {
+		r.sessions--
+	}
+}
+
+// ActiveSessions returns the number of active WebTransport sessions
+func (r *healthRepository) ActiveSessions() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions
+}
+
+// StreamOpened increments the number of streams being handled
+func (r *healthRepository) StreamOpened() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.streams++
+}
+
+// StreamClosed decrements the number of streams being handled
+func (r *healthRepository) StreamClosed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.streams > 0 {
+		r.streams--
+	}
+}
+
+// ActiveStreams returns the number of streams being handled
+func (r *healthRepository) ActiveStreams() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.streams
+}
+
+// EchoStarted increments the number of in-flight echoes to targets
+func (r *healthRepository) EchoStarted() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.echoes++
+}
+
+// EchoFinished decrements the number of in-flight echoes to targets
+func (r *healthRepository) EchoFinished() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.echoes > 0 {
+		r.echoes--
+	}
+}
+
+// InFlightEchoes returns the number of in-flight echoes to targets
+func (r *healthRepository) InFlightEchoes() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.echoes
+}
+
+// RecordCompression counts a payload sent or received with a compression algorithm
+func (r *healthRepository) RecordCompression(algorithm string, rawBytes, wireBytes int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats, ok := r.compression[algorithm]
+	if !ok {
+		stats = &response.CompressionStats{}
+		r.compression[algorithm] = stats
+	}
+	stats.Payloads++
+	if wireBytes < rawBytes {
+		stats.Compressed++
+	}
+	stats.RawBytes += int64(rawBytes)
+	stats.WireBytes += int64(wireBytes)
+}
+
+// Compression returns the compressed payload counters by algorithm
+func (r *healthRepository) Compression() map[string]response.CompressionStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make(map[string]response.CompressionStats, len(r.compression))
+	for algorithm, stats := range r.compression {
+		snapshot := *stats
+		if snapshot.WireBytes > 0 {
+			snapshot.Ratio = float64(snapshot.RawBytes) / float64(snapshot.WireBytes)
+		}
+		result[algorithm] = snapshot
+	}
+	return result
+}
+
+// ProbeWebTransport checks that a WebTransport session can be established to the URL
+func (r *healthRepository) ProbeWebTransport(targetURL string) response.ProbeResult {
+	result := response.ProbeResult{URL: targetURL}
+	ctx, cancel := context.WithTimeout(context.Background(), r.probeTimeout)
+	defer cancel()
+
+	dialer := &webtransport.Dialer{
+		TLSClientConfig: r.clientTLS.Clone(),
+	}
+	defer dialer.Close()
+
+	started := time.Now()
+	_, conn, err := dialer.Dial(ctx, targetURL, r.auth.Headers(http.MethodConnect, urlPath(targetURL), nil))
+	result.LatencyMs = float64(time.Since(started).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.CloseWithError(0, "probe complete")
+	result.Reachable = true
+	return result
+}
+
+// ProbePlain checks that the /plain endpoint at the URL answers HTTP requests.
+// A HEAD request is used so no message is injected; any HTTP status proves reachability.
+func (r *healthRepository) ProbePlain(targetURL string) response.ProbeResult {
+	result := response.ProbeResult{URL: targetURL}
+	ctx, cancel := context.WithTimeout(context.Background(), r.probeTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, targetURL, nil)
+	if err != nil {
+		result.Error = fmt.Sprintf("build request: %v", err)
+		return result
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: r.clientTLS.Clone()}}
+	defer client.CloseIdleConnections()
+
+	started := time.Now()
+	resp, err := client.Do(req)
+	result.LatencyMs = float64(time.Since(started).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	resp.Body.Close()
+	result.Reachable = true
+	return result
+}
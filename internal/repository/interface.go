@@ -1,7 +1,12 @@
 package repository
 
 import (
+	"crypto/x509"
+	"io"
+	"time"
+
 	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/response"
 )
 
 // CommonRepository defines the interface for repository operations
@@ -10,14 +15,142 @@ type CommonRepository interface {
 	ProcessPing(message *model.Message) (*model.Message, error)
 	// ProcessPong processes a pong message and returns a ping response
 	ProcessPong(message *model.Message) (*model.Message, error)
+	// NewReply builds and signs a message of the given type replying to message,
+	// with the next sequence number (used by handlers of types other than ping/pong)
+	NewReply(kind model.MessageType, message *model.Message, content string) *model.Message
 	// GetSequence returns the current sequence number
 	GetSequence() int
 	// IncrementSequence increments and returns the new sequence number
 	IncrementSequence() int
+	// FlushSequence saves the exact current sequence number (called on shutdown)
+	FlushSequence() error
 	// SendEchoToTarget sends a message echo to the target server URL
-	SendEchoToTarget(targetURL string, message *model.Message) error
+	SendEchoToTarget(targetURL string, message *model.Message) (response.EchoResult, error)
+	// SendAttachmentToTarget sends an attachment message to the target over WebTransport,
+	// followed by the attachment payload streamed from attachment in checksummed chunks
+	SendAttachmentToTarget(targetURL string, message *model.Message, attachment io.Reader) (response.EchoResult, error)
 	// SendPlainEchoToTarget sends a message echo to the target over HTTP (plaintext mode)
-	SendPlainEchoToTarget(targetURL string, message *model.Message) error
+	SendPlainEchoToTarget(targetURL string, message *model.Message) (response.EchoResult, error)
+	// SetDelay changes the delay applied before each echo (used by config reload)
+	SetDelay(delay time.Duration)
+}
+
+// EventRepository defines the interface for the live event feed
+type EventRepository interface {
+	// Publish records an event and fans it out to all subscribers
+	Publish(event *model.Event)
+	// Subscribe returns a channel receiving recent and future events, and a cancel function
+	Subscribe() (<-chan *model.Event, func())
+}
+
+// DedupeRepository defines the interface for the window of recently processed messages
+type DedupeRepository interface {
+	// Begin records a message about to be processed. It reports a duplicate (same sender,
+	// ID and nonce) with the response generated for the original, which is nil while the
+	// original is still being processed. It returns ErrMissingID, ErrReplay or ErrStale
+	// (wrapped) for messages that must be rejected, and a *FullError while the window
+	// is full of unexpired IDs.
+	Begin(message *model.Message) (duplicate bool, response *model.Message, err error)
+	// Complete stores the response generated for a message passed to Begin
+	Complete(message, response *model.Message)
+	// Abort forgets a message whose processing failed so a retry is processed again
+	Abort(message *model.Message)
+	// Size returns the number of remembered message IDs
+	Size() int
+}
+
+// HealthRepository defines the interface for server status and peer reachability
+type HealthRepository interface {
+	// SetListener records the state of a listener (err is nil when it is serving)
+	SetListener(network, address string, err error)
+	// Listeners returns the state of all registered listeners
+	Listeners() []response.ListenerStatus
+	// SetCertificate records the serving certificate
+	SetCertificate(cert *x509.Certificate)
+	// Certificate returns the serving certificate status, or nil if none is loaded
+	Certificate() *response.CertificateStatus
+	// SessionOpened increments the active WebTransport session count
+	SessionOpened()
+	// SessionClosed decrements the active WebTransport session count
+	SessionClosed()
+	// ActiveSessions returns the number of active WebTransport sessions
+	ActiveSessions() int
+	// StreamOpened increments the number of streams being handled
+	StreamOpened()
+	// StreamClosed decrements the number of streams being handled
+	StreamClosed()
+	// ActiveStreams returns the number of streams being handled
+	ActiveStreams() int
+	// EchoStarted increments the number of in-flight echoes to targets
+	EchoStarted()
+	// EchoFinished decrements the number of in-flight echoes to targets
+	EchoFinished()
+	// InFlightEchoes returns the number of in-flight echoes to targets
+	InFlightEchoes() int
+	// RecordCompression counts a payload sent or received with a compression algorithm
+	RecordCompression(algorithm string, rawBytes, wireBytes int)
+	// Compression returns the compressed payload counters by algorithm
+	Compression() map[string]response.CompressionStats
+	// ProbeWebTransport checks that a WebTransport session can be established to the URL
+	ProbeWebTransport(targetURL string) response.ProbeResult
+	// ProbePlain checks that the /plain endpoint at the URL answers HTTP requests
+	ProbePlain(targetURL string) response.ProbeResult
+}
+
+// PeerRepository defines the interface for the capabilities negotiated with peers
+type PeerRepository interface {
+	// Local returns the capabilities this server advertises in hello messages
+	Local() model.Capabilities
+	// Get returns the cached capabilities of a target URL unless they are older
+	// than the handshake TTL
+	Get(targetURL string) (*model.PeerCapabilities, bool)
+	// Put caches the outcome of a hello this server sent to a target, refusals included
+	Put(targetURL string, caps *model.PeerCapabilities)
+	// Forget drops a target so the next echo says hello again
+	Forget(targetURL string)
+	// PutSender records the outcome of a hello received from a sender; it is only
+	// reported, never used to choose how to echo
+	PutSender(sender string, caps *model.PeerCapabilities)
+	// Peers returns the cached capabilities of all targets
+	Peers() map[string]model.PeerCapabilities
+	// Senders returns the capabilities of the senders that said hello
+	Senders() map[string]model.PeerCapabilities
+}
+
+// StateRepository defines the interface for state kept across restarts: the sequence
+// counter, the chains passing through this server and the capabilities of peers
+type StateRepository interface {
+	// Persistent reports whether state survives restarts (false without a state file)
+	Persistent() bool
+	// Sequence returns the last saved sequence number
+	Sequence() (int, error)
+	// SaveSequence persists the sequence number
+	SaveSequence(sequence int) error
+	// Chains returns the saved chains
+	Chains() ([]model.ChainState, error)
+	// SaveChain records the last step of a chain on this server. Chain changes are
+	// written in the background, so a crash loses at most the last second of them.
+	SaveChain(chain model.ChainState) error
+	// StopChain marks a chain stopped so it is not resumed
+	StopChain(key string) error
+	// EndChain forgets a chain that ended on this server
+	EndChain(key string) error
+	// Peers returns the saved peer capabilities
+	Peers() (map[string]model.PeerCapabilities, error)
+	// SavePeer persists the capabilities negotiated with a peer
+	SavePeer(peer string, caps *model.PeerCapabilities) error
+	// ForgetPeer drops the capabilities of a peer
+	ForgetPeer(peer string) error
+	// Close releases the state file
+	Close() error
+}
+
+// JournalRepository defines the interface for the journal of messages received and sent
+type JournalRepository interface {
+	// Record appends an entry to the journal
+	Record(entry *model.JournalEntry)
+	// Close releases the journal file
+	Close() error
 }
 
-// (Constructor implemented in common.go)
+// (Constructors implemented in common.go, event.go, dedupe.go, health.go, peer.go, state.go and journal.go)
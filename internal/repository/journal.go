@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// journalRepository implements the JournalRepository interface with a JSONL file
+// rotated by size: path, then path.1 (newest) to path.<maxBackups> (oldest)
+type journalRepository struct {
+	mu         sync.Mutex
+	path       string
+	maxBytes   int64 // Size after which the file is rotated
+	maxBackups int   // Rotated files kept
+	file       *os.File
+	size       int64
+	closed     bool      // Set by Close; later entries are dropped
+	retryAt    time.Time // After a failed rotation, when to try again
+}
+
+// journalRotateRetry is how long a journal keeps growing after a failed rotation
+// before rotating is tried again
+const journalRotateRetry = time.Minute
+
+// nopJournalRepository implements the JournalRepository interface without recording anything
+type nopJournalRepository struct{}
+
+// NewJournalRepository opens the journal at path for appending, creating it if
+// needed. An empty path records nothing.
+func NewJournalRepository(path string, maxBytes int64, maxBackups int) (JournalRepository, error) {
+	if path == "" {
+		return nopJournalRepository{}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create journal directory: %w", err)
+	}
+	r := &journalRepository{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// open opens the journal file for appending. It holds full message contents, so
+// it is readable by the owner only, like the state file.
+func (r *journalRepository) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open journal %s: %w", r.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat journal %s: %w", r.path, err)
+	}
+	if info.Mode().Perm()&0o077 != 0 {
+		// A journal created by an older version may still be world readable
+		if err := file.Chmod(0o600); err != nil {
+			log.Printf("[Repository] ⚠ Failed to restrict journal %s to its owner: %v", r.path, err)
+		}
+	}
+	r.file, r.size = file, info.Size()
+	return nil
+}
+
+// Record appends an entry as one JSON line, rotating the file first if it is full
+func (r *journalRepository) Record(entry *model.JournalEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[Repository] ⚠ Failed to encode journal entry: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	if r.file != nil && r.size > 0 && r.size+int64(len(line)) > r.maxBytes && time.Now().After(r.retryAt) {
+		if err := r.rotate(); err != nil {
+			log.Printf("[Repository] ⚠ Failed to rotate journal %s, appending to it for %s: %v", r.path, journalRotateRetry, err)
+			r.retryAt = time.Now().Add(journalRotateRetry)
+		}
+	}
+	if r.file == nil {
+		// A failed rotation (or reopen) left no file open: keep the current one going
+		if err := r.open(); err != nil {
+			log.Printf("[Repository] ❌ Failed to reopen journal %s, dropping entry: %v", r.path, err)
+			return
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	if err != nil {
+		log.Printf("[Repository] ⚠ Failed to write journal %s: %v", r.path, err)
+	}
+}
+
+// rotate shifts the rotated files by one, dropping the oldest, and starts a new
+// file; the caller holds r.mu and reopens the current file if rotation fails
+func (r *journalRepository) rotate() error {
+	if err := r.file.Close(); err != nil {
+		log.Printf("[Repository] ⚠ Failed to close journal %s: %v", r.path, err)
+	}
+	r.file = nil
+	if r.maxBackups == 0 {
+		if err := os.Remove(r.path); err != nil {
+			return err
+		}
+		return r.open()
+	}
+	for i := r.maxBackups - 1; i >= 1; i-- {
+		older := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(older, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	log.Printf("[Repository] Journal rotated to %s.1", r.path)
+	return r.open()
+}
+
+// Close closes the journal file
+func (r *journalRepository) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+func (nopJournalRepository) Record(*model.JournalEntry) {}
+func (nopJournalRepository) Close() error               { return nil }
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// journalEntry returns an entry whose JSON line has the same length for sequences 1 to 9
+func journalEntry(sequence int) *model.JournalEntry {
+	message := &model.Message{ID: "id", Nonce: "n", Type: model.PingMessage, Sequence: sequence, From: "server1", Timestamp: time.Unix(1760000000, 0).UTC()}
+	event := model.NewEvent(model.EventReceived, "server2", "webtransport", "server1 -> server2", message, time.Millisecond)
+	event.Time = message.Timestamp
+	return model.NewJournalEntry(event, "", nil, "")
+}
+
+// journalLineSize returns the size of one journal line
+func journalLineSize(t *testing.T) int64 {
+	t.Helper()
+	data, err := json.Marshal(journalEntry(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(data) + 1)
+}
+
+// journalSequences returns the sequence numbers recorded in a journal file, nil if it does not exist
+func journalSequences(t *testing.T, path string) []int {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sequences := []int{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		var entry model.JournalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		sequences = append(sequences, entry.Message.Sequence)
+	}
+	return sequences
+}
+
+func TestJournalRotation(t *testing.T) {
+	line := journalLineSize(t)
+	tests := []struct {
+		name       string
+		maxBytes   int64
+		maxBackups int
+		entries    int
+		want       map[string][]int // Sequences per file suffix ("" for the journal itself)
+	}{
+		{
+			name: "below the threshold", maxBytes: 3 * line, maxBackups: 2, entries: 3,
+			want: map[string][]int{"": {1, 2, 3}, ".1": nil},
+		},
+		{
+			name: "rotated at the threshold", maxBytes: 3 * line, maxBackups: 2, entries: 4,
+			want: map[string][]int{"": {4}, ".1": {1, 2, 3}, ".2": nil},
+		},
+		{
+			name: "oldest backups trimmed", maxBytes: 2 * line, maxBackups: 2, entries: 9,
+			want: map[string][]int{"": {9}, ".1": {7, 8}, ".2": {5, 6}, ".3": nil},
+		},
+		{
+			name: "entry larger than the threshold", maxBytes: line / 2, maxBackups: 1, entries: 3,
+			want: map[string][]int{"": {3}, ".1": {2}, ".2": nil},
+		},
+		{
+			name: "no backups", maxBytes: 2 * line, maxBackups: 0, entries: 5,
+			want: map[string][]int{"": {5}, ".1": nil},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "journal", "server1.jsonl")
+			r, err := NewJournalRepository(path, tt.maxBytes, tt.maxBackups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= tt.entries; i++ {
+				r.Record(journalEntry(i))
+			}
+			if err := r.Close(); err != nil {
+				t.Fatal(err)
+			}
+			for suffix, want := range tt.want {
+				if got := journalSequences(t, path+suffix); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s holds %v, want %v", filepath.Base(path+suffix), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestJournalRotationFailure(t *testing.T) {
+	line := journalLineSize(t)
+	path := filepath.Join(t.TempDir(), "server1.jsonl")
+	// A directory in the way of the backup makes the rotation fail
+	if err := os.MkdirAll(filepath.Join(path+".1", "blocked"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewJournalRepository(path, 2*line, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j := r.(*journalRepository)
+	for i := 1; i <= 4; i++ {
+		r.Record(journalEntry(i))
+	}
+	if got := journalSequences(t, path); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Fatalf("after the failed rotation the journal holds %v, want [1 2 3 4]", got)
+	}
+	if !j.retryAt.After(time.Now()) {
+		t.Fatal("failed rotation did not postpone the next attempt")
+	}
+
+	if err := os.RemoveAll(path + ".1"); err != nil {
+		t.Fatal(err)
+	}
+	j.retryAt = time.Time{}
+	r.Record(journalEntry(5))
+	if got := journalSequences(t, path); !reflect.DeepEqual(got, []int{5}) {
+		t.Errorf("after the retried rotation the journal holds %v, want [5]", got)
+	}
+	if got := journalSequences(t, path+".1"); !reflect.DeepEqual(got, []int{1, 2, 3, 4}) {
+		t.Errorf("backup holds %v, want [1 2 3 4]", got)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r.Record(journalEntry(6))
+	if got := journalSequences(t, path); !reflect.DeepEqual(got, []int{5}) {
+		t.Errorf("entry recorded after Close: journal holds %v, want [5]", got)
+	}
+}
+
+func TestJournalPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server1.jsonl")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewJournalRepository(path, 1<<20, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("journal mode = %o, want 600", perm)
+	}
+}
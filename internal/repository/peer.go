@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// peerRepository implements the PeerRepository interface with an in-memory,
+// time-limited cache of hello exchange outcomes. Targets and senders are kept
+// apart: a sender's claimed capabilities never decide how this server echoes.
+type peerRepository struct {
+	mu      sync.RWMutex
+	local   model.Capabilities
+	ttl     time.Duration                      // How long an outcome is trusted
+	peers   map[string]*model.PeerCapabilities // Hellos this server sent, keyed by target URL
+	senders map[string]*model.PeerCapabilities // Hellos this server answered, keyed by sender name
+	state   StateRepository                    // Persists the target cache across restarts
+}
+
+// maxSenders bounds the sender cache: sender names are not authenticated, so hellos
+// with made-up names must not grow it without limit
+const maxSenders = 1024
+
+// NewPeerRepository creates the peer cache, advertising the versions, codecs,
+// compression and message types configured in cfg, with the peers saved in state
+func NewPeerRepository(cfg *config.ServerConfig, state StateRepository) PeerRepository {
+	codecs := []string{"json"}
+	for _, name := range cfg.Encoding.Accept {
+		if !slices.Contains(codecs, name) {
+			codecs = append(codecs, name)
+		}
+	}
+	r := &peerRepository{
+		local: model.Capabilities{
+			Server:      cfg.Name,
+			MinVersion:  model.MinProtocolVersion,
+			MaxVersion:  model.ProtocolVersion,
+			Codecs:      codecs,
+			Compression: slices.Clone(cfg.Compression.Accept),
+			Types:       cfg.Handlers.Types(),
+		},
+		ttl:     cfg.Handshake.TTL.Std(),
+		peers:   make(map[string]*model.PeerCapabilities),
+		senders: make(map[string]*model.PeerCapabilities),
+		state:   state,
+	}
+	saved, err := state.Peers()
+	if err != nil {
+		log.Printf("[Repository] ⚠ Failed to load saved peers: %v", err)
+	}
+	for peer, caps := range saved {
+		switch {
+		case !slices.Contains(cfg.Targets, peer):
+			// Not a target (e.g. a sender saved by an earlier version): drop it
+			if err := state.ForgetPeer(peer); err != nil {
+				log.Printf("[Repository] ⚠ Failed to forget saved peer %s: %v", peer, err)
+			}
+		case time.Since(caps.Updated) < r.ttl:
+			r.peers[peer] = &caps
+		}
+	}
+	if len(r.peers) > 0 {
+		log.Printf("[Repository] Loaded the capabilities of %d saved peer(s)", len(r.peers))
+	}
+	return r
+}
+
+// Local returns the capabilities this server advertises
+func (r *peerRepository) Local() model.Capabilities {
+	return r.local
+}
+
+// Get returns the cached capabilities of a target unless they expired
+func (r *peerRepository) Get(peer string) (*model.PeerCapabilities, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	caps, ok := r.peers[peer]
+	if !ok || time.Since(caps.Updated) >= r.ttl {
+		return nil, false
+	}
+	return caps, true
+}
+
+// Put caches the capabilities of a target
+func (r *peerRepository) Put(peer string, caps *model.PeerCapabilities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.peers[peer] = caps
+	if err := r.state.SavePeer(peer, caps); err != nil {
+		log.Printf("[Repository] ⚠ Failed to save peer %s: %v", peer, err)
+	}
+}
+
+// Forget drops the cached capabilities of a peer
+func (r *peerRepository) Forget(peer string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.peers, peer)
+	if err := r.state.ForgetPeer(peer); err != nil {
+		log.Printf("[Repository] ⚠ Failed to forget saved peer %s: %v", peer, err)
+	}
+}
+
+// PutSender records the capabilities a sender advertised in its hello, in memory
+// only. Expired senders are dropped, and the least recently seen one when the
+// cache is full.
+func (r *peerRepository) PutSender(sender string, caps *model.PeerCapabilities) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.senders, sender)
+	var oldest string
+	for name, cached := range r.senders {
+		if time.Since(cached.Updated) >= r.ttl {
+			delete(r.senders, name)
+		} else if oldest == "" || cached.Updated.Before(r.senders[oldest].Updated) {
+			oldest = name
+		}
+	}
+	if len(r.senders) >= maxSenders {
+		delete(r.senders, oldest)
+	}
+	r.senders[sender] = caps
+}
+
+// Peers returns a copy of the cached target capabilities that did not expire
+func (r *peerRepository) Peers() map[string]model.PeerCapabilities {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.unexpired(r.peers)
+}
+
+// Senders returns a copy of the sender capabilities that did not expire
+func (r *peerRepository) Senders() map[string]model.PeerCapabilities {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.unexpired(r.senders)
+}
+
+// unexpired copies the entries younger than the TTL; the caller holds r.mu
+func (r *peerRepository) unexpired(cache map[string]*model.PeerCapabilities) map[string]model.PeerCapabilities {
+	peers := make(map[string]model.PeerCapabilities, len(cache))
+	for peer, caps := range cache {
+		if time.Since(caps.Updated) < r.ttl {
+			peers[peer] = *caps
+		}
+	}
+	return peers
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/config"
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+func TestPutSenderBounded(t *testing.T) {
+	cfg := config.NewServerConfig()
+	cfg.Handshake.TTL = config.Duration(time.Minute)
+	r := NewPeerRepository(cfg, memoryStateRepository{}).(*peerRepository)
+	seen := func(ago time.Duration) *model.PeerCapabilities {
+		return &model.PeerCapabilities{Updated: time.Now().Add(-ago)}
+	}
+
+	tests := []struct {
+		name        string
+		fill        int           // Senders cached before the hello
+		fillAge     time.Duration // How long ago they were seen
+		sender      string
+		wantSize    int
+		wantEvicted string // Sender expected to be dropped ("" for none)
+	}{
+		{name: "first hello", sender: "server1", wantSize: 1},
+		{name: "same sender again", fill: 1, sender: "sender-0", wantSize: 1},
+		{name: "expired senders pruned", fill: 10, fillAge: 2 * time.Minute, sender: "server1", wantSize: 1, wantEvicted: "sender-0"},
+		{name: "full cache drops the oldest", fill: maxSenders, fillAge: time.Second, sender: "server1", wantSize: maxSenders, wantEvicted: fmt.Sprint("sender-", maxSenders-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r.senders = make(map[string]*model.PeerCapabilities)
+			for i := range tt.fill {
+				// Later senders were seen earlier, so the last one is the oldest
+				r.senders[fmt.Sprint("sender-", i)] = seen(tt.fillAge + time.Duration(i)*time.Millisecond)
+			}
+			r.PutSender(tt.sender, seen(0))
+
+			if len(r.senders) != tt.wantSize {
+				t.Errorf("%d senders cached, want %d", len(r.senders), tt.wantSize)
+			}
+			if _, ok := r.senders[tt.sender]; !ok {
+				t.Errorf("%s was not cached", tt.sender)
+			}
+			if _, ok := r.senders[tt.wantEvicted]; tt.wantEvicted != "" && ok {
+				t.Errorf("%s is still cached", tt.wantEvicted)
+			}
+		})
+	}
+}
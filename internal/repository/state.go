@@ -0,0 +1,309 @@
+package repository
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the state database
+var (
+	bucketMeta   = []byte("meta")   // "sequence" -> big-endian uint64
+	bucketChains = []byte("chains") // Chain key -> JSON model.ChainState
+	bucketPeers  = []byte("peers")  // Peer -> JSON model.PeerCapabilities
+)
+
+// keySequence is the key of the sequence counter in the meta bucket
+var keySequence = []byte("sequence")
+
+// chainFlushInterval is how often chain changes are written to the state file.
+// Chains change on every forwarded message, so their writes (each an fsync) are
+// coalesced in the background instead of delaying the replies.
+const chainFlushInterval = time.Second
+
+// boltStateRepository implements the StateRepository interface with a bbolt database
+type boltStateRepository struct {
+	db      *bolt.DB
+	maxAge  time.Duration // Chains idle for longer are dropped when the database is opened
+	mu      sync.Mutex
+	pending map[string]*model.ChainState // Chain changes not written yet; nil deletes the chain
+	flushMu sync.Mutex                   // Keeps flushes in order
+	stop    chan struct{}                // Closed by Close to stop the background flush
+	stopped chan struct{}                // Closed when the background flush returned
+}
+
+// memoryStateRepository implements the StateRepository interface without persistence
+type memoryStateRepository struct{}
+
+// NewStateRepository opens the state database at path, creating it if needed, and
+// drops chains idle for longer than maxAge. An empty path keeps no state across restarts.
+func NewStateRepository(path string, maxAge time.Duration) (StateRepository, error) {
+	if path == "" {
+		return memoryStateRepository{}, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("create state directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open state file %s: %w", path, err)
+	}
+	r := &boltStateRepository{
+		db:      db,
+		maxAge:  maxAge,
+		pending: make(map[string]*model.ChainState),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketMeta, bucketChains, bucketPeers} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return r.prune(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initialize state file %s: %w", path, err)
+	}
+	go r.flushLoop()
+	return r, nil
+}
+
+// flushLoop writes the pending chain changes every chainFlushInterval until Close
+func (r *boltStateRepository) flushLoop() {
+	defer close(r.stopped)
+	ticker := time.NewTicker(chainFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			if err := r.flush(); err != nil {
+				log.Printf("[Repository] ⚠ Failed to save chains, retrying in %s: %v", chainFlushInterval, err)
+			}
+		}
+	}
+}
+
+// flush writes the pending chain changes in one transaction. Changes that failed
+// to be written stay pending unless a newer change replaced them.
+func (r *boltStateRepository) flush() error {
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+	r.mu.Lock()
+	batch := r.pending
+	r.pending = make(map[string]*model.ChainState)
+	r.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+
+	err := r.db.Update(func(tx *bolt.Tx) error {
+		chains := tx.Bucket(bucketChains)
+		for key, chain := range batch {
+			if chain == nil {
+				if err := chains.Delete([]byte(key)); err != nil {
+					return err
+				}
+				continue
+			}
+			value, err := json.Marshal(chain)
+			if err != nil {
+				return err
+			}
+			if err := chains.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		r.mu.Lock()
+		for key, chain := range batch {
+			if _, newer := r.pending[key]; !newer {
+				r.pending[key] = chain
+			}
+		}
+		r.mu.Unlock()
+	}
+	return err
+}
+
+// prune drops the chains idle for longer than maxAge
+func (r *boltStateRepository) prune(tx *bolt.Tx) error {
+	chains := tx.Bucket(bucketChains)
+	var stale [][]byte
+	err := chains.ForEach(func(key, value []byte) error {
+		var chain model.ChainState
+		if err := json.Unmarshal(value, &chain); err != nil || time.Since(chain.Updated) > r.maxAge {
+			stale = append(stale, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range stale {
+		if err := chains.Delete(key); err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		log.Printf("[Repository] Dropped %d chain(s) idle for more than %s from the state file", len(stale), r.maxAge)
+	}
+	return nil
+}
+
+// Persistent reports that state survives restarts
+func (r *boltStateRepository) Persistent() bool {
+	return true
+}
+
+// Sequence returns the last saved sequence number
+func (r *boltStateRepository) Sequence() (int, error) {
+	var sequence int
+	err := r.db.View(func(tx *bolt.Tx) error {
+		if value := tx.Bucket(bucketMeta).Get(keySequence); len(value) == 8 {
+			sequence = int(binary.BigEndian.Uint64(value))
+		}
+		return nil
+	})
+	return sequence, err
+}
+
+// SaveSequence persists the sequence number
+func (r *boltStateRepository) SaveSequence(sequence int) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketMeta).Put(keySequence, binary.BigEndian.AppendUint64(nil, uint64(sequence)))
+	})
+}
+
+// Chains returns the saved chains, writing the pending changes first
+func (r *boltStateRepository) Chains() ([]model.ChainState, error) {
+	if err := r.flush(); err != nil {
+		return nil, fmt.Errorf("save pending chains: %w", err)
+	}
+	var chains []model.ChainState
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketChains).ForEach(func(key, value []byte) error {
+			var chain model.ChainState
+			if err := json.Unmarshal(value, &chain); err != nil {
+				return fmt.Errorf("chain %s: %w", key, err)
+			}
+			chains = append(chains, chain)
+			return nil
+		})
+	})
+	return chains, err
+}
+
+// SaveChain records the last step of a chain; it is written by the next flush
+func (r *boltStateRepository) SaveChain(chain model.ChainState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[chain.Key] = &chain
+	return nil
+}
+
+// StopChain marks a chain stopped so it is not resumed; it is written by the next flush
+func (r *boltStateRepository) StopChain(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	chain := model.ChainState{Key: key}
+	if pending, ok := r.pending[key]; ok {
+		if pending != nil {
+			chain = *pending
+		}
+	} else {
+		err := r.db.View(func(tx *bolt.Tx) error {
+			if value := tx.Bucket(bucketChains).Get([]byte(key)); value != nil {
+				return json.Unmarshal(value, &chain)
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("chain %s: %w", key, err)
+		}
+	}
+	chain.Stopped, chain.Updated = true, time.Now()
+	r.pending[key] = &chain
+	return nil
+}
+
+// EndChain forgets a chain that ended on this server; it is deleted by the next flush
+func (r *boltStateRepository) EndChain(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[key] = nil
+	return nil
+}
+
+// Peers returns the saved peer capabilities
+func (r *boltStateRepository) Peers() (map[string]model.PeerCapabilities, error) {
+	peers := make(map[string]model.PeerCapabilities)
+	err := r.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPeers).ForEach(func(key, value []byte) error {
+			var caps model.PeerCapabilities
+			if err := json.Unmarshal(value, &caps); err != nil {
+				return fmt.Errorf("peer %s: %w", key, err)
+			}
+			peers[string(key)] = caps
+			return nil
+		})
+	})
+	return peers, err
+}
+
+// SavePeer persists the capabilities negotiated with a peer
+func (r *boltStateRepository) SavePeer(peer string, caps *model.PeerCapabilities) error {
+	return r.put(bucketPeers, peer, caps)
+}
+
+// ForgetPeer drops the capabilities of a peer
+func (r *boltStateRepository) ForgetPeer(peer string) error {
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketPeers).Delete([]byte(peer))
+	})
+}
+
+// Close writes the pending chain changes and closes the database
+func (r *boltStateRepository) Close() error {
+	close(r.stop)
+	<-r.stopped
+	return errors.Join(r.flush(), r.db.Close())
+}
+
+// put stores a JSON value in a bucket
+func (r *boltStateRepository) put(bucket []byte, key string, v any) error {
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), value)
+	})
+}
+
+func (memoryStateRepository) Persistent() bool                                  { return false }
+func (memoryStateRepository) Sequence() (int, error)                            { return 0, nil }
+func (memoryStateRepository) SaveSequence(int) error                            { return nil }
+func (memoryStateRepository) Chains() ([]model.ChainState, error)               { return nil, nil }
+func (memoryStateRepository) SaveChain(model.ChainState) error                  { return nil }
+func (memoryStateRepository) StopChain(string) error                            { return nil }
+func (memoryStateRepository) EndChain(string) error                             { return nil }
+func (memoryStateRepository) Peers() (map[string]model.PeerCapabilities, error) { return nil, nil }
+func (memoryStateRepository) SavePeer(string, *model.PeerCapabilities) error    { return nil }
+func (memoryStateRepository) ForgetPeer(string) error                           { return nil }
+func (memoryStateRepository) Close() error                                      { return nil }
@@ -1,56 +1,172 @@
 package internal
 
 import (
+	"crypto/tls"
+	"errors"
 	"log"
 	"net/http"
-	"time"
+	"net/http/pprof"
+	"sync"
 
 	"github.com/quic-go/webtransport-go"
+	"github.com/ryo-arima/magic-cylinder/internal/auth"
+	"github.com/ryo-arima/magic-cylinder/internal/config"
 	"github.com/ryo-arima/magic-cylinder/internal/controller"
+	"github.com/ryo-arima/magic-cylinder/internal/cors"
+	"github.com/ryo-arima/magic-cylinder/internal/handler"
 	"github.com/ryo-arima/magic-cylinder/internal/repository"
+	"github.com/ryo-arima/magic-cylinder/internal/signing"
+	"github.com/ryo-arima/magic-cylinder/internal/transport"
 )
 
 // Router handles routing and dependency injection
 type Router struct {
-	commonController controller.CommonController
-	commonRepository repository.CommonRepository
-	targetURL        string
+	commonController    controller.CommonController
+	dashboardController controller.DashboardController
+	healthController    controller.HealthController
+	adminController     controller.AdminController
+	commonRepository    repository.CommonRepository
+	healthRepository    repository.HealthRepository
+	stateRepository     repository.StateRepository
+	journalRepository   repository.JournalRepository
+	origins             *cors.Policy        // Browser origins allowed on /webtransport and /plain
+	authn               *auth.Authenticator // Checks credentials on /dashboard and /events (nil disables)
+	targetURLs          []string
+	targetsMu           sync.RWMutex // Guards targetURLs, which are replaced on config reload
 }
 
 // NewRouter creates a new router with injected dependencies
 func NewRouter(
 	commonController controller.CommonController,
+	dashboardController controller.DashboardController,
+	healthController controller.HealthController,
+	adminController controller.AdminController,
 	commonRepository repository.CommonRepository,
-	targetURL string,
+	healthRepository repository.HealthRepository,
+	stateRepository repository.StateRepository,
+	journalRepository repository.JournalRepository,
+	origins *cors.Policy,
+	authn *auth.Authenticator,
+	targetURLs []string,
 ) *Router {
 	return &Router{
-		commonController: commonController,
-		commonRepository: commonRepository,
-		targetURL:        targetURL,
+		commonController:    commonController,
+		dashboardController: dashboardController,
+		healthController:    healthController,
+		adminController:     adminController,
+		commonRepository:    commonRepository,
+		healthRepository:    healthRepository,
+		stateRepository:     stateRepository,
+		journalRepository:   journalRepository,
+		origins:             origins,
+		authn:               authn,
+		targetURLs:          targetURLs,
 	}
 }
 
-// SetupRoutes initializes routes and handlers
-func (r *Router) SetupRoutes(server *webtransport.Server) {
+// Targets returns the current echo target URLs
+func (r *Router) Targets() []string {
+	r.targetsMu.RLock()
+	defer r.targetsMu.RUnlock()
+	return r.targetURLs
+}
+
+// ResumeChains continues the chains saved before a restart
+func (r *Router) ResumeChains() {
+	r.commonController.ResumeChains(r.Targets())
+}
+
+// Close saves the sequence number and releases the state file and the journal
+func (r *Router) Close() error {
+	return errors.Join(r.commonRepository.FlushSequence(), r.stateRepository.Close(), r.journalRepository.Close())
+}
+
+// SetOrigins replaces the allowed browser origins
+func (r *Router) SetOrigins(origins []string) {
+	r.origins.SetOrigins(origins)
+}
+
+// SetTargets replaces the echo target URLs; streams already being echoed keep their targets
+func (r *Router) SetTargets(targetURLs []string) {
+	r.targetsMu.Lock()
+	defer r.targetsMu.Unlock()
+	r.targetURLs = targetURLs
+}
+
+// SetupRoutes initializes routes and handlers on a dedicated mux for the public listeners.
+// http.DefaultServeMux is deliberately not used so debug handlers never leak onto this port.
+func (r *Router) SetupRoutes(server *webtransport.Server) *http.ServeMux {
 	log.Printf("[Router] Setting up routes...")
+	mux := http.NewServeMux()
 
 	log.Printf("[Router] Registering /webtransport endpoint")
-	http.HandleFunc("/webtransport", r.handleWebTransport(server))
+	mux.HandleFunc("/webtransport", r.handleWebTransport(server))
 
-	log.Printf("[Router] Registering /plain endpoint (plaintext mode)")
-	http.HandleFunc("/plain", r.handlePlain)
+	log.Printf("[Router] Registering /plain endpoint (plaintext mode, CORS for %v)", r.origins.Origins())
+	mux.Handle("/plain", r.origins.Wrap(http.HandlerFunc(r.handlePlain)))
 
 	log.Printf("[Router] Registering /health endpoint")
-	http.HandleFunc("/health", r.handleHealth)
+	mux.HandleFunc("/health", r.handleHealth)
+
+	log.Printf("[Router] Registering /livez and /readyz endpoints")
+	mux.HandleFunc("/livez", r.handleLivez)
+	mux.HandleFunc("/readyz", r.handleReadyz)
+
+	log.Printf("[Router] Registering /dashboard and /events endpoints")
+	mux.Handle("/dashboard", r.authenticated(r.dashboardController.HandleDashboard))
+	mux.Handle("/dashboard/", r.authenticated(r.dashboardController.HandleDashboard))
+	mux.Handle("/events", r.authenticated(r.handleEvents))
 
 	log.Printf("[Router] All routes registered successfully")
+	return mux
+}
+
+// SetupAdminRoutes initializes the diagnostics routes served only on the admin listener
+func (r *Router) SetupAdminRoutes() *http.ServeMux {
+	log.Printf("[Router] Setting up admin routes...")
+	mux := http.NewServeMux()
+
+	log.Printf("[Router] Registering /debug/pprof/ endpoints")
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	log.Printf("[Router] Registering /debug/goroutines and /debug/runtime endpoints")
+	mux.HandleFunc("/debug/goroutines", r.adminController.HandleGoroutines)
+	mux.HandleFunc("/debug/runtime", r.adminController.HandleRuntime)
+
+	log.Printf("[Router] Admin routes registered successfully")
+	return mux
+}
+
+// authenticated requires the credentials of auth.mode before calling next. The
+// dashboard and the event feed show every message, so they are protected like
+// /webtransport and /plain.
+func (r *Router) authenticated(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.authn.Verify(req, nil); err != nil {
+			log.Printf("[Router] ❌ Rejecting %s request from %s: %v", req.URL.Path, req.RemoteAddr, err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	})
 }
 
 // handleWebTransport handles WebTransport connections
 func (r *Router) handleWebTransport(server *webtransport.Server) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		log.Printf("[Router] WebTransport request received from %s", req.RemoteAddr)
-		r.commonController.HandleWebTransport(server, w, req, r.targetURL)
+		// Checked here as well as in webtransport.Server.CheckOrigin so the
+		// browser gets a 403 instead of a failed upgrade
+		if !r.origins.CheckOrigin(req) {
+			log.Printf("[Router] ❌ Rejecting WebTransport session from origin %s (%s)", req.Header.Get("Origin"), req.RemoteAddr)
+			http.Error(w, "origin not allowed", http.StatusForbidden)
+			return
+		}
+		r.commonController.HandleWebTransport(server, w, req, r.Targets())
 	}
 }
 
@@ -61,7 +177,16 @@ func (r *Router) handlePlain(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 	log.Printf("[Router] Plaintext request received from %s", req.RemoteAddr)
-	r.commonController.HandlePlain(w, req, r.targetURL)
+	r.commonController.HandlePlain(w, req, r.Targets())
+}
+
+// handleEvents streams the live event feed to dashboard subscribers
+func (r *Router) handleEvents(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	r.dashboardController.HandleEvents(w, req)
 }
 
 // handleHealth handles health check requests
@@ -71,14 +196,43 @@ func (r *Router) handleHealth(w http.ResponseWriter, req *http.Request) {
 	w.Write([]byte("OK"))
 }
 
+// handleLivez handles liveness checks (local listeners, certificate and sessions)
+func (r *Router) handleLivez(w http.ResponseWriter, req *http.Request) {
+	r.healthController.HandleLivez(w, req)
+}
+
+// handleReadyz handles readiness checks including reachability of the configured targets
+func (r *Router) handleReadyz(w http.ResponseWriter, req *http.Request) {
+	log.Printf("[Router] Readiness check request received from %s", req.RemoteAddr)
+	r.healthController.HandleReadyz(w, req, r.Targets())
+}
+
 // InitializeDependencies creates and returns all required dependencies
-func InitializeDependencies(targetURL string, delaySeconds int) *Router {
-	log.Printf("[Router] Initializing dependencies with target URL: %s", targetURL)
-	if delaySeconds < 0 {
-		delaySeconds = 0
+func InitializeDependencies(cfg *config.ServerConfig, debug *transport.Debug, clientTLS *tls.Config, authn *auth.Authenticator, signer *signing.Signer, verifier *signing.Verifier) *Router {
+	log.Printf("[Router] Initializing dependencies with target URLs: %v", cfg.Targets)
+	stateRepo, err := repository.NewStateRepository(cfg.State.Path, cfg.State.ResumeWindow.Std())
+	if err != nil {
+		log.Fatalf("[Router] ❌ Failed to open the state file: %v", err)
+	}
+	journalRepo, err := repository.NewJournalRepository(cfg.Journal.Path, cfg.Journal.MaxBytes, cfg.Journal.MaxBackups)
+	if err != nil {
+		log.Fatalf("[Router] ❌ Failed to open the journal: %v", err)
+	}
+	peerRepo := repository.NewPeerRepository(cfg, stateRepo)
+	commonRepo := repository.NewCommonRepository(cfg, debug, clientTLS, authn, signer, peerRepo, stateRepo)
+	eventRepo := repository.NewEventRepository(cfg.Limits.EventHistory)
+	dedupeRepo := repository.NewDedupeRepository(cfg.Dedupe.Window.Std(), cfg.Dedupe.MaxEntries)
+	healthRepo := repository.NewHealthRepository(cfg.Transport.ProbeTimeout.Std(), clientTLS, authn)
+	handlers, err := handler.NewBuiltinRegistry(cfg, commonRepo, healthRepo, dedupeRepo, peerRepo)
+	if err != nil {
+		log.Fatalf("[Router] ❌ Failed to register message handlers: %v", err)
 	}
-	commonRepo := repository.NewCommonRepository(time.Duration(delaySeconds) * time.Second)
-	commonController := controller.NewCommonController(commonRepo)
+	log.Printf("[Router] Message handlers: %v", handlers.Types())
+	commonController := controller.NewCommonController(commonRepo, eventRepo, healthRepo, dedupeRepo, stateRepo, journalRepo, handlers, cfg, authn, verifier)
+	dashboardController := controller.NewDashboardController(eventRepo)
+	healthController := controller.NewHealthController(healthRepo, cfg)
+	adminController := controller.NewAdminController(healthRepo, peerRepo, cfg.Name)
+	origins := cors.New(cfg.CORS.AllowedOrigins, cfg.CORS.MaxAge.Std())
 	log.Printf("[Router] Dependencies initialized successfully")
-	return NewRouter(commonController, commonRepo, targetURL)
+	return NewRouter(commonController, dashboardController, healthController, adminController, commonRepo, healthRepo, stateRepo, journalRepo, origins, authn, cfg.Targets)
 }
@@ -0,0 +1,222 @@
+// Package signing signs and verifies messages with Ed25519 so tampering by any
+// hop of a chain is detected, independently of the transport and its TLS setup.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+// Verification policies (signing.policy)
+const (
+	// PolicyOff skips verification
+	PolicyOff = "off"
+	// PolicyFlag verifies and flags problems but still processes the message
+	PolicyFlag = "flag"
+	// PolicyReject rejects unsigned, unknown or tampered messages
+	PolicyReject = "reject"
+)
+
+// Verification results
+var (
+	// ErrUnsigned is returned for messages without a signature
+	ErrUnsigned = errors.New("message is not signed")
+	// ErrUnknownPeer is returned when no public key is configured for the sender
+	ErrUnknownPeer = errors.New("no public key for sender")
+	// ErrInvalidSignature is returned when the signature does not match the message
+	ErrInvalidSignature = errors.New("invalid signature (message tampered or signed by another key)")
+)
+
+// Signer signs emitted messages. A nil *Signer leaves messages unsigned.
+type Signer struct {
+	key ed25519.PrivateKey
+}
+
+// NewSigner loads the private key; an empty path returns nil (signing disabled)
+func NewSigner(keyFile string) (*Signer, error) {
+	if keyFile == "" {
+		return nil, nil
+	}
+	key, err := LoadPrivateKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{key: key}, nil
+}
+
+// Sign sets the message signature over its canonical encoding.
+// It must be called after the last change to a signed field.
+func (s *Signer) Sign(m *model.Message) {
+	if s == nil {
+		return
+	}
+	m.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(s.key, m.SigningBytes()))
+}
+
+// PublicKey returns the public key matching the signing key
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.key.Public().(ed25519.PublicKey)
+}
+
+// Verifier checks signatures of received messages against known peer keys.
+// A nil *Verifier accepts every message (policy off).
+type Verifier struct {
+	policy string
+	peers  map[string]ed25519.PublicKey
+}
+
+// NewVerifier parses the peer keys (sender name to base64 key or .pub file).
+// It returns nil for PolicyOff.
+func NewVerifier(policy string, peers map[string]string) (*Verifier, error) {
+	switch policy {
+	case PolicyOff, "":
+		return nil, nil
+	case PolicyFlag, PolicyReject:
+	default:
+		return nil, fmt.Errorf("unknown signing policy %q", policy)
+	}
+	v := &Verifier{policy: policy, peers: make(map[string]ed25519.PublicKey, len(peers))}
+	for name, value := range peers {
+		key, err := ParsePublicKey(value)
+		if err != nil {
+			return nil, fmt.Errorf("peer %s: %w", name, err)
+		}
+		v.peers[name] = key
+	}
+	return v, nil
+}
+
+// Policy returns the verification policy
+func (v *Verifier) Policy() string {
+	if v == nil {
+		return PolicyOff
+	}
+	return v.policy
+}
+
+// Verify checks the message signature against the key of its sender.
+// The returned error is one of ErrUnsigned, ErrUnknownPeer or ErrInvalidSignature.
+func (v *Verifier) Verify(m *model.Message) error {
+	if v == nil {
+		return nil
+	}
+	if m.Signature == "" {
+		return ErrUnsigned
+	}
+	key, ok := v.peers[m.From]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownPeer, m.From)
+	}
+	signature, err := base64.StdEncoding.DecodeString(m.Signature)
+	if err != nil || !ed25519.Verify(key, m.SigningBytes(), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Rejects reports whether a verification error must reject the message (as opposed to flagging it)
+func (v *Verifier) Rejects(err error) bool {
+	return v != nil && err != nil && v.policy == PolicyReject
+}
+
+// Status returns the short signature status recorded on events
+func Status(err error) string {
+	switch {
+	case err == nil:
+		return "verified"
+	case errors.Is(err, ErrUnsigned):
+		return "unsigned"
+	case errors.Is(err, ErrUnknownPeer):
+		return "unknown_peer"
+	default:
+		return "invalid"
+	}
+}
+
+// GenerateKey creates an Ed25519 key pair and writes <dir>/<name>.key (private,
+// owner-readable only) and <dir>/<name>.pub
+func GenerateKey(dir, name string) (ed25519.PublicKey, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	privatePEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".key"), privatePEM, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write private key: %w", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+	if err := os.WriteFile(filepath.Join(dir, name+".pub"), publicPEM, 0o644); err != nil {
+		return nil, fmt.Errorf("failed to write public key: %w", err)
+	}
+	return public, nil
+}
+
+// LoadPrivateKey reads a PEM PKCS#8 Ed25519 private key
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: no PEM private key found", path)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", path)
+	}
+	return key, nil
+}
+
+// ParsePublicKey accepts a base64 raw 32-byte key or the path of a PEM .pub file
+func ParsePublicKey(value string) (ed25519.PublicKey, error) {
+	if raw, err := base64.StdEncoding.DecodeString(value); err == nil && len(raw) == ed25519.PublicKeySize {
+		return ed25519.PublicKey(raw), nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return nil, fmt.Errorf("not a base64 Ed25519 key and not a readable file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s: no PEM public key found", value)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", value, err)
+	}
+	key, ok := parsed.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an Ed25519 key", value)
+	}
+	return key, nil
+}
+
+// EncodePublicKey returns the base64 form accepted in signing.peers
+func EncodePublicKey(key ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
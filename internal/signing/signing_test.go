@@ -0,0 +1,122 @@
+package signing
+
+import (
+	"encoding/base64"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/entity/model"
+)
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	public1, err := GenerateKey(dir, "server1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateKey(dir, "server2"); err != nil {
+		t.Fatal(err)
+	}
+	signer1, err := NewSigner(filepath.Join(dir, "server1.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer2, err := NewSigner(filepath.Join(dir, "server2.key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// One key given inline, the other as a .pub file
+	verifier, err := NewVerifier(PolicyReject, map[string]string{
+		"server1": base64.StdEncoding.EncodeToString(public1),
+		"server2": filepath.Join(dir, "server2.pub"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		signer *Signer
+		tamper func(m *model.Message) // Applied after signing
+		want   error
+	}{
+		{name: "signed by the sender", signer: signer1},
+		{name: "signed by another peer", signer: signer2, want: ErrInvalidSignature},
+		{name: "content changed", signer: signer1, tamper: func(m *model.Message) { m.Content += "!" }, want: ErrInvalidSignature},
+		{name: "type changed", signer: signer1, tamper: func(m *model.Message) { m.Type = model.StopMessage }, want: ErrInvalidSignature},
+		{name: "id changed", signer: signer1, tamper: func(m *model.Message) { m.ID = "other" }, want: ErrInvalidSignature},
+		{name: "nonce changed", signer: signer1, tamper: func(m *model.Message) { m.Nonce = "other" }, want: ErrInvalidSignature},
+		{name: "timestamp changed", signer: signer1, tamper: func(m *model.Message) { m.Timestamp = m.Timestamp.Add(time.Nanosecond) }, want: ErrInvalidSignature},
+		{name: "sequence changed", signer: signer1, tamper: func(m *model.Message) { m.Sequence++ }, want: ErrInvalidSignature},
+		{name: "recipient changed", signer: signer1, tamper: func(m *model.Message) { m.To = "server3" }, want: ErrInvalidSignature},
+		{name: "chain changed", signer: signer1, tamper: func(m *model.Message) { m.Chain = "other" }, want: ErrInvalidSignature},
+		{name: "hop changed", signer: signer1, tamper: func(m *model.Message) { m.Hop++ }, want: ErrInvalidSignature},
+		{name: "sender changed to another peer", signer: signer1, tamper: func(m *model.Message) { m.From = "server2" }, want: ErrInvalidSignature},
+		{name: "sender changed to an unknown peer", signer: signer1, tamper: func(m *model.Message) { m.From = "mallory" }, want: ErrUnknownPeer},
+		{name: "signature not base64", signer: signer1, tamper: func(m *model.Message) { m.Signature = "%%%" }, want: ErrInvalidSignature},
+		{name: "signature truncated", signer: signer1, tamper: func(m *model.Message) { m.Signature = m.Signature[:20] }, want: ErrInvalidSignature},
+		{name: "signature removed", signer: signer1, tamper: func(m *model.Message) { m.Signature = "" }, want: ErrUnsigned},
+		{name: "not signed", signer: nil, want: ErrUnsigned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := model.NewMessage(model.PongMessage, "Pong response to: hello", 7, "server1", "server2")
+			m.Chain, m.Hop = "3c7d", 2
+			tt.signer.Sign(m)
+			if tt.tamper != nil {
+				tt.tamper(m)
+			}
+
+			err := verifier.Verify(m)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+			if !verifier.Rejects(err) {
+				t.Errorf("Rejects(%v) = false under the reject policy", err)
+			}
+		})
+	}
+}
+
+func TestVerifierPolicies(t *testing.T) {
+	unsigned := model.NewMessage(model.PingMessage, "hello", 1, "client", "server1")
+	tests := []struct {
+		policy      string
+		wantNil     bool // The verifier is disabled
+		wantRejects bool
+	}{
+		{policy: PolicyOff, wantNil: true},
+		{policy: "", wantNil: true},
+		{policy: PolicyFlag},
+		{policy: PolicyReject, wantRejects: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			v, err := NewVerifier(tt.policy, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (v == nil) != tt.wantNil {
+				t.Fatalf("NewVerifier(%q) = %v, want nil %t", tt.policy, v, tt.wantNil)
+			}
+			err = v.Verify(unsigned)
+			if tt.wantNil != (err == nil) {
+				t.Fatalf("Verify() = %v", err)
+			}
+			if got := v.Rejects(err); got != tt.wantRejects {
+				t.Errorf("Rejects() = %t, want %t", got, tt.wantRejects)
+			}
+		})
+	}
+	if _, err := NewVerifier("strict", nil); err == nil {
+		t.Error("NewVerifier accepted an unknown policy")
+	}
+}
@@ -0,0 +1,57 @@
+package transport
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"sync/atomic"
+)
+
+// CertificateStore holds the serving key pair. It is plugged into
+// tls.Config.GetCertificate (and GetClientCertificate for mutual TLS) so a
+// reloaded pair applies to new handshakes while established connections keep
+// the certificate they negotiated.
+type CertificateStore struct {
+	current atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateStore loads the initial key pair
+func NewCertificateStore(certFile, keyFile string) (*CertificateStore, error) {
+	store := &CertificateStore{}
+	if _, err := store.Load(certFile, keyFile); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// Load reads a key pair and makes it the serving certificate.
+// On error the previous certificate stays in place.
+func (s *CertificateStore) Load(certFile, keyFile string) (*x509.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, fmt.Errorf("failed to parse TLS certificate: %w", err)
+		}
+	}
+	s.current.Store(&cert)
+	return cert.Leaf, nil
+}
+
+// Leaf returns the parsed serving certificate
+func (s *CertificateStore) Leaf() *x509.Certificate {
+	return s.current.Load().Leaf
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (s *CertificateStore) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return s.current.Load(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate, presenting
+// the same key pair when a peer requests a client certificate (mutual TLS)
+func (s *CertificateStore) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return s.current.Load(), nil
+}
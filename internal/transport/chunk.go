@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+)
+
+// Attachments follow their message frame on the same stream as a sequence of
+// chunk frames. A chunk payload is the CRC-32C of its data followed by the data,
+// so a corrupted chunk is detected before it is passed on; the SHA-256 of the
+// whole attachment is announced in the message and checked at the end.
+const chunkChecksumSize = 4
+
+// castagnoli is the CRC-32C table used for chunk checksums
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrChecksum is returned (wrapped) when a chunk or a whole attachment does not match its checksum
+var ErrChecksum = errors.New("checksum mismatch")
+
+// ChunkWriter splits the data written to it into checksummed chunk frames
+type ChunkWriter struct {
+	w    io.Writer
+	size int    // Data bytes per chunk
+	buf  []byte // Checksum placeholder followed by the data of the pending chunk
+}
+
+// NewChunkWriter creates a writer emitting chunks of size data bytes to w
+func NewChunkWriter(w io.Writer, size int) *ChunkWriter {
+	return &ChunkWriter{w: w, size: size, buf: make([]byte, chunkChecksumSize, chunkChecksumSize+size)}
+}
+
+// Write buffers p and writes every chunk it completes
+func (cw *ChunkWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkChecksumSize+cw.size-len(cw.buf))
+		cw.buf = append(cw.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(cw.buf) == chunkChecksumSize+cw.size {
+			if err := cw.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last, partial chunk; it does not close the underlying writer
+func (cw *ChunkWriter) Close() error {
+	if len(cw.buf) == chunkChecksumSize {
+		return nil
+	}
+	return cw.flush()
+}
+
+// flush writes the pending chunk
+func (cw *ChunkWriter) flush() error {
+	binary.BigEndian.PutUint32(cw.buf, crc32.Checksum(cw.buf[chunkChecksumSize:], castagnoli))
+	err := WriteFrame(cw.w, cw.buf)
+	cw.buf = cw.buf[:chunkChecksumSize]
+	return err
+}
+
+// ChunkReader reads an attachment of a known size from chunk frames, returning
+// only data whose chunk checksum matched
+type ChunkReader struct {
+	r         io.Reader
+	remaining int64 // Attachment bytes not read from r yet
+	maxChunk  int   // Largest accepted chunk data
+	chunks    int   // Chunks read so far
+	pending   []byte
+	sum       hash.Hash
+}
+
+// NewChunkReader creates a reader of an attachment of size bytes in chunks of at most maxChunk bytes
+func NewChunkReader(r io.Reader, size int64, maxChunk int) *ChunkReader {
+	return &ChunkReader{r: r, remaining: size, maxChunk: maxChunk, sum: sha256.New()}
+}
+
+// Read returns verified attachment data, then io.EOF once size bytes were read
+func (cr *ChunkReader) Read(p []byte) (int, error) {
+	if len(cr.pending) == 0 {
+		if cr.remaining == 0 {
+			return 0, io.EOF
+		}
+		frame, err := ReadFrame(cr.r, chunkChecksumSize+cr.maxChunk)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, fmt.Errorf("chunk %d (%d bytes missing): %w", cr.chunks, cr.remaining, err)
+		}
+		if len(frame) <= chunkChecksumSize {
+			return 0, fmt.Errorf("chunk %d is empty", cr.chunks)
+		}
+		data := frame[chunkChecksumSize:]
+		if crc32.Checksum(data, castagnoli) != binary.BigEndian.Uint32(frame) {
+			return 0, fmt.Errorf("%w in chunk %d", ErrChecksum, cr.chunks)
+		}
+		if int64(len(data)) > cr.remaining {
+			return 0, fmt.Errorf("chunk %d overruns the attachment by %d bytes", cr.chunks, int64(len(data))-cr.remaining)
+		}
+		cr.sum.Write(data)
+		cr.remaining -= int64(len(data))
+		cr.chunks++
+		cr.pending = data
+	}
+	n := copy(p, cr.pending)
+	cr.pending = cr.pending[n:]
+	return n, nil
+}
+
+// Chunks returns the number of chunks read so far
+func (cr *ChunkReader) Chunks() int {
+	return cr.chunks
+}
+
+// Verify checks the SHA-256 (hex) of the whole attachment once it was read
+func (cr *ChunkReader) Verify(sha256Hex string) error {
+	if cr.remaining > 0 {
+		return fmt.Errorf("attachment incomplete: %d bytes missing", cr.remaining)
+	}
+	if got := hex.EncodeToString(cr.sum.Sum(nil)); got != sha256Hex {
+		return fmt.Errorf("%w: attachment sha256 %s, announced %s", ErrChecksum, got, sha256Hex)
+	}
+	return nil
+}
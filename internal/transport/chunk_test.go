@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"testing"
+)
+
+// errAny matches any error in the chunk tests
+var errAny = errors.New("any error")
+
+// chunked encodes data as chunk frames of chunkSize bytes, written writeSize bytes at a time
+func chunked(t *testing.T, data []byte, chunkSize, writeSize int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	cw := NewChunkWriter(&buf, chunkSize)
+	for p := data; len(p) > 0; {
+		n := min(len(p), writeSize)
+		if _, err := cw.Write(p[:n]); err != nil {
+			t.Fatal(err)
+		}
+		p = p[n:]
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestChunkReader(t *testing.T) {
+	const chunkSize = 1024
+	data := make([]byte, 2500)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	dataSHA := hexSHA(data)
+	// Offsets in the encoding of data: frame length, chunk checksum, then chunk data
+	secondChunk := frameHeaderSize + chunkChecksumSize + chunkSize
+
+	tests := []struct {
+		name       string
+		stream     func() []byte // Chunk frames on the stream (the encoding of data unless set)
+		size       int64         // Announced attachment size (len(data) unless set)
+		sha        string        // Announced SHA-256 (of data unless set)
+		maxChunk   int           // chunkSize unless set
+		wantChunks int
+		wantErr    error // From reading the attachment
+		wantVerify error // From Verify after a successful read
+	}{
+		{name: "several chunks", wantChunks: 3},
+		{name: "written in small pieces", stream: func() []byte { return chunked(t, data, chunkSize, 100) }, wantChunks: 3},
+		{name: "exact multiple of the chunk size", stream: func() []byte { return chunked(t, data[:2*chunkSize], chunkSize, len(data)) },
+			size: 2 * chunkSize, sha: hexSHA(data[:2*chunkSize]), wantChunks: 2},
+		{name: "single byte", stream: func() []byte { return chunked(t, data[:1], chunkSize, 1) }, size: 1, sha: hexSHA(data[:1]), wantChunks: 1},
+		{name: "empty attachment", stream: func() []byte { return nil }, size: -1, sha: hexSHA(nil)},
+		{name: "larger accepted chunks", maxChunk: 4 * chunkSize, wantChunks: 3},
+		{
+			name: "corrupted data",
+			stream: func() []byte {
+				b := chunked(t, data, chunkSize, len(data))
+				b[secondChunk+frameHeaderSize+chunkChecksumSize+10] ^= 0x01
+				return b
+			},
+			wantErr: ErrChecksum,
+		},
+		{
+			name: "corrupted chunk checksum",
+			stream: func() []byte {
+				b := chunked(t, data, chunkSize, len(data))
+				b[frameHeaderSize] ^= 0x80
+				return b
+			},
+			wantErr: ErrChecksum,
+		},
+		{
+			name:    "stream cut inside a chunk",
+			stream:  func() []byte { return chunked(t, data, chunkSize, len(data))[:secondChunk+100] },
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "stream cut inside a frame header",
+			stream:  func() []byte { return chunked(t, data, chunkSize, len(data))[:secondChunk+2] },
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "stream ends before the last chunk",
+			stream:  func() []byte { return chunked(t, data, chunkSize, len(data))[:2*secondChunk] },
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "chunk over the accepted size",
+			stream:  func() []byte { return chunked(t, data, 2*chunkSize, len(data)) },
+			wantErr: ErrFrameTooLarge,
+		},
+		{
+			name: "chunk without data",
+			stream: func() []byte {
+				return append(frame(make([]byte, chunkChecksumSize)), chunked(t, data, chunkSize, len(data))...)
+			},
+			wantErr: errAny,
+		},
+		{
+			name:    "chunk overruns the announced size",
+			size:    2000,
+			wantErr: errAny,
+		},
+		{
+			name:       "attachment does not match the announced sha256",
+			sha:        hexSHA([]byte("something else")),
+			wantChunks: 3,
+			wantVerify: ErrChecksum,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := chunked(t, data, chunkSize, len(data))
+			if tt.stream != nil {
+				stream = tt.stream()
+			}
+			size := int64(len(data))
+			switch {
+			case tt.size < 0:
+				size = 0
+			case tt.size > 0:
+				size = tt.size
+			}
+			sha := dataSHA
+			if tt.sha != "" {
+				sha = tt.sha
+			}
+			maxChunk := chunkSize
+			if tt.maxChunk > 0 {
+				maxChunk = tt.maxChunk
+			}
+
+			cr := NewChunkReader(bytes.NewReader(stream), size, maxChunk)
+			got, err := io.ReadAll(cr)
+			if tt.wantErr != nil {
+				if err == nil || (tt.wantErr != errAny && !errors.Is(err, tt.wantErr)) {
+					t.Fatalf("read error = %v, want %v", err, tt.wantErr)
+				}
+				if verr := cr.Verify(sha); verr == nil {
+					t.Error("Verify() accepted an attachment that failed to read")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if int64(len(got)) != size {
+				t.Fatalf("read %d bytes, want %d", len(got), size)
+			}
+			if cr.Chunks() != tt.wantChunks {
+				t.Errorf("Chunks() = %d, want %d", cr.Chunks(), tt.wantChunks)
+			}
+			if err := cr.Verify(sha); !errors.Is(err, tt.wantVerify) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.wantVerify)
+			}
+		})
+	}
+}
+
+// hexSHA returns the hex SHA-256 of data
+func hexSHA(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// frame returns payload as one length-prefixed frame
+func frame(payload []byte) []byte {
+	var buf bytes.Buffer
+	WriteFrame(&buf, payload)
+	return buf.Bytes()
+}
@@ -0,0 +1,134 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/logging"
+	"github.com/quic-go/quic-go/qlog"
+)
+
+// Debug holds the QUIC/TLS debugging outputs shared by listeners and dialers.
+// A nil *Debug is valid and disables all debugging output.
+type Debug struct {
+	keyLogFile string         // Path of the NSS key log file (SSLKEYLOGFILE format)
+	qlogDir    string         // Directory receiving one qlog trace per QUIC connection
+	label      string         // Label appended to qlog file names (e.g. server name)
+	keyLog     io.WriteCloser // Shared key log writer, nil when disabled
+}
+
+// NewDebug opens the key log file (appending) and creates the qlog directory.
+// Empty paths disable the corresponding output.
+func NewDebug(keyLogFile, qlogDir, label string) (*Debug, error) {
+	d := &Debug{
+		keyLogFile: keyLogFile,
+		qlogDir:    qlogDir,
+		label:      label,
+	}
+	if keyLogFile != "" {
+		f, err := os.OpenFile(keyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open key log file: %w", err)
+		}
+		d.keyLog = &syncWriteCloser{w: f}
+		log.Printf("[Transport] ⚠ Writing TLS session keys to %s (anyone with this file can decrypt traffic)", keyLogFile)
+	}
+	if qlogDir != "" {
+		if err := os.MkdirAll(qlogDir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create qlog directory: %w", err)
+		}
+		log.Printf("[Transport] Writing qlog traces to %s", qlogDir)
+	}
+	return d, nil
+}
+
+// ApplyTLS sets the key log writer on the TLS config when key logging is enabled
+func (d *Debug) ApplyTLS(cfg *tls.Config) *tls.Config {
+	if d == nil || d.keyLog == nil || cfg == nil {
+		return cfg
+	}
+	cfg.KeyLogWriter = d.keyLog
+	return cfg
+}
+
+// ApplyQUIC sets the qlog tracer on the QUIC config when qlog output is enabled.
+// The config is cloned so callers can pass shared defaults.
+func (d *Debug) ApplyQUIC(cfg *quic.Config) *quic.Config {
+	if d == nil || d.qlogDir == "" {
+		return cfg
+	}
+	if cfg == nil {
+		cfg = &quic.Config{}
+	} else {
+		cfg = cfg.Clone()
+	}
+	cfg.Tracer = d.newConnectionTracer
+	return cfg
+}
+
+// Close flushes and closes the key log file
+func (d *Debug) Close() error {
+	if d == nil || d.keyLog == nil {
+		return nil
+	}
+	return d.keyLog.Close()
+}
+
+// newConnectionTracer creates a qlog trace file named <time>_<odcid>_<perspective>_<label>.sqlog
+func (d *Debug) newConnectionTracer(_ context.Context, p logging.Perspective, connID quic.ConnectionID) *logging.ConnectionTracer {
+	perspective := "server"
+	if p == logging.PerspectiveClient {
+		perspective = "client"
+	}
+	name := fmt.Sprintf("%s_%s_%s", time.Now().Format("20060102T150405.000"), connID, perspective)
+	if d.label != "" {
+		name += "_" + d.label
+	}
+	path := filepath.Join(d.qlogDir, name+".sqlog")
+	f, err := os.Create(path)
+	if err != nil {
+		log.Printf("[Transport] ❌ Failed to create qlog file %s: %v", path, err)
+		return nil
+	}
+	return qlog.NewConnectionTracer(&bufferedWriteCloser{Writer: bufio.NewWriter(f), closer: f}, p, connID)
+}
+
+// syncWriteCloser serialises writes from concurrent TLS handshakes
+type syncWriteCloser struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+func (s *syncWriteCloser) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+func (s *syncWriteCloser) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Close()
+}
+
+// bufferedWriteCloser flushes the buffer before closing the underlying file
+type bufferedWriteCloser struct {
+	*bufio.Writer
+	closer io.Closer
+}
+
+func (b *bufferedWriteCloser) Close() error {
+	if err := b.Writer.Flush(); err != nil {
+		return err
+	}
+	return b.closer.Close()
+}
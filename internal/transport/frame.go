@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// frameHeaderSize is the length prefix of a frame: a big-endian uint32 payload size
+const frameHeaderSize = 4
+
+// ErrFrameTooLarge is returned (wrapped) when a frame exceeds the allowed size
+var ErrFrameTooLarge = errors.New("frame too large")
+
+// WriteFrame writes the payload as one length-prefixed frame.
+// Messages on WebTransport streams are framed so a reader knows where a
+// message ends without waiting for the peer to close its side of the stream.
+func WriteFrame(w io.Writer, payload []byte) error {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[frameHeaderSize:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads one length-prefixed frame of at most maxSize payload bytes.
+// An oversized frame is rejected from its header, before the payload is read.
+func ReadFrame(r io.Reader, maxSize int) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("truncated frame header: %w", err)
+		}
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if uint64(size) > uint64(maxSize) {
+		return nil, fmt.Errorf("%w: %d bytes (limit %d)", ErrFrameTooLarge, size, maxSize)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("truncated frame (%d bytes announced): %w", size, err)
+	}
+	return payload, nil
+}
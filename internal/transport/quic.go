@@ -0,0 +1,17 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// NewQUICConfig returns the QUIC config shared by listeners and dialers.
+// Zero durations keep the quic-go defaults; datagrams are required by WebTransport.
+func NewQUICConfig(maxIdleTimeout, keepAlivePeriod time.Duration) *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:  maxIdleTimeout,
+		KeepAlivePeriod: keepAlivePeriod,
+		EnableDatagrams: true,
+	}
+}
@@ -0,0 +1,28 @@
+package transport
+
+import "github.com/quic-go/webtransport-go"
+
+// Stream error codes sent with CancelRead/CancelWrite when a stream is rejected or
+// aborted. Servers and echo dialers share this table, and the README documents it.
+const (
+	// StreamErrorUnauthorized rejects a sender that does not match its client certificate
+	StreamErrorUnauthorized webtransport.StreamErrorCode = 0x1
+	// StreamErrorBadSignature rejects an unsigned or tampered message (signing policy reject)
+	StreamErrorBadSignature webtransport.StreamErrorCode = 0x2
+	// StreamErrorRateLimited rejects a message over the per-client or per-chain rate limit
+	StreamErrorRateLimited webtransport.StreamErrorCode = 0x3
+	// StreamErrorTooManyStreams rejects a stream over limits.max_streams_per_session
+	StreamErrorTooManyStreams webtransport.StreamErrorCode = 0x4
+	// StreamErrorReplay rejects a message without ID, with a reused ID or a stale timestamp
+	StreamErrorReplay webtransport.StreamErrorCode = 0x5
+	// StreamErrorFrameTooLarge rejects a frame over limits.max_frame_bytes
+	StreamErrorFrameTooLarge webtransport.StreamErrorCode = 0x6
+	// StreamErrorInvalidMessage rejects a frame that cannot be read or is not a valid message
+	StreamErrorInvalidMessage webtransport.StreamErrorCode = 0x7
+	// StreamErrorUnsupportedType rejects a message whose type has no registered handler
+	StreamErrorUnsupportedType webtransport.StreamErrorCode = 0x8
+	// StreamErrorAttachment rejects an attachment that is truncated or fails its checksums,
+	// stops the sender of a duplicate attachment, and aborts an echoed attachment whose
+	// source failed
+	StreamErrorAttachment webtransport.StreamErrorCode = 0x9
+)
@@ -0,0 +1,177 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ryo-arima/magic-cylinder/internal/certs"
+)
+
+// Client certificate modes of the listener (tls.client_auth)
+const (
+	// ClientAuthNone does not ask for client certificates
+	ClientAuthNone = "none"
+	// ClientAuthRequest verifies a client certificate when one is presented
+	ClientAuthRequest = "request"
+	// ClientAuthRequire rejects handshakes without a valid client certificate
+	ClientAuthRequire = "require"
+)
+
+// ClientTLSOptions selects how peer certificates are verified by dialers
+type ClientTLSOptions struct {
+	CAFile      string            // PEM bundle of trusted CAs (empty uses the system roots)
+	Pins        []string          // SHA-256 fingerprints (hex or base64) of accepted peer certificates
+	Insecure    bool              // Skip all verification; must be opted into explicitly
+	Certificate *CertificateStore // Presented when the peer requests a client certificate (nil for none)
+}
+
+// ServerTLSOptions selects how the listener authenticates clients
+type ServerTLSOptions struct {
+	ClientAuth   string // ClientAuthNone, ClientAuthRequest or ClientAuthRequire
+	ClientCAFile string // PEM bundle of CAs that issue client certificates
+}
+
+// Mode describes the verification mode for log output
+func (o ClientTLSOptions) Mode() string {
+	switch {
+	case o.Insecure:
+		return "insecure (verification disabled)"
+	case len(o.Pins) > 0 && o.CAFile != "":
+		return fmt.Sprintf("CA bundle %s and %d pinned certificate(s)", o.CAFile, len(o.Pins))
+	case len(o.Pins) > 0:
+		return fmt.Sprintf("%d pinned certificate(s)", len(o.Pins))
+	case o.CAFile != "":
+		return "CA bundle " + o.CAFile
+	default:
+		return "system roots"
+	}
+}
+
+// NewClientTLSConfig builds the TLS config shared by all dialers.
+//
+//   - Insecure skips verification entirely.
+//   - With pins only, the peer's leaf certificate must match one of the
+//     fingerprints and be within its validity period; the chain and host name
+//     are not checked, mirroring WebTransport serverCertificateHashes.
+//   - With a CA bundle, the chain and host name are verified against it
+//     (instead of the system roots); pins, if also given, must match as well.
+//
+// Callers must Clone the result before modifying it.
+func NewClientTLSConfig(opts ClientTLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if opts.Certificate != nil {
+		cfg.GetClientCertificate = opts.Certificate.GetClientCertificate
+	}
+	if opts.Insecure {
+		cfg.InsecureSkipVerify = true
+		return cfg, nil
+	}
+
+	if opts.CAFile != "" {
+		pool, err := loadCertPool(opts.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if len(opts.Pins) == 0 {
+		return cfg, nil
+	}
+	pins := make([][sha256.Size]byte, 0, len(opts.Pins))
+	for _, pin := range opts.Pins {
+		sum, err := certs.ParseFingerprint(pin)
+		if err != nil {
+			return nil, err
+		}
+		pins = append(pins, sum)
+	}
+
+	if cfg.RootCAs == nil {
+		// Pin-only: the standard verification would reject self-signed peers,
+		// so it is replaced by the fingerprint check below
+		cfg.InsecureSkipVerify = true
+	}
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		return verifyPinned(rawCerts, pins, time.Now())
+	}
+	return cfg, nil
+}
+
+// NewServerTLSConfig builds the listener TLS config serving the store's key pair.
+// With client authentication enabled, client certificates are verified against ClientCAFile.
+func NewServerTLSConfig(store *CertificateStore, opts ServerTLSOptions) (*tls.Config, error) {
+	cfg := &tls.Config{GetCertificate: store.GetCertificate}
+	switch opts.ClientAuth {
+	case ClientAuthNone, "":
+		return cfg, nil
+	case ClientAuthRequest:
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	case ClientAuthRequire:
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client auth mode %q", opts.ClientAuth)
+	}
+	if opts.ClientCAFile == "" {
+		return nil, errors.New("client authentication requires a client CA bundle")
+	}
+	pool, err := loadCertPool(opts.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// loadCertPool reads a PEM CA bundle
+func loadCertPool(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA bundle %s", path)
+	}
+	return pool, nil
+}
+
+// verifyPinned checks the peer's leaf certificate against the pinned fingerprints
+func verifyPinned(rawCerts [][]byte, pins [][sha256.Size]byte, now time.Time) error {
+	if len(rawCerts) == 0 {
+		return errors.New("peer presented no certificate")
+	}
+	sum := sha256.Sum256(rawCerts[0])
+	for _, pin := range pins {
+		if bytes.Equal(sum[:], pin[:]) {
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse peer certificate: %w", err)
+			}
+			if now.Before(leaf.NotBefore) || now.After(leaf.NotAfter) {
+				return fmt.Errorf("pinned certificate is not valid at %s (valid %s to %s)",
+					now.Format(time.RFC3339), leaf.NotBefore.Format(time.RFC3339), leaf.NotAfter.Format(time.RFC3339))
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("peer certificate SHA-256 %x does not match any pinned fingerprint", sum)
+}
+
+// ParsePins splits a comma-separated list of fingerprints
+func ParsePins(list string) []string {
+	var pins []string
+	for _, pin := range strings.Split(list, ",") {
+		if pin = strings.TrimSpace(pin); pin != "" {
+			pins = append(pins, pin)
+		}
+	}
+	return pins
+}